@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"myproject/mnoadapter"
+	"myproject/mnochannel"
+)
+
+// mnoAdapters keeps the adapter of every HTTP channel, rebuilding it when the channel's configuration changes
+type mnoAdapters struct {
+	mu       sync.Mutex
+	adapters map[uint]cachedAdapter
+}
+
+type cachedAdapter struct {
+	config  string
+	adapter mnoadapter.MNOAdapter
+}
+
+func newMNOAdapters() *mnoAdapters {
+	return &mnoAdapters{adapters: make(map[uint]cachedAdapter)}
+}
+
+// errNoAdapter is returned for HTTP channels without an adapter configuration. It counts against the
+// channel's circuit breaker, so the message fails over or is retried rather than reported as sent.
+var errNoAdapter = errors.New("no http_config configured")
+
+// adapter returns the adapter of a channel
+func (a *mnoAdapters) adapter(channel mnochannel.Channel) (mnoadapter.MNOAdapter, error) {
+	if len(channel.HTTP) == 0 {
+		return nil, errNoAdapter
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if cached, ok := a.adapters[channel.ChannelID]; ok && cached.config == string(channel.HTTP) {
+		return cached.adapter, nil
+	}
+
+	cfg, err := mnoadapter.ParseHTTPConfig(channel.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	adapter, err := mnoadapter.NewHTTPAdapter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	a.adapters[channel.ChannelID] = cachedAdapter{config: string(channel.HTTP), adapter: adapter}
+	return adapter, nil
+}
@@ -6,74 +6,86 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/go-redis/redis/v8"
-	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
-	"github.com/influxdata/influxdb-client-go/v2/api"
 	"github.com/joho/godotenv"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+
+	"myproject/consumer"
+	"myproject/dlr"
+	"myproject/dnd"
+	"myproject/mnoadapter"
+	"myproject/mnochannel"
+	"myproject/rabbitmq"
+	"myproject/ratelimit"
+	"myproject/smpp"
+	"myproject/smsencoding"
 )
 
+// defaultQueues are consumed, one priority level apart, until the gateway publishes the tiers of MsgPriority
+var defaultQueues = []string{"otp", "transactional", "promotional", "general"}
+
 const (
-	QueueName         = "general"
-	MaxWorkers        = 200
-	PrefetchCount     = 500
-	RedisLockTTL      = 30 * time.Second
-	RedisRateWindow   = 1 * time.Second
-	InfluxBatchSize   = 5000
-	HeartbeatInterval = 5 * time.Second
-	ReconnectDelay    = 5 * time.Second
+	RedisLockTTL = 30 * time.Second
+	// LockedDelay is how long a message locked by another worker, e.g. a redelivered copy, is postponed
+	LockedDelay = 5 * time.Second
+	// MaxTokenWait is how long a worker waits for a channel TPS token before the message is postponed
+	MaxTokenWait = 2 * time.Second
+	// ThrottleDelay is how long a message throttled by the operator is postponed
+	ThrottleDelay = 1 * time.Second
+	// PartsTTL is how long the parts of a message the operator accepted are remembered, so that a retry
+	// only submits the remaining ones
+	PartsTTL = 72 * time.Hour
+	// PartUnknown is the status of a part sent to the operator without an answer, which it may have accepted.
+	// Such parts are not resubmitted automatically.
+	PartUnknown = mnoadapter.StatusUnknown
 )
 
-// MNO-specific TPS limits (slightly lower than provided to be safe)
-var mnoTPSLimits = map[string]int{
-	"Robi":     1, // Provided: 2, Using: 1
-	"Gp":       2, // Provided: 3, Using: 2
-	"Airtel":   4, // Provided: 5, Using: 4
-	"Bl":       5, // Provided: 6, Using: 5
-	"Teletalk": 1, // Provided: 1, Using: 1 (no lower option, but safe)
-	"Tpgw":     1, // Provided: 1, Using: 1 (no lower option, but safe)
-}
-
-var (
-	ctx               = context.Background()
-	influxFlushPeriod = 100 * time.Millisecond
+// Counters kept in addition to those of the consumer package
+const (
+	MetricSuccess     = "success"
+	MetricFailure     = "failure"
+	MetricRateLimited = "rate_limited"
+	MetricDNDBlocked  = "dnd_blocked"
+	MetricCircuitOpen = "circuit_open"
 )
 
-type SafeConsumer struct {
-	instanceID   string
-	rabbitConn   *amqp.Connection
-	rabbitChan   *amqp.Channel
-	influxAPI    api.WriteAPI
-	redisClient  *redis.Client
-	successCount uint64
-	failureCount uint64
-	rateLimited  uint64
-	rabbitURLs   []string
+// SMSMessage is the payload queued by the SMS gateway
+type SMSMessage struct {
+	App       string `json:"app"`
+	MsgID     string `json:"msg_id"`
+	RequestID string `json:"request_id"`
+	MNO       string `json:"mno"`
+	MSISDN    string `json:"msisdn"`
+	Text      string `json:"text"`
+	Type      string `json:"type"`
+	// ChannelID pins the message to an MNO channel, e.g. when it was replayed with a channel override
+	ChannelID uint `json:"channel_id,omitempty"`
 }
 
-func NewSafeConsumer() (*SafeConsumer, error) {
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning loading .env: %v", err)
-	}
-
-	instanceID := os.Getenv("INSTANCE_ID")
-	if instanceID == "" {
-		return nil, errors.New("INSTANCE_ID must be set")
-	}
-
-	rabbitURLs := strings.Split(os.Getenv("RABBITMQ_URLS"), ",")
-	if len(rabbitURLs) == 0 || rabbitURLs[0] == "" {
-		return nil, errors.New("RABBITMQ_URLS must be set with at least one URL")
-	}
+// SMSHandler submits queued SMS to the MNO APIs after the DND and rate limit checks
+type SMSHandler struct {
+	instanceID  string
+	dndTypes    []string
+	redisClient *redis.Client
+	channels    *mnochannel.Table
+	selector    *mnochannel.Selector
+	limiter     *ratelimit.TokenBucket
+	smpp        *smppSessions
+	adapters    *mnoAdapters
+	// channel is the last consuming channel, used to queue the receipts SMPP channels deliver asynchronously
+	channel      atomic.Pointer[amqp.Channel]
+	statusWriter *consumer.StatusWriter
+}
 
+func NewSMSHandler(instanceID string) (*SMSHandler, error) {
 	redisURL := os.Getenv("REDIS_URL")
 	if redisURL == "" {
 		return nil, errors.New("REDIS_URL must be set")
@@ -85,264 +97,465 @@ func NewSafeConsumer() (*SafeConsumer, error) {
 		DB:       0,
 	})
 
-	influxURL := os.Getenv("INFLUXDB_URL")
-	influxToken := os.Getenv("INFLUXDB_TOKEN")
-	influxOrg := os.Getenv("INFLUXDB_ORG")
-	influxBucket := os.Getenv("INFLUXDB_BUCKET")
-	if influxURL == "" || influxToken == "" || influxOrg == "" || influxBucket == "" {
-		return nil, errors.New("INFLUXDB_URL, INFLUXDB_TOKEN, INFLUXDB_ORG, and INFLUXDB_BUCKET must be set")
+	dndTypes := []string{"promotional", "marketing"}
+	if value := os.Getenv("DND_MESSAGE_TYPES"); value != "" {
+		dndTypes = strings.Split(value, ",")
 	}
 
-	influxClient := influxdb2.NewClientWithOptions(
-		influxURL,
-		influxToken,
-		influxdb2.DefaultOptions().
-			SetBatchSize(InfluxBatchSize).
-			SetFlushInterval(uint(influxFlushPeriod.Milliseconds())),
-	)
-	writeAPI := influxClient.WriteAPI(influxOrg, influxBucket)
-
-	conn, err := connectRabbitMQ(rabbitURLs)
-	if err != nil {
-		return nil, fmt.Errorf("RabbitMQ connection failed: %v", err)
+	// Without the key, channels with an SMPP password or HTTP configuration cannot be loaded
+	if err := mnochannel.CheckCredentialsKey(); err != nil {
+		log.Printf("Warning: %v, channels with an SMPP password or HTTP configuration are unavailable", err)
 	}
-
-	ch, err := conn.Channel()
+	channels := mnochannel.NewTable(redisClient, mnochannel.DefaultRefresh)
+	breaker, err := mnochannel.BreakerConfigFromEnv()
 	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("Channel creation failed: %v", err)
+		return nil, err
 	}
 
-	if err := ch.Qos(PrefetchCount, 0, false); err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, fmt.Errorf("Qos failed: %v", err)
-	}
-
-	return &SafeConsumer{
+	h := &SMSHandler{
 		instanceID:  instanceID,
-		rabbitConn:  conn,
-		rabbitChan:  ch,
-		influxAPI:   writeAPI,
+		dndTypes:    dndTypes,
 		redisClient: redisClient,
-		rabbitURLs:  rabbitURLs,
-	}, nil
+		channels:    channels,
+		selector:    mnochannel.NewSelector(channels, redisClient, breaker),
+		limiter:     ratelimit.NewTokenBucket(redisClient),
+	}
+	h.selector.OnEvent = h.breakerEvent
+	h.smpp = newSMPPSessions(h.handleDeliver)
+	h.adapters = newMNOAdapters()
+	return h, nil
 }
 
-func connectRabbitMQ(urls []string) (*amqp.Connection, error) {
-	for _, url := range urls {
-		conn, err := amqp.DialConfig(url, amqp.Config{
-			Heartbeat: HeartbeatInterval,
-		})
-		if err == nil {
-			log.Printf("Connected to RabbitMQ at %s", url)
-			return conn, nil
-		}
-		log.Printf("Failed to connect to %s: %v", url, err)
-	}
-	return nil, errors.New("failed to connect to any RabbitMQ node")
+func (h *SMSHandler) Close() {
+	h.smpp.Close()
+	h.redisClient.Close()
+}
+
+func (h *SMSHandler) acquireMessageLock(ctx context.Context, messageID string) (bool, error) {
+	return h.redisClient.SetNX(ctx, "lock:"+messageID, h.instanceID, RedisLockTTL).Result()
+}
+
+// partsKey is the Redis hash of the status of every part of a message the operator accepted, by seq
+func partsKey(msgID string) string {
+	return "sms:parts:" + msgID
 }
 
-func (c *SafeConsumer) Close() {
-	if c.rabbitChan != nil {
-		c.rabbitChan.Close()
+// acceptedParts returns the status of the parts of a message accepted by an earlier attempt
+func (h *SMSHandler) acceptedParts(ctx context.Context, msgID string) (map[int]string, error) {
+	accepted := make(map[int]string)
+	if msgID == "" {
+		return accepted, nil
 	}
-	if c.rabbitConn != nil {
-		c.rabbitConn.Close()
+	values, err := h.redisClient.HGetAll(ctx, partsKey(msgID)).Result()
+	if err != nil {
+		return nil, err
 	}
-	if c.redisClient != nil {
-		c.redisClient.Close()
+	for seq, status := range values {
+		if n, err := strconv.Atoi(seq); err == nil {
+			accepted[n] = status
+		}
 	}
-	c.influxAPI.Flush()
+	return accepted, nil
 }
 
-func (c *SafeConsumer) acquireMessageLock(messageID string) (bool, error) {
-	return c.redisClient.SetNX(ctx, "lock:"+messageID, c.instanceID, RedisLockTTL).Result()
+// partAccepted remembers a part the operator accepted
+func (h *SMSHandler) partAccepted(ctx context.Context, msgID string, seq int, status string) {
+	if msgID == "" {
+		return
+	}
+	pipe := h.redisClient.Pipeline()
+	pipe.HSet(ctx, partsKey(msgID), strconv.Itoa(seq), status)
+	pipe.Expire(ctx, partsKey(msgID), PartsTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to record part %d of %s as accepted: %v", seq, msgID, err)
+	}
 }
 
-func (c *SafeConsumer) checkMNORateLimit(mno string) (bool, error) {
-	tpsLimit, ok := mnoTPSLimits[mno]
-	if !ok {
-		return true, fmt.Errorf("unknown MNO: %s", mno)
+// selectChannel returns the channel a message is submitted on: the channel it is pinned to,
+// otherwise the MNO's active channel with the best priority whose circuit breaker is closed
+func (h *SMSHandler) selectChannel(ctx context.Context, message SMSMessage) (mnochannel.Channel, error) {
+	if message.ChannelID != 0 {
+		channel, ok, err := h.channels.Find(ctx, message.MNO, message.ChannelID)
+		if err != nil {
+			return channel, err
+		}
+		if !ok {
+			return channel, fmt.Errorf("channel %d of %s is not active", message.ChannelID, message.MNO)
+		}
+		return channel, h.selector.Allow(ctx, channel)
 	}
 
-	window := time.Now().Truncate(RedisRateWindow).Unix()
-	key := fmt.Sprintf("rate:%s:%d", mno, window)
+	return h.selector.Select(ctx, message.MNO)
+}
 
-	count, err := c.redisClient.Incr(ctx, key).Result()
-	if err != nil {
-		return false, err
+// submitToMNOAPI submits one part on the channel, over SMPP for SMPP channels and through the
+// channel's adapter otherwise. It returns the part status, submitted or delivered.
+func (h *SMSHandler) submitToMNOAPI(ctx context.Context, channel mnochannel.Channel, message SMSMessage, encoding smsencoding.Encoding, part smsencoding.Part) (string, error) {
+	if channel.IsSMPP() {
+		m := smpp.TextMessage(channel.SMPP.SourceAddr, message.MSISDN, encoding, part)
+		err := h.submitSMPP(ctx, channel, message, smppSubmission{Message: message, Seq: part.Seq, Total: part.Total}, m)
+		return mnoadapter.StatusSubmitted, err
 	}
 
-	if count == 1 {
-		c.redisClient.Expire(ctx, key, RedisRateWindow)
+	adapter, err := h.adapters.adapter(channel)
+	if err != nil {
+		return "", fmt.Errorf("channel %d adapter: %v", channel.ChannelID, err)
 	}
-
-	return count > int64(tpsLimit), nil
+	result, err := adapter.Submit(ctx, mnoadapter.Submission{
+		MsgID:    message.MsgID,
+		MSISDN:   message.MSISDN,
+		Text:     part.Text,
+		Encoding: encoding,
+		Seq:      part.Seq,
+		Total:    part.Total,
+		UDH:      part.UDH,
+	})
+	return result.Status, err
 }
 
-func (c *SafeConsumer) submitToMNOAPI(mno, msgID string) error {
-	// Simulate API call (replace with actual HTTP call to MNO SMS API)
-	log.Printf("Submitting to %s SMS API for msg_id: %s", mno, msgID)
-	time.Sleep(50 * time.Millisecond) // Simulate network delay
-	return nil
-}
+// Handle processes one queued SMS
+func (h *SMSHandler) Handle(ctx context.Context, d *consumer.Delivery) consumer.Result {
+	h.channel.Store(d.Channel)
 
-func (c *SafeConsumer) ProcessMessage(msg amqp.Delivery) {
-	locked, err := c.acquireMessageLock(msg.MessageId)
-	if err != nil || !locked {
-		msg.Nack(false, true)
-		return
+	var message SMSMessage
+	if err := json.Unmarshal(d.Body, &message); err != nil {
+		log.Printf("Parking malformed message %s: %v", d.MessageId, err)
+		return consumer.Discard("invalid payload")
 	}
-	defer c.redisClient.Del(ctx, "lock:"+msg.MessageId)
 
-	var message struct {
-		MsgID string `json:"msg_id"`
-		MNO   string `json:"mno"`
+	// Lock on the msg_id of the payload, which every message carries, rather than the AMQP message ID
+	lockID := message.MsgID
+	if lockID == "" {
+		lockID = d.MessageId
 	}
-	if err := json.Unmarshal(msg.Body, &message); err != nil {
-		atomic.AddUint64(&c.failureCount, 1)
-		msg.Nack(false, true)
-		return
+	if lockID != "" {
+		locked, err := h.acquireMessageLock(ctx, lockID)
+		if err != nil {
+			return consumer.RetryLater("message lock failed: " + err.Error())
+		}
+		if !locked {
+			return consumer.Later(fmt.Sprintf("message %s is being processed by another worker", lockID), LockedDelay)
+		}
+		defer h.redisClient.Del(ctx, "lock:"+lockID)
 	}
 
 	if message.MNO == "" {
 		log.Printf("Message %s has no MNO specified", message.MsgID)
-		atomic.AddUint64(&c.failureCount, 1)
-		msg.Nack(false, true)
-		return
+		return consumer.Discard("no MNO specified")
+	}
+
+	// Numbers may have been added to the DND list after the message was queued
+	if dnd.AppliesTo(h.dndTypes, message.Type) {
+		blocked, err := h.redisClient.SIsMember(ctx, dnd.SetKey, message.MSISDN).Result()
+		if err != nil {
+			log.Printf("DND check failed for %s: %v", message.MsgID, err)
+			return consumer.RetryLater("DND check failed")
+		}
+		if blocked {
+			d.Metrics.Inc(MetricDNDBlocked)
+			d.Status.Write(
+				"final_sms_delivery",
+				map[string]string{
+					"msg_id": message.MsgID,
+					"mno":    message.MNO,
+					"status": dnd.StatusBlocked,
+				},
+				map[string]interface{}{
+					"processing_time_ms": 0,
+				},
+			)
+			h.reportDLR(ctx, d.Channel, message, dnd.StatusBlocked, 0)
+			return consumer.Done()
+		}
 	}
 
-	limited, err := c.checkMNORateLimit(message.MNO)
+	channel, err := h.selectChannel(ctx, message)
+	var unavailable *mnochannel.UnavailableError
+	if errors.As(err, &unavailable) {
+		// Park the message on the delay queues until a breaker lets a trial through rather than using up its retries
+		d.Metrics.Inc(MetricCircuitOpen)
+		return consumer.Later(err.Error(), unavailable.RetryAfter)
+	}
 	if err != nil {
-		log.Printf("Rate limit check failed for %s: %v", message.MNO, err)
-		atomic.AddUint64(&c.failureCount, 1)
-		msg.Nack(false, true)
-		return
+		log.Printf("No channel for %s: %v", message.MsgID, err)
+		return consumer.RetryLater(err.Error())
 	}
-	if limited {
-		atomic.AddUint64(&c.rateLimited, 1)
-		msg.Ack(false)
-		return
+
+	// A retried message only submits the parts an earlier attempt did not get accepted
+	encoding := smsencoding.Detect(message.Text)
+	parts := smsencoding.Split(message.Text, message.MsgID)
+	accepted, err := h.acceptedParts(ctx, message.MsgID)
+	if err != nil {
+		log.Printf("Failed to read the accepted parts of %s: %v", message.MsgID, err)
+		return consumer.RetryLater("failed to read accepted parts: " + err.Error())
+	}
+	remaining := make([]smsencoding.Part, 0, len(parts))
+	submitted, delivered, unknown := 0, 0, 0
+	for _, part := range parts {
+		status, ok := accepted[part.Seq]
+		switch {
+		case !ok:
+			remaining = append(remaining, part)
+		case status == PartUnknown:
+			unknown++
+		default:
+			submitted++
+			if status == mnoadapter.StatusDelivered {
+				delivered++
+			}
+		}
 	}
 
-	processingTime := time.Duration(50+rand.Intn(100)) * time.Millisecond
-	time.Sleep(processingTime)
+	// Every segment is one submission, so it takes one token of the channel's TPS shared by all instances,
+	// from the share of the message type or the unused share of a lower priority type
+	if channel.TPS > 0 && len(remaining) > 0 {
+		buckets := channel.Buckets(message.Type)
+		if len(buckets) == 0 {
+			log.Printf("No TPS allocated for %s messages on channel %d of %s", message.Type, channel.ChannelID, message.MNO)
+			return consumer.RetryLater(fmt.Sprintf("no TPS allocated for type %s on channel %d", message.Type, channel.ChannelID))
+		}
+		wait, err := h.limiter.WaitAny(ctx, buckets, len(remaining), MaxTokenWait)
+		if err != nil {
+			log.Printf("Rate limit check failed for channel %d of %s: %v", channel.ChannelID, message.MNO, err)
+			return consumer.RetryLater("rate limit check failed: " + err.Error())
+		}
+		if wait > 0 {
+			d.Metrics.Inc(MetricRateLimited)
+			return consumer.Later(fmt.Sprintf("TPS limit of %s on channel %d reached", message.Type, channel.ChannelID), wait)
+		}
+	}
 
-	// Submit to MNO SMS API and set status
-	var status string
-	err = c.submitToMNOAPI(message.MNO, message.MsgID)
-	if err != nil {
-		status = "failed"
-		atomic.AddUint64(&c.failureCount, 1)
-		log.Printf("Failed to submit to %s API: %v", message.MNO, err)
-	} else {
-		status = "delivered"
-		atomic.AddUint64(&c.successCount, 1)
+	// Submit every segment to the MNO SMS API under the parent msg_id and set status
+	started := time.Now()
+	for _, part := range remaining {
+		partStarted := time.Now()
+		partStatus, err := h.submitToMNOAPI(ctx, channel, message, encoding, part)
+		h.selector.Record(ctx, channel, time.Since(partStarted), unavailability(err))
+		if outcomeUnknown(err) {
+			log.Printf("No answer for part %d/%d of %s from %s, not resubmitting it: %v", part.Seq, part.Total, message.MsgID, message.MNO, err)
+			partStatus, err = PartUnknown, nil
+		} else if err != nil {
+			partStatus = "failed"
+			log.Printf("Failed to submit part %d/%d of %s to %s API: %v", part.Seq, part.Total, message.MsgID, message.MNO, err)
+		}
+
+		d.Status.Write(
+			"sms_segment",
+			map[string]string{
+				"msg_id": message.MsgID,
+				"mno":    message.MNO,
+				"status": partStatus,
+			},
+			map[string]interface{}{
+				"seq":   part.Seq,
+				"total": part.Total,
+			},
+		)
+
+		if err != nil {
+			return h.submissionFailed(d, channel, err)
+		}
+		h.partAccepted(ctx, message.MsgID, part.Seq, partStatus)
+		switch partStatus {
+		case PartUnknown:
+			unknown++
+		case mnoadapter.StatusDelivered:
+			delivered++
+			submitted++
+		default:
+			submitted++
+		}
 	}
+	processingTime := time.Since(started)
+
+	// Operators that accept parts for delivery report the outcome later, in a receipt. A message with
+	// unanswered parts is left for an operator to reconcile rather than reported.
+	status := "submitted"
+	switch {
+	case unknown > 0:
+		status = PartUnknown
+	case delivered == len(parts):
+		status = dlr.StatusDelivered
+	}
+	d.Metrics.Inc(MetricSuccess)
 
-	point := influxdb2.NewPoint(
+	d.Status.Write(
 		"final_sms_delivery",
 		map[string]string{
-			"msg_id":   message.MsgID,
-			"instance": c.instanceID,
-			"mno":      message.MNO,
-			"status":   status,
+			"msg_id": message.MsgID,
+			"mno":    message.MNO,
+			"status": status,
 		},
 		map[string]interface{}{
 			"processing_time_ms": processingTime.Milliseconds(),
+			"encoding":           string(encoding),
+			"segments":           len(parts),
+			"segments_submitted": submitted,
+			"segments_unknown":   unknown,
+			"retry_count":        d.RetryCount(),
 		},
-		time.Now(),
 	)
-	c.influxAPI.WritePoint(point)
+	h.reportDLR(ctx, d.Channel, message, status, len(parts))
+	return consumer.Done()
+}
 
-	msg.Ack(false)
+// submissionFailed postpones a part the operator throttled, parks one it rejected permanently and retries otherwise
+func (h *SMSHandler) submissionFailed(d *consumer.Delivery, channel mnochannel.Channel, err error) consumer.Result {
+	switch {
+	case errors.Is(err, smpp.ErrThrottled), errors.Is(err, mnoadapter.ErrThrottled):
+		d.Metrics.Inc(MetricRateLimited)
+		return consumer.Later(fmt.Sprintf("operator throttled channel %d", channel.ChannelID), ThrottleDelay)
+	case mnoadapter.Permanent(err):
+		d.Metrics.Inc(MetricFailure)
+		return consumer.Discard(fmt.Sprintf("MNO rejected message: %v", err))
+	}
+	d.Metrics.Inc(MetricFailure)
+	return consumer.RetryLater(fmt.Sprintf("MNO submission failed: %v", err))
 }
 
-func (c *SafeConsumer) Run() error {
-	go func() {
-		for err := range c.influxAPI.Errors() {
-			log.Printf("InfluxDB write error: %v", err)
-		}
-	}()
-
-	msgs, err := c.rabbitChan.Consume(
-		QueueName,
-		"sms-consumer-"+c.instanceID,
-		false,
-		false,
-		false,
-		false,
-		nil,
+// outcomeUnknown reports whether a part was sent without an answer, so resubmitting it could deliver it twice
+func outcomeUnknown(err error) bool {
+	return errors.Is(err, smpp.ErrNoResponse) || errors.Is(err, mnoadapter.ErrUnknown)
+}
+
+// unavailability returns the submission errors that count against the channel's circuit breaker: outages and
+// timeouts. Throttling and permanent rejections come from an operator that is up, and cancellations from shutting down.
+func unavailability(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, smpp.ErrThrottled) || errors.Is(err, mnoadapter.ErrThrottled) || mnoadapter.Permanent(err) {
+		return nil
+	}
+	return err
+}
+
+// breakerEvent writes the circuit breaker transitions of the channels to InfluxDB for the dashboards
+func (h *SMSHandler) breakerEvent(event mnochannel.Event) {
+	if h.statusWriter == nil {
+		return
+	}
+	h.statusWriter.Write(
+		"channel_breaker",
+		map[string]string{
+			"mno":        event.MNO,
+			"channel_id": strconv.FormatUint(uint64(event.ChannelID), 10),
+			"event":      event.Type,
+		},
+		map[string]interface{}{
+			"active_channel_id": int64(event.ActiveChannelID),
+			"reason":            event.Reason,
+		},
+	)
+}
+
+// Failed records a message that was scheduled for retry or parked, and reports parked messages as failed
+func (h *SMSHandler) Failed(ctx context.Context, d *consumer.Delivery, outcome rabbitmq.RetryOutcome, reason string) {
+	var message SMSMessage
+	json.Unmarshal(d.Body, &message)
+
+	status := "retry_scheduled"
+	if outcome.Parked {
+		status = "failed"
+	}
+	d.Status.Write(
+		"final_sms_delivery",
+		map[string]string{
+			"msg_id": message.MsgID,
+			"mno":    message.MNO,
+			"status": status,
+		},
+		map[string]interface{}{
+			"retry_count":    outcome.RetryCount,
+			"retry_delay_ms": outcome.Delay.Milliseconds(),
+			"parked":         outcome.Parked,
+			"failure_reason": reason,
+		},
 	)
+	if outcome.Parked {
+		h.reportDLR(ctx, d.Channel, message, dlr.StatusFailed, 0)
+	}
+}
+
+// priorityTiers reads the priority tiers the gateway publishes from MsgPriority
+func (h *SMSHandler) priorityTiers(ctx context.Context) ([]consumer.Tier, error) {
+	data, err := h.redisClient.Get(ctx, consumer.TiersKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to start consumer: %v", err)
-	}
-
-	go func() {
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
-		for range ticker.C {
-			log.Printf("[%s] Stats - Success: %d, Failure: %d, RateLimited: %d",
-				c.instanceID,
-				atomic.LoadUint64(&c.successCount),
-				atomic.LoadUint64(&c.failureCount),
-				atomic.LoadUint64(&c.rateLimited),
-			)
-		}
-	}()
-
-	sem := make(chan struct{}, MaxWorkers)
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		<-c.rabbitConn.NotifyClose(make(chan *amqp.Error))
-		log.Printf("RabbitMQ connection closed, attempting to reconnect...")
-		for {
-			conn, err := connectRabbitMQ(c.rabbitURLs)
-			if err == nil {
-				c.rabbitConn = conn
-				ch, err := conn.Channel()
-				if err == nil {
-					c.rabbitChan = ch
-					if err := ch.Qos(PrefetchCount, 0, false); err == nil {
-						msgs, err = ch.Consume(QueueName, "sms-consumer-"+c.instanceID, false, false, false, false, nil)
-						if err == nil {
-							log.Printf("Reconnected and resumed consuming")
-							return
-						}
-					}
-				}
-			}
-			log.Printf("Reconnect failed: %v, retrying in %v", err, ReconnectDelay)
-			time.Sleep(ReconnectDelay)
-		}
-	}()
-
-	for {
-		select {
-		case msg := <-msgs:
-			sem <- struct{}{}
-			go func(m amqp.Delivery) {
-				defer func() { <-sem }()
-				c.ProcessMessage(m)
-			}(msg)
-		case <-sig:
-			log.Printf("[%s] Shutting down gracefully...", c.instanceID)
-			return nil
-		}
+		return nil, err
+	}
+	return consumer.ParseTiers(data)
+}
+
+// reportDLR queues a delivery receipt when the originating application registered a webhook
+func (h *SMSHandler) reportDLR(ctx context.Context, ch *amqp.Channel, message SMSMessage, status string, segments int) error {
+	if message.App == "" || !dlr.IsTerminal(status) {
+		return nil
 	}
+	enabled, err := h.redisClient.SIsMember(ctx, dlr.AppsKey, message.App).Result()
+	if err != nil {
+		log.Printf("DLR webhook check failed for %s: %v", message.App, err)
+		return err
+	}
+	if !enabled {
+		return nil
+	}
+
+	err = dlr.Publish(ch, dlr.QueueName, dlr.Event{
+		MsgID:     message.MsgID,
+		RequestID: message.RequestID,
+		App:       message.App,
+		MSISDN:    message.MSISDN,
+		MNO:       message.MNO,
+		Type:      message.Type,
+		Status:    status,
+		Segments:  segments,
+		Timestamp: time.Now(),
+		Attempt:   1,
+	})
+	if err != nil {
+		log.Printf("Failed to queue DLR for %s: %v", message.MsgID, err)
+	}
+	return err
 }
 
 func main() {
-	consumer, err := NewSafeConsumer()
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning loading .env: %v", err)
+	}
+	if os.Getenv("INSTANCE_ID") == "" {
+		log.Fatal("INSTANCE_ID must be set")
+	}
+
+	cfg, err := consumer.ConfigFromEnv(defaultQueues...)
+	if err != nil {
+		log.Fatalf("Failed to initialize consumer: %v", err)
+	}
+	// Delivery receipts are published on the consuming channel
+	cfg.Declare = dlr.DeclareQueues
+
+	handler, err := NewSMSHandler(cfg.InstanceID)
 	if err != nil {
 		log.Fatalf("Failed to initialize consumer: %v", err)
 	}
-	defer consumer.Close()
+	defer handler.Close()
+
+	// Every message type queue from MsgPriority is consumed, higher priorities first
+	for level, queue := range defaultQueues {
+		cfg.Tiers = append(cfg.Tiers, consumer.Tier{Queue: queue, Level: level})
+	}
+	cfg.TierSource = handler.priorityTiers
+
+	c, err := consumer.New(cfg, handler)
+	if err != nil {
+		log.Fatalf("Failed to initialize consumer: %v", err)
+	}
+	defer c.Close()
+	handler.statusWriter = c.Status()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	if err := consumer.Run(); err != nil {
+	if err := c.Run(ctx); err != nil {
 		log.Fatalf("Consumer failed: %v", err)
 	}
 }
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"myproject/dlr"
+	"myproject/mnochannel"
+	"myproject/smpp"
+)
+
+const (
+	// SMPPSubmitTimeout bounds the wait for a bound session, a window slot and the submit_sm_resp
+	SMPPSubmitTimeout = 10 * time.Second
+	// SMPPReceiptTTL is how long a submission waits for its delivery receipt
+	SMPPReceiptTTL = 72 * time.Hour
+)
+
+// smppSubmission is stored under the SMSC message ID of every submitted part to match its receipt
+type smppSubmission struct {
+	Message SMSMessage `json:"message"`
+	Seq     int        `json:"seq"`
+	Total   int        `json:"total"`
+}
+
+func smppSubmissionKey(channelID uint, smscID string) string {
+	return fmt.Sprintf("smpp:submission:%d:%s", channelID, smscID)
+}
+
+// smppPendingKey holds the parts of a channel submitted and not yet stored under their SMSC message ID,
+// scored by when their submission started
+func smppPendingKey(channelID uint) string {
+	return fmt.Sprintf("smpp:pending:%d", channelID)
+}
+
+// smppReceiptsKey records the delivered parts of a message by seq and marks it reported
+func smppReceiptsKey(msgID string) string {
+	return "smpp:receipts:" + msgID
+}
+
+// smppSessions keeps the clients of every SMPP channel, rebinding when the channel's connection settings change.
+// A transceiver channel has one client; transmitter and receiver channels bind a transmitter to submit and
+// a receiver for the delivery receipts.
+type smppSessions struct {
+	mu        sync.Mutex
+	clients   map[uint]*smppSession
+	onDeliver func(channelID uint, m smpp.Message) error
+}
+
+type smppSession struct {
+	config mnochannel.SMPP
+	client *smpp.Client
+	// receiver is the receiver bind paired with a transmitter, nil for a transceiver
+	receiver *smpp.Client
+}
+
+func (s *smppSession) close() {
+	s.client.Close()
+	if s.receiver != nil {
+		s.receiver.Close()
+	}
+}
+
+func newSMPPSessions(onDeliver func(channelID uint, m smpp.Message) error) *smppSessions {
+	return &smppSessions{clients: make(map[uint]*smppSession), onDeliver: onDeliver}
+}
+
+// client returns the client of a channel, creating it on first use
+func (s *smppSessions) client(channel mnochannel.Channel) (*smpp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.clients[channel.ChannelID]; ok {
+		if session.config == *channel.SMPP {
+			return session.client, nil
+		}
+		log.Printf("SMPP settings of channel %d changed, rebinding", channel.ChannelID)
+		go session.close()
+		delete(s.clients, channel.ChannelID)
+	}
+
+	mode, err := smpp.ParseBindMode(channel.SMPP.BindMode)
+	if err != nil {
+		return nil, err
+	}
+	channelID := channel.ChannelID
+	cfg := smpp.Config{
+		Addr:       net.JoinHostPort(channel.SMPP.Host, strconv.Itoa(channel.SMPP.Port)),
+		SystemID:   channel.SMPP.SystemID,
+		Password:   channel.SMPP.Password,
+		SystemType: channel.SMPP.SystemType,
+		BindMode:   smpp.Transceiver,
+		Window:     channel.SMPP.WindowSize,
+		OnDeliver: func(m smpp.Message) error {
+			return s.onDeliver(channelID, m)
+		},
+	}
+	session := &smppSession{config: *channel.SMPP}
+	if mode != smpp.Transceiver {
+		receiver := cfg
+		receiver.BindMode = smpp.Receiver
+		session.receiver = smpp.NewClient(receiver)
+		cfg.BindMode = smpp.Transmitter
+	}
+	session.client = smpp.NewClient(cfg)
+	s.clients[channel.ChannelID] = session
+	return session.client, nil
+}
+
+// Close unbinds every session
+func (s *smppSessions) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, session := range s.clients {
+		session.close()
+		delete(s.clients, id)
+	}
+}
+
+// submitSMPP submits one part and remembers it under the SMSC message ID until its receipt arrives. While
+// the part is in flight it is listed as pending on the channel, so a receipt that overtakes the submit_sm_resp
+// is rejected and delivered again by the SMSC instead of being dropped.
+func (h *SMSHandler) submitSMPP(ctx context.Context, channel mnochannel.Channel, message SMSMessage, submission smppSubmission, m smpp.Message) error {
+	client, err := h.smpp.client(channel)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(submission)
+	if err != nil {
+		return err
+	}
+
+	pendingKey := smppPendingKey(channel.ChannelID)
+	pending := message.MsgID + ":" + strconv.Itoa(submission.Seq)
+	if err := h.redisClient.ZAdd(ctx, pendingKey, redis.Z{Score: float64(time.Now().UnixMilli()), Member: pending}).Err(); err != nil {
+		return fmt.Errorf("failed to mark part %d pending: %v", submission.Seq, err)
+	}
+	defer h.redisClient.ZRem(context.WithoutCancel(ctx), pendingKey, pending)
+
+	ctx, cancel := context.WithTimeout(ctx, SMPPSubmitTimeout)
+	defer cancel()
+	smscID, err := client.Submit(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	if err := h.redisClient.Set(context.WithoutCancel(ctx), smppSubmissionKey(channel.ChannelID, smscID), data, SMPPReceiptTTL).Err(); err != nil {
+		log.Printf("Failed to store SMPP submission %s of %s: %v", smscID, message.MsgID, err)
+	}
+	return nil
+}
+
+// submissionsPending reports whether parts were submitted on a channel recently and not stored yet
+func (h *SMSHandler) submissionsPending(ctx context.Context, channelID uint) (bool, error) {
+	key := smppPendingKey(channelID)
+	// Entries left behind by a crashed instance expire once their submission timed out
+	stale := time.Now().Add(-2 * SMPPSubmitTimeout).UnixMilli()
+	pipe := h.redisClient.Pipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(stale, 10))
+	count := pipe.ZCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return count.Val() > 0, nil
+}
+
+// handleDeliver records the delivery receipts of an SMPP channel. A message is reported delivered once
+// every part was delivered, and failed or expired on the first part that was not.
+func (h *SMSHandler) handleDeliver(channelID uint, m smpp.Message) error {
+	receipt, ok := m.Receipt()
+	if !ok {
+		log.Printf("Ignoring mobile originated message from %s on channel %d", m.SourceAddr, channelID)
+		return nil
+	}
+	if !receipt.Final() {
+		return nil
+	}
+
+	ctx := context.Background()
+	data, err := h.redisClient.Get(ctx, smppSubmissionKey(channelID, receipt.ID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		pending, err := h.submissionsPending(ctx, channelID)
+		if err != nil {
+			return err
+		}
+		if pending {
+			return fmt.Errorf("submission of receipt %s on channel %d not stored yet", receipt.ID, channelID)
+		}
+		log.Printf("No submission found for receipt %s on channel %d", receipt.ID, channelID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var submission smppSubmission
+	if err := json.Unmarshal(data, &submission); err != nil {
+		return err
+	}
+	message := submission.Message
+
+	status := receiptStatus(receipt.State)
+	h.statusWriter.Write(
+		"sms_segment",
+		map[string]string{
+			"msg_id": message.MsgID,
+			"mno":    message.MNO,
+			"status": status,
+		},
+		map[string]interface{}{
+			"seq":        submission.Seq,
+			"total":      submission.Total,
+			"smsc_id":    receipt.ID,
+			"smsc_state": receipt.State,
+			"smsc_error": receipt.Err,
+		},
+	)
+
+	// Parts are recorded by seq, so a receipt the SMSC delivers again is not counted twice
+	key := smppReceiptsKey(message.MsgID)
+	if status == dlr.StatusDelivered {
+		pipe := h.redisClient.Pipeline()
+		pipe.HSet(ctx, key, strconv.Itoa(submission.Seq), status)
+		pipe.Expire(ctx, key, SMPPReceiptTTL)
+		parts := pipe.HGetAll(ctx, key)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+		if deliveredParts(parts.Val(), submission.Total) < submission.Total {
+			return nil
+		}
+	}
+	first, err := h.redisClient.HSetNX(ctx, key, "reported", status).Result()
+	if err != nil {
+		return err
+	}
+	h.redisClient.Expire(ctx, key, SMPPReceiptTTL)
+	if !first {
+		return nil
+	}
+
+	ch := h.channel.Load()
+	if ch == nil {
+		err = errors.New("no channel to queue the delivery receipt on")
+	} else {
+		err = h.reportDLR(ctx, ch, message, status, submission.Total)
+	}
+	if err != nil {
+		// Let the SMSC deliver the receipt again
+		h.redisClient.HDel(ctx, key, "reported")
+		return err
+	}
+
+	h.statusWriter.Write(
+		"final_sms_delivery",
+		map[string]string{
+			"msg_id": message.MsgID,
+			"mno":    message.MNO,
+			"status": status,
+		},
+		map[string]interface{}{
+			"segments":   submission.Total,
+			"smsc_state": receipt.State,
+		},
+	)
+	return nil
+}
+
+// deliveredParts counts the distinct parts of a message recorded as delivered
+func deliveredParts(parts map[string]string, total int) int {
+	delivered := 0
+	for seq, status := range parts {
+		if n, err := strconv.Atoi(seq); err == nil && n >= 1 && n <= total && status == dlr.StatusDelivered {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// receiptStatus maps the final state of an SMPP receipt to a message status
+func receiptStatus(state string) string {
+	switch state {
+	case smpp.StateDelivered:
+		return dlr.StatusDelivered
+	case smpp.StateExpired:
+		return dlr.StatusExpired
+	}
+	return dlr.StatusFailed
+}
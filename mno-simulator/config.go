@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the simulated operator's behaviour, read from SIM_* environment variables
+type Config struct {
+	HTTPAddr  string
+	HTTPToken string
+	SMPPAddr  string
+	// SystemID and Password are required from binding clients when set
+	SystemID string
+	Password string
+
+	// Latency is applied to every submission before it is answered
+	Latency Distribution
+	// TPS caps the submissions accepted per second over both protocols; 0 disables the cap
+	TPS float64
+	// ThrottleRate, ErrorRate and RejectRate are the fractions of submissions refused as throttled,
+	// with a temporary error and with a permanent error
+	ThrottleRate float64
+	ErrorRate    float64
+	RejectRate   float64
+
+	// DLRDelay is the time between accepting a submission and reporting its final state
+	DLRDelay      Distribution
+	DLRFailRate   float64
+	DLRExpireRate float64
+	// DLRRetry is the wait before resending a receipt the client did not acknowledge
+	DLRRetry time.Duration
+	// DLRURL receives the receipts of HTTP submissions when set
+	DLRURL string
+
+	StatsInterval time.Duration
+}
+
+// LoadConfig reads the configuration from the environment
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		HTTPAddr:  env("SIM_HTTP_ADDR", ":9090"),
+		HTTPToken: os.Getenv("SIM_HTTP_TOKEN"),
+		SMPPAddr:  env("SIM_SMPP_ADDR", ":2775"),
+		SystemID:  os.Getenv("SIM_SYSTEM_ID"),
+		Password:  os.Getenv("SIM_PASSWORD"),
+		DLRURL:    os.Getenv("SIM_DLR_URL"),
+	}
+
+	var err error
+	if cfg.Latency, err = ParseDistribution(env("SIM_LATENCY", "uniform:20ms-80ms")); err != nil {
+		return cfg, fmt.Errorf("SIM_LATENCY: %w", err)
+	}
+	if cfg.DLRDelay, err = ParseDistribution(env("SIM_DLR_DELAY", "uniform:1s-5s")); err != nil {
+		return cfg, fmt.Errorf("SIM_DLR_DELAY: %w", err)
+	}
+	if cfg.DLRRetry, err = time.ParseDuration(env("SIM_DLR_RETRY", "5s")); err != nil {
+		return cfg, fmt.Errorf("SIM_DLR_RETRY: %w", err)
+	}
+	if cfg.StatsInterval, err = time.ParseDuration(env("SIM_STATS_INTERVAL", "10s")); err != nil {
+		return cfg, fmt.Errorf("SIM_STATS_INTERVAL: %w", err)
+	}
+
+	floats := []struct {
+		name  string
+		value *float64
+		rate  bool
+	}{
+		{"SIM_TPS", &cfg.TPS, false},
+		{"SIM_THROTTLE_RATE", &cfg.ThrottleRate, true},
+		{"SIM_ERROR_RATE", &cfg.ErrorRate, true},
+		{"SIM_REJECT_RATE", &cfg.RejectRate, true},
+		{"SIM_DLR_FAIL_RATE", &cfg.DLRFailRate, true},
+		{"SIM_DLR_EXPIRE_RATE", &cfg.DLRExpireRate, true},
+	}
+	for _, f := range floats {
+		raw := os.Getenv(f.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || value < 0 || (f.rate && value > 1) {
+			return cfg, fmt.Errorf("%s: invalid value %q", f.name, raw)
+		}
+		*f.value = value
+	}
+	if cfg.ThrottleRate+cfg.ErrorRate+cfg.RejectRate > 1 {
+		return cfg, fmt.Errorf("SIM_THROTTLE_RATE, SIM_ERROR_RATE and SIM_REJECT_RATE add up to more than 1")
+	}
+	if cfg.DLRFailRate+cfg.DLRExpireRate > 1 {
+		return cfg, fmt.Errorf("SIM_DLR_FAIL_RATE and SIM_DLR_EXPIRE_RATE add up to more than 1")
+	}
+	return cfg, nil
+}
+
+func env(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Distribution draws random durations
+type Distribution struct {
+	kind string
+	a, b time.Duration
+}
+
+// ParseDistribution reads "fixed:50ms", "uniform:20ms-200ms", "normal:100ms,30ms" (mean and standard
+// deviation) or "exp:80ms" (mean). A bare duration is fixed.
+func ParseDistribution(spec string) (Distribution, error) {
+	kind, params, ok := strings.Cut(spec, ":")
+	if !ok {
+		kind, params = "fixed", spec
+	}
+
+	var sep string
+	switch kind {
+	case "fixed", "exp":
+	case "uniform":
+		sep = "-"
+	case "normal":
+		sep = ","
+	default:
+		return Distribution{}, fmt.Errorf("unknown distribution %q", kind)
+	}
+
+	d := Distribution{kind: kind}
+	first, second := params, ""
+	if sep != "" {
+		if first, second, ok = strings.Cut(params, sep); !ok {
+			return Distribution{}, fmt.Errorf("%s distribution needs two durations separated by %q", kind, sep)
+		}
+	}
+	var err error
+	if d.a, err = time.ParseDuration(strings.TrimSpace(first)); err != nil || d.a < 0 {
+		return Distribution{}, fmt.Errorf("invalid duration %q", first)
+	}
+	if sep != "" {
+		if d.b, err = time.ParseDuration(strings.TrimSpace(second)); err != nil || d.b < 0 {
+			return Distribution{}, fmt.Errorf("invalid duration %q", second)
+		}
+	}
+	if kind == "uniform" && d.b < d.a {
+		return Distribution{}, fmt.Errorf("uniform distribution maximum is below its minimum")
+	}
+	return d, nil
+}
+
+// Sample draws a duration, never negative
+func (d Distribution) Sample() time.Duration {
+	var sample time.Duration
+	switch d.kind {
+	case "fixed":
+		sample = d.a
+	case "uniform":
+		sample = d.a + time.Duration(rand.Int64N(int64(d.b-d.a)+1))
+	case "normal":
+		sample = d.a + time.Duration(rand.NormFloat64()*float64(d.b))
+	case "exp":
+		sample = time.Duration(rand.ExpFloat64() * float64(d.a))
+	}
+	return max(sample, 0)
+}
+
+func (d Distribution) String() string {
+	switch d.kind {
+	case "uniform":
+		return fmt.Sprintf("uniform:%s-%s", d.a, d.b)
+	case "normal":
+		return fmt.Sprintf("normal:%s,%s", d.a, d.b)
+	}
+	return fmt.Sprintf("%s:%s", d.kind, d.a)
+}
@@ -0,0 +1,10 @@
+module mno-simulator
+
+go 1.24.1
+
+require (
+	github.com/joho/godotenv v1.5.1
+	myproject v0.0.0
+)
+
+replace myproject => ../service-core
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Response codes of the HTTP API, matching service-core/mno-adapter.example.json
+const (
+	codeSubmitted = "200"
+	codeRejected  = "1001"
+	codeThrottled = "1009"
+	codeError     = "5000"
+)
+
+// sendRequest is the body of POST /api/v1/send; form or query parameters of the same names are accepted too
+type sendRequest struct {
+	MSISDN string `json:"msisdn"`
+	SMS    string `json:"sms"`
+	CSMSID string `json:"csms_id"`
+}
+
+type httpAPI struct {
+	sim *Simulator
+	dlr *http.Client
+}
+
+func newHTTPHandler(sim *Simulator) http.Handler {
+	api := &httpAPI{sim: sim, dlr: &http.Client{Timeout: 5 * time.Second}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/send", api.send)
+	mux.HandleFunc("GET /stats", api.statistics)
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	return mux
+}
+
+// send answers a submission the way an operator API would
+func (a *httpAPI) send(w http.ResponseWriter, r *http.Request) {
+	if token := a.sim.cfg.HTTPToken; token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+		writeStatus(w, http.StatusUnauthorized, codeRejected, "Invalid token", "")
+		return
+	}
+
+	var req sendRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeStatus(w, http.StatusBadRequest, codeRejected, "Invalid JSON body", "")
+			return
+		}
+	} else {
+		req = sendRequest{MSISDN: r.FormValue("msisdn"), SMS: r.FormValue("sms"), CSMSID: r.FormValue("csms_id")}
+	}
+	if req.MSISDN == "" || req.SMS == "" {
+		writeStatus(w, http.StatusBadRequest, codeRejected, "msisdn and sms are required", "")
+		return
+	}
+
+	switch a.sim.Submit() {
+	case Throttled:
+		writeStatus(w, http.StatusTooManyRequests, codeThrottled, "TPS limit exceeded", "")
+	case TemporaryError:
+		writeStatus(w, http.StatusServiceUnavailable, codeError, "Service temporarily unavailable", "")
+	case Rejected:
+		writeStatus(w, http.StatusBadRequest, codeRejected, "Invalid MSISDN", "")
+	default:
+		messageID := a.sim.MessageID()
+		writeStatus(w, http.StatusOK, codeSubmitted, "Success", messageID)
+		if a.sim.cfg.DLRURL != "" {
+			receipt, delay := a.sim.Receipt(messageID, "", req.MSISDN, []byte(req.SMS))
+			time.AfterFunc(delay, func() { a.report(receipt, req.CSMSID) })
+		}
+	}
+}
+
+// report posts the receipt of an HTTP submission to SIM_DLR_URL
+func (a *httpAPI) report(receipt Receipt, csmsID string) {
+	body, _ := json.Marshal(map[string]string{
+		"message_id": receipt.MessageID,
+		"csms_id":    csmsID,
+		"msisdn":     receipt.Destination,
+		"status":     receipt.State,
+		"error_code": receipt.Err,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.sim.cfg.DLRURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to build receipt callback: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.dlr.Do(req)
+	if err != nil {
+		log.Printf("Failed to post receipt of %s: %v", receipt.MessageID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Receipt callback of %s answered %d", receipt.MessageID, resp.StatusCode)
+		return
+	}
+	a.sim.Reported(receipt)
+}
+
+func (a *httpAPI) statistics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.sim.stats.Snapshot())
+}
+
+func writeStatus(w http.ResponseWriter, httpStatus int, code, description, messageID string) {
+	response := map[string]interface{}{
+		"status": map[string]string{"code": code, "description": description},
+	}
+	if messageID != "" {
+		response["data"] = map[string]string{"message_id": messageID}
+	}
+	writeJSON(w, httpStatus, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"myproject/smpp"
+)
+
+// statusResponse is the body answered by the send endpoint
+type statusResponse struct {
+	Status struct {
+		Code        string `json:"code"`
+		Description string `json:"description"`
+	} `json:"status"`
+	Data struct {
+		MessageID string `json:"message_id"`
+	} `json:"data"`
+}
+
+func TestHTTPSend(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         Config
+		contentType string
+		body        string
+		token       string
+		wantStatus  int
+		wantCode    string
+	}{
+		{"JSON", Config{}, "application/json", `{"msisdn":"8801712345678","sms":"hi"}`, "", http.StatusOK, codeSubmitted},
+		{"form", Config{}, "application/x-www-form-urlencoded", url.Values{"msisdn": {"8801712345678"}, "sms": {"hi"}}.Encode(), "", http.StatusOK, codeSubmitted},
+		{"token", Config{HTTPToken: "secret"}, "application/json", `{"msisdn":"8801712345678","sms":"hi"}`, "secret", http.StatusOK, codeSubmitted},
+		{"wrong token", Config{HTTPToken: "secret"}, "application/json", `{"msisdn":"8801712345678","sms":"hi"}`, "guess", http.StatusUnauthorized, codeRejected},
+		{"invalid JSON", Config{}, "application/json", `{"msisdn":`, "", http.StatusBadRequest, codeRejected},
+		{"missing text", Config{}, "application/json", `{"msisdn":"8801712345678"}`, "", http.StatusBadRequest, codeRejected},
+		{"throttled", Config{ThrottleRate: 1}, "application/json", `{"msisdn":"8801712345678","sms":"hi"}`, "", http.StatusTooManyRequests, codeThrottled},
+		{"temporary error", Config{ErrorRate: 1}, "application/json", `{"msisdn":"8801712345678","sms":"hi"}`, "", http.StatusServiceUnavailable, codeError},
+		{"rejected", Config{RejectRate: 1}, "application/json", `{"msisdn":"8801712345678","sms":"hi"}`, "", http.StatusBadRequest, codeRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(newHTTPHandler(NewSimulator(tt.cfg)))
+			defer server.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/send", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var got statusResponse
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus || got.Status.Code != tt.wantCode {
+				t.Errorf("send = %d %s, want %d %s", resp.StatusCode, got.Status.Code, tt.wantStatus, tt.wantCode)
+			}
+			if (got.Data.MessageID != "") != (tt.wantCode == codeSubmitted) {
+				t.Errorf("message_id = %q", got.Data.MessageID)
+			}
+		})
+	}
+}
+
+func TestHTTPReceiptCallback(t *testing.T) {
+	received := make(chan map[string]string, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var receipt map[string]string
+		json.Unmarshal(data, &receipt)
+		received <- receipt
+	}))
+	defer callback.Close()
+
+	sim := NewSimulator(Config{DLRURL: callback.URL})
+	server := httptest.NewServer(newHTTPHandler(sim))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/api/v1/send", "application/json", strings.NewReader(`{"msisdn":"8801712345678","sms":"hi","csms_id":"c-1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got statusResponse
+	json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+
+	select {
+	case receipt := <-received:
+		if receipt["message_id"] != got.Data.MessageID || receipt["csms_id"] != "c-1" || receipt["status"] != smpp.StateDelivered {
+			t.Errorf("receipt = %v, want message %s delivered", receipt, got.Data.MessageID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no receipt posted")
+	}
+	// The receipt is counted once the callback answered
+	deadline := time.Now().Add(time.Second)
+	for sim.stats.Delivered.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if delivered := sim.stats.Delivered.Load(); delivered != 1 {
+		t.Errorf("dlr_delivered = %d, want 1", delivered)
+	}
+}
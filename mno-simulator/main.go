@@ -0,0 +1,69 @@
+// Command mno-simulator stands in for an operator during development and load tests: it serves an HTTP
+// SMS API and an SMPP server with configurable latency, errors, throttling, TPS cap and delivery receipts.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file loaded: %v", err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	sim := NewSimulator(cfg)
+	log.Printf("Latency %s, TPS cap %g, throttle %g, error %g, reject %g; receipts after %s, undelivered %g, expired %g",
+		cfg.Latency, cfg.TPS, cfg.ThrottleRate, cfg.ErrorRate, cfg.RejectRate, cfg.DLRDelay, cfg.DLRFailRate, cfg.DLRExpireRate)
+
+	httpServer := &http.Server{Addr: cfg.HTTPAddr, Handler: newHTTPHandler(sim)}
+	go func() {
+		log.Printf("HTTP API listening on %s", cfg.HTTPAddr)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server failed: %v", err)
+		}
+	}()
+
+	listener, err := net.Listen("tcp", cfg.SMPPAddr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", cfg.SMPPAddr, err)
+	}
+	smppServer := newSMPPServer(sim)
+	go func() {
+		log.Printf("SMPP server listening on %s", cfg.SMPPAddr)
+		if err := smppServer.Serve(listener); err != nil {
+			log.Fatalf("SMPP server failed: %v", err)
+		}
+	}()
+
+	if cfg.StatsInterval > 0 {
+		go func() {
+			for range time.Tick(cfg.StatsInterval) {
+				log.Printf("Stats: %v", sim.stats.Snapshot())
+			}
+		}()
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down")
+
+	smppServer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	httpServer.Shutdown(ctx)
+	log.Printf("Stats: %v", sim.stats.Snapshot())
+}
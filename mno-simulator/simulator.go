@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"myproject/smpp"
+)
+
+// Outcome is the simulated answer to a submission
+type Outcome int
+
+const (
+	Accepted Outcome = iota
+	// Throttled submissions exceeded the TPS cap or drew the throttle rate
+	Throttled
+	// TemporaryError stands for an operator outage; the client should retry
+	TemporaryError
+	// Rejected stands for a permanent error such as an invalid number
+	Rejected
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Accepted:
+		return "accepted"
+	case Throttled:
+		return "throttled"
+	case TemporaryError:
+		return "error"
+	}
+	return "rejected"
+}
+
+// Simulator decides the outcome of submissions and the final state of accepted messages,
+// shared by the HTTP API and the SMPP server
+type Simulator struct {
+	cfg    Config
+	bucket *tokenBucket
+	nextID atomic.Uint64
+	stats  Stats
+}
+
+// Stats counts submissions by outcome and receipts by state
+type Stats struct {
+	Submitted    atomic.Int64
+	Accepted     atomic.Int64
+	Throttled    atomic.Int64
+	Errors       atomic.Int64
+	Rejected     atomic.Int64
+	Delivered    atomic.Int64
+	Undelivered  atomic.Int64
+	Expired      atomic.Int64
+	ReceiptRetry atomic.Int64
+}
+
+// Snapshot returns the counters as plain values
+func (s *Stats) Snapshot() map[string]int64 {
+	return map[string]int64{
+		"submitted":       s.Submitted.Load(),
+		"accepted":        s.Accepted.Load(),
+		"throttled":       s.Throttled.Load(),
+		"errors":          s.Errors.Load(),
+		"rejected":        s.Rejected.Load(),
+		"dlr_delivered":   s.Delivered.Load(),
+		"dlr_undelivered": s.Undelivered.Load(),
+		"dlr_expired":     s.Expired.Load(),
+		"dlr_retried":     s.ReceiptRetry.Load(),
+	}
+}
+
+func NewSimulator(cfg Config) *Simulator {
+	s := &Simulator{cfg: cfg}
+	if cfg.TPS > 0 {
+		s.bucket = newTokenBucket(cfg.TPS)
+	}
+	s.nextID.Store(uint64(time.Now().Unix()) << 20)
+	return s
+}
+
+// Submit waits for the simulated latency and decides the outcome of one submission
+func (s *Simulator) Submit() Outcome {
+	time.Sleep(s.cfg.Latency.Sample())
+	s.stats.Submitted.Add(1)
+
+	outcome := Accepted
+	if s.bucket != nil && !s.bucket.take() {
+		outcome = Throttled
+	} else {
+		r := rand.Float64()
+		switch {
+		case r < s.cfg.ThrottleRate:
+			outcome = Throttled
+		case r < s.cfg.ThrottleRate+s.cfg.ErrorRate:
+			outcome = TemporaryError
+		case r < s.cfg.ThrottleRate+s.cfg.ErrorRate+s.cfg.RejectRate:
+			outcome = Rejected
+		}
+	}
+
+	switch outcome {
+	case Accepted:
+		s.stats.Accepted.Add(1)
+	case Throttled:
+		s.stats.Throttled.Add(1)
+	case TemporaryError:
+		s.stats.Errors.Add(1)
+	case Rejected:
+		s.stats.Rejected.Add(1)
+	}
+	return outcome
+}
+
+// MessageID returns a new operator message ID
+func (s *Simulator) MessageID() string {
+	return fmt.Sprintf("%x", s.nextID.Add(1))
+}
+
+// Receipt draws the final state of an accepted message and the delay after which it is reported
+func (s *Simulator) Receipt(messageID, source, destination string, text []byte) (Receipt, time.Duration) {
+	r := Receipt{
+		MessageID:   messageID,
+		Source:      source,
+		Destination: destination,
+		State:       smpp.StateDelivered,
+		Err:         "000",
+		Text:        text,
+		Submitted:   time.Now(),
+	}
+	draw := rand.Float64()
+	switch {
+	case draw < s.cfg.DLRFailRate:
+		r.State, r.Err = smpp.StateUndeliverable, "001"
+	case draw < s.cfg.DLRFailRate+s.cfg.DLRExpireRate:
+		r.State, r.Err = smpp.StateExpired, "002"
+	}
+	return r, s.cfg.DLRDelay.Sample()
+}
+
+// Reported counts a receipt the client acknowledged
+func (s *Simulator) Reported(r Receipt) {
+	switch r.State {
+	case smpp.StateDelivered:
+		s.stats.Delivered.Add(1)
+	case smpp.StateUndeliverable:
+		s.stats.Undelivered.Add(1)
+	case smpp.StateExpired:
+		s.stats.Expired.Add(1)
+	}
+}
+
+// Receipt is the final state of an accepted message
+type Receipt struct {
+	MessageID   string
+	Source      string
+	Destination string
+	State       string
+	Err         string
+	Text        []byte
+	Submitted   time.Time
+}
+
+// receiptTimeLayout is the YYMMDDhhmm format of receipt dates
+const receiptTimeLayout = "0601021504"
+
+// ReceiptText formats the receipt as described in SMPP 3.4 appendix B
+func (r Receipt) ReceiptText() string {
+	text := r.Text
+	if len(text) > 20 {
+		text = text[:20]
+	}
+	delivered := 0
+	if r.State == smpp.StateDelivered {
+		delivered = 1
+	}
+	return fmt.Sprintf("id:%s sub:001 dlvrd:%03d submit date:%s done date:%s stat:%s err:%s text:%s",
+		r.MessageID, delivered, r.Submitted.Format(receiptTimeLayout), time.Now().Format(receiptTimeLayout),
+		r.State, r.Err, text)
+}
+
+// tokenBucket caps the accepted submissions per second, allowing a burst of one second
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(tps float64) *tokenBucket {
+	burst := max(tps, 1)
+	return &tokenBucket{rate: tps, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (b *tokenBucket) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
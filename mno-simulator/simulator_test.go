@@ -0,0 +1,166 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"myproject/smpp"
+)
+
+func TestParseDistribution(t *testing.T) {
+	tests := []struct {
+		spec     string
+		want     string
+		min, max time.Duration
+		wantErr  bool
+	}{
+		{spec: "50ms", want: "fixed:50ms", min: 50 * time.Millisecond, max: 50 * time.Millisecond},
+		{spec: "fixed:0s", want: "fixed:0s"},
+		{spec: "uniform:20ms-80ms", want: "uniform:20ms-80ms", min: 20 * time.Millisecond, max: 80 * time.Millisecond},
+		{spec: "uniform: 1s - 1s", want: "uniform:1s-1s", min: time.Second, max: time.Second},
+		{spec: "normal:100ms,30ms", want: "normal:100ms,30ms", max: time.Hour},
+		{spec: "exp:80ms", want: "exp:80ms", max: time.Hour},
+		{spec: "poisson:80ms", wantErr: true},
+		{spec: "uniform:20ms", wantErr: true},
+		{spec: "uniform:80ms-20ms", wantErr: true},
+		{spec: "normal:100ms", wantErr: true},
+		{spec: "fixed:-5ms", wantErr: true},
+		{spec: "fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			d, err := ParseDistribution(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDistribution() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if d.String() != tt.want {
+				t.Errorf("String() = %q, want %q", d, tt.want)
+			}
+			for i := 0; i < 100; i++ {
+				if sample := d.Sample(); sample < tt.min || sample > tt.max {
+					t.Fatalf("Sample() = %s, want between %s and %s", sample, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"defaults", nil, false},
+		{"rates", map[string]string{"SIM_TPS": "50", "SIM_THROTTLE_RATE": "0.2", "SIM_ERROR_RATE": "0.3", "SIM_REJECT_RATE": "0.5"}, false},
+		{"rate above 1", map[string]string{"SIM_ERROR_RATE": "1.5"}, true},
+		{"negative TPS", map[string]string{"SIM_TPS": "-1"}, true},
+		{"submission rates above 1", map[string]string{"SIM_THROTTLE_RATE": "0.6", "SIM_REJECT_RATE": "0.6"}, true},
+		{"receipt rates above 1", map[string]string{"SIM_DLR_FAIL_RATE": "0.6", "SIM_DLR_EXPIRE_RATE": "0.6"}, true},
+		{"invalid latency", map[string]string{"SIM_LATENCY": "slow"}, true},
+		{"invalid retry", map[string]string{"SIM_DLR_RETRY": "5"}, true},
+	}
+	keys := []string{"SIM_TPS", "SIM_THROTTLE_RATE", "SIM_ERROR_RATE", "SIM_REJECT_RATE", "SIM_DLR_FAIL_RATE",
+		"SIM_DLR_EXPIRE_RATE", "SIM_LATENCY", "SIM_DLR_DELAY", "SIM_DLR_RETRY", "SIM_STATS_INTERVAL"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range keys {
+				t.Setenv(key, tt.env[key])
+			}
+			if _, err := LoadConfig(); (err != nil) != tt.wantErr {
+				t.Errorf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want Outcome
+	}{
+		{"accepted", Config{}, Accepted},
+		{"throttle rate", Config{ThrottleRate: 1}, Throttled},
+		{"error rate", Config{ErrorRate: 1}, TemporaryError},
+		{"reject rate", Config{RejectRate: 1}, Rejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := NewSimulator(tt.cfg)
+			for i := 0; i < 10; i++ {
+				if got := sim.Submit(); got != tt.want {
+					t.Fatalf("Submit() = %s, want %s", got, tt.want)
+				}
+			}
+			if stats := sim.stats.Snapshot(); stats["submitted"] != 10 {
+				t.Errorf("submitted = %d, want 10", stats["submitted"])
+			}
+		})
+	}
+}
+
+func TestSubmitTPS(t *testing.T) {
+	sim := NewSimulator(Config{TPS: 5})
+	accepted := 0
+	for i := 0; i < 20; i++ {
+		if sim.Submit() == Accepted {
+			accepted++
+		}
+	}
+	// The bucket starts with a burst of one second
+	if accepted != 5 {
+		t.Errorf("accepted %d submissions at once, want 5", accepted)
+	}
+	if stats := sim.stats.Snapshot(); stats["throttled"] != 15 {
+		t.Errorf("throttled = %d, want 15", stats["throttled"])
+	}
+}
+
+func TestReceipt(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		wantState string
+		wantErr   string
+	}{
+		{"delivered", Config{}, smpp.StateDelivered, "000"},
+		{"undeliverable", Config{DLRFailRate: 1}, smpp.StateUndeliverable, "001"},
+		{"expired", Config{DLRExpireRate: 1}, smpp.StateExpired, "002"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := NewSimulator(tt.cfg)
+			r, _ := sim.Receipt("1a", "BRAND", "8801712345678", []byte("a message longer than twenty characters"))
+			if r.State != tt.wantState || r.Err != tt.wantErr {
+				t.Errorf("Receipt() = %s/%s, want %s/%s", r.State, r.Err, tt.wantState, tt.wantErr)
+			}
+
+			// The receipt text parses back the way the gateway reads it
+			m := smpp.Message{ESMClass: smpp.ESMReceipt, ShortMessage: []byte(r.ReceiptText())}
+			parsed, ok := m.Receipt()
+			if !ok || parsed.ID != "1a" || parsed.State != tt.wantState || parsed.Err != tt.wantErr || parsed.Text != "a message longer tha" {
+				t.Errorf("Receipt() of %q = %+v", r.ReceiptText(), parsed)
+			}
+			if delivered := strings.Contains(r.ReceiptText(), "dlvrd:001"); delivered != (tt.wantState == smpp.StateDelivered) {
+				t.Errorf("ReceiptText() = %q", r.ReceiptText())
+			}
+		})
+	}
+}
+
+func TestMessageID(t *testing.T) {
+	sim := NewSimulator(Config{})
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := sim.MessageID()
+		if seen[id] {
+			t.Fatalf("MessageID() returned %s twice", id)
+		}
+		seen[id] = true
+	}
+}
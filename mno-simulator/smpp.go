@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"myproject/smpp"
+)
+
+// serverSystemID is returned in bind responses
+const serverSystemID = "MNOSIM"
+
+// messageStates are the message_state option values of the final receipt states
+var messageStates = map[string]byte{
+	smpp.StateDelivered:     2,
+	smpp.StateExpired:       3,
+	smpp.StateUndeliverable: 5,
+}
+
+// smppServer is a minimal SMSC: it accepts binds, answers submit_sm with the simulated outcome and sends
+// the receipts of accepted messages as deliver_sm to a session of the same system_id that can receive
+type smppServer struct {
+	sim *Simulator
+
+	mu       sync.Mutex
+	listener net.Listener
+	sessions map[*smppSession]struct{}
+	// pending holds receipts by system_id while no session of that system_id can receive them
+	pending map[string][]Receipt
+}
+
+func newSMPPServer(sim *Simulator) *smppServer {
+	return &smppServer{
+		sim:      sim,
+		sessions: make(map[*smppSession]struct{}),
+		pending:  make(map[string][]Receipt),
+	}
+}
+
+// Serve accepts connections until Close
+func (s *smppServer) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		session := &smppSession{server: s, conn: conn, inflight: make(map[uint32]Receipt)}
+		s.mu.Lock()
+		s.sessions[session] = struct{}{}
+		s.mu.Unlock()
+		go session.serve()
+	}
+}
+
+// Close stops accepting connections and drops every session
+func (s *smppServer) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for session := range s.sessions {
+		session.conn.Close()
+	}
+}
+
+// deliver sends a receipt on the given session when it can still receive, otherwise on another session
+// of its system_id, or keeps it until one binds
+func (s *smppServer) deliver(preferred *smppSession, systemID string, r Receipt) {
+	s.mu.Lock()
+	target := preferred
+	if target != nil {
+		if _, ok := s.sessions[target]; !ok || !target.canReceive() {
+			target = nil
+		}
+	}
+	if target == nil {
+		for session := range s.sessions {
+			if session.canReceive() && session.systemID() == systemID {
+				target = session
+				break
+			}
+		}
+	}
+	if target == nil {
+		s.pending[systemID] = append(s.pending[systemID], r)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+	target.sendReceipt(r)
+}
+
+// bound sends the receipts kept for the system_id of a session that can receive
+func (s *smppServer) bound(session *smppSession) {
+	if !session.canReceive() {
+		return
+	}
+	s.mu.Lock()
+	receipts := s.pending[session.systemID()]
+	delete(s.pending, session.systemID())
+	s.mu.Unlock()
+	for _, r := range receipts {
+		session.sendReceipt(r)
+	}
+}
+
+// closed forgets a session and hands its unacknowledged receipts to the other sessions
+func (s *smppServer) closed(session *smppSession) {
+	s.mu.Lock()
+	delete(s.sessions, session)
+	s.mu.Unlock()
+
+	session.mu.Lock()
+	inflight := session.inflight
+	session.inflight = nil
+	session.mu.Unlock()
+	for _, r := range inflight {
+		s.deliver(nil, session.systemID(), r)
+	}
+}
+
+type smppSession struct {
+	server *smppServer
+	conn   net.Conn
+	writes sync.Mutex
+	seq    atomic.Uint32
+
+	mu       sync.Mutex
+	bind     smpp.CommandID
+	system   string
+	inflight map[uint32]Receipt
+}
+
+func (c *smppSession) systemID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.system
+}
+
+func (c *smppSession) canReceive() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bind == smpp.BindReceiver || c.bind == smpp.BindTransceiver
+}
+
+func (c *smppSession) canTransmit() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bind == smpp.BindTransmitter || c.bind == smpp.BindTransceiver
+}
+
+func (c *smppSession) write(p smpp.PDU) error {
+	c.writes.Lock()
+	defer c.writes.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(p.Marshal())
+	return err
+}
+
+func (c *smppSession) respond(req smpp.PDU, status smpp.Status, body []byte) {
+	if err := c.write(smpp.PDU{Command: req.Command.Response(), Status: status, Sequence: req.Sequence, Body: body}); err != nil {
+		log.Printf("SMPP %s: failed to answer %s: %v", c.conn.RemoteAddr(), req.Command, err)
+	}
+}
+
+func (c *smppSession) serve() {
+	defer c.server.closed(c)
+	defer c.conn.Close()
+
+	r := bufio.NewReader(c.conn)
+	for {
+		p, err := smpp.ReadPDU(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("SMPP %s: %v", c.conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		switch p.Command {
+		case smpp.BindTransmitter, smpp.BindReceiver, smpp.BindTransceiver:
+			c.handleBind(p)
+		case smpp.SubmitSM:
+			if !c.canTransmit() {
+				c.respond(p, smpp.StatusInvalidBind, nil)
+				continue
+			}
+			go c.handleSubmit(p)
+		case smpp.DeliverSMResp:
+			c.handleDeliverResp(p)
+		case smpp.EnquireLink:
+			c.respond(p, smpp.StatusOK, nil)
+		case smpp.Unbind:
+			c.respond(p, smpp.StatusOK, nil)
+			return
+		case smpp.EnquireLinkResp, smpp.UnbindResp, smpp.GenericNack:
+		default:
+			if !p.Command.IsResponse() {
+				c.write(smpp.PDU{Command: smpp.GenericNack, Status: smpp.StatusInvalidCmdID, Sequence: p.Sequence})
+			}
+		}
+	}
+}
+
+func (c *smppSession) handleBind(p smpp.PDU) {
+	c.mu.Lock()
+	alreadyBound := c.bind != 0
+	c.mu.Unlock()
+	if alreadyBound {
+		c.respond(p, smpp.StatusAlreadyBound, nil)
+		return
+	}
+
+	bind, err := smpp.UnmarshalBind(p.Body)
+	cfg := c.server.sim.cfg
+	switch {
+	case err != nil:
+		c.respond(p, smpp.StatusBindFailed, nil)
+		return
+	case cfg.SystemID != "" && bind.SystemID != cfg.SystemID:
+		c.respond(p, smpp.StatusInvalidSysID, nil)
+		return
+	case cfg.Password != "" && bind.Password != cfg.Password:
+		c.respond(p, smpp.StatusInvalidPasswd, nil)
+		return
+	}
+
+	c.mu.Lock()
+	c.bind = p.Command
+	c.system = bind.SystemID
+	c.mu.Unlock()
+	c.respond(p, smpp.StatusOK, smpp.MessageID(serverSystemID))
+	log.Printf("SMPP %s bound as %s (%s)", c.conn.RemoteAddr(), bind.SystemID, p.Command)
+	c.server.bound(c)
+}
+
+func (c *smppSession) handleSubmit(p smpp.PDU) {
+	m, err := smpp.UnmarshalMessage(p.Body)
+	if err != nil {
+		c.respond(p, smpp.StatusInvalidMsgLen, nil)
+		return
+	}
+
+	switch c.server.sim.Submit() {
+	case Throttled:
+		c.respond(p, smpp.StatusThrottled, nil)
+	case TemporaryError:
+		c.respond(p, smpp.StatusSystemError, nil)
+	case Rejected:
+		c.respond(p, smpp.StatusInvalidDstAddr, nil)
+	default:
+		messageID := c.server.sim.MessageID()
+		c.respond(p, smpp.StatusOK, smpp.MessageID(messageID))
+		if m.RegisteredDelivery&smpp.RegisteredDeliveryFinal == 0 {
+			return
+		}
+		// Only default alphabet text is quoted in the receipt
+		var text []byte
+		if m.DataCoding == smpp.CodingDefault && m.ESMClass&smpp.ESMUDHI == 0 {
+			text = m.Text()
+		}
+		receipt, delay := c.server.sim.Receipt(messageID, m.SourceAddr, m.DestAddr, text)
+		systemID := c.systemID()
+		time.AfterFunc(delay, func() { c.server.deliver(c, systemID, receipt) })
+	}
+}
+
+// sendReceipt sends a receipt as deliver_sm and keeps it until the client acknowledges it
+func (c *smppSession) sendReceipt(r Receipt) {
+	seq := c.seq.Add(1)
+	c.mu.Lock()
+	if c.inflight == nil {
+		// The session closed meanwhile
+		c.mu.Unlock()
+		c.server.deliver(nil, c.systemID(), r)
+		return
+	}
+	c.inflight[seq] = r
+	c.mu.Unlock()
+
+	m := smpp.Message{
+		SourceAddr: r.Destination,
+		DestAddr:   r.Source,
+		ESMClass:   smpp.ESMReceipt,
+		DataCoding: smpp.CodingDefault,
+		// Receipts are sent in the default alphabet, which coincides with ASCII for the receipt fields
+		ShortMessage: []byte(r.ReceiptText()),
+		Options: map[uint16][]byte{
+			smpp.TagReceiptedMessageID: append([]byte(r.MessageID), 0),
+			smpp.TagMessageState:       {messageStates[r.State]},
+		},
+	}
+	if err := c.write(smpp.PDU{Command: smpp.DeliverSM, Sequence: seq, Body: m.Marshal()}); err != nil {
+		// The read loop sees the broken connection and hands the receipt over
+		log.Printf("SMPP %s: failed to send receipt %s: %v", c.conn.RemoteAddr(), r.MessageID, err)
+		c.conn.Close()
+	}
+}
+
+// handleDeliverResp forgets an acknowledged receipt and resends a refused one after SIM_DLR_RETRY
+func (c *smppSession) handleDeliverResp(p smpp.PDU) {
+	c.mu.Lock()
+	r, ok := c.inflight[p.Sequence]
+	delete(c.inflight, p.Sequence)
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if p.Status == smpp.StatusOK {
+		c.server.sim.Reported(r)
+		return
+	}
+	log.Printf("SMPP %s refused receipt %s with %s, resending in %s", c.conn.RemoteAddr(), r.MessageID, p.Status, c.server.sim.cfg.DLRRetry)
+	c.server.sim.stats.ReceiptRetry.Add(1)
+	systemID := c.systemID()
+	time.AfterFunc(c.server.sim.cfg.DLRRetry, func() { c.server.deliver(c, systemID, r) })
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"myproject/smpp"
+)
+
+// startSMPP serves the simulator on a local port until the test ends
+func startSMPP(t *testing.T, sim *Simulator) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newSMPPServer(sim)
+	go server.Serve(l)
+	t.Cleanup(server.Close)
+	return l.Addr().String()
+}
+
+func TestSMPPBind(t *testing.T) {
+	addr := startSMPP(t, NewSimulator(Config{SystemID: "gateway", Password: "secret"}))
+	tests := []struct {
+		name string
+		bind smpp.Bind
+		want smpp.Status
+	}{
+		{"valid", smpp.Bind{SystemID: "gateway", Password: "secret"}, smpp.StatusOK},
+		{"wrong system_id", smpp.Bind{SystemID: "other", Password: "secret"}, smpp.StatusInvalidSysID},
+		{"wrong password", smpp.Bind{SystemID: "gateway", Password: "guess"}, smpp.StatusInvalidPasswd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			if _, err := conn.Write(smpp.PDU{Command: smpp.BindTransceiver, Sequence: 1, Body: tt.bind.Marshal()}.Marshal()); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := smpp.ReadPDU(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Command != smpp.BindTransceiverResp || resp.Status != tt.want {
+				t.Errorf("bind answered %s %s, want %s", resp.Command, resp.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestSMPPSubmitAndReceipt(t *testing.T) {
+	sim := NewSimulator(Config{DLRRetry: 50 * time.Millisecond})
+	addr := startSMPP(t, sim)
+
+	// The first receipt is refused, so the simulator must send it again
+	receipts := make(chan smpp.Receipt, 2)
+	var refused atomic.Bool
+	client := smpp.NewClient(smpp.Config{
+		Addr:     addr,
+		SystemID: "gateway",
+		OnDeliver: func(m smpp.Message) error {
+			receipt, ok := m.Receipt()
+			if !ok {
+				return nil
+			}
+			if refused.CompareAndSwap(false, true) {
+				return errors.New("not stored yet")
+			}
+			receipts <- receipt
+			return nil
+		},
+	})
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	messageID, err := client.Submit(ctx, smpp.Message{
+		SourceAddr:         "BRAND",
+		DestAddr:           "8801712345678",
+		RegisteredDelivery: smpp.RegisteredDeliveryFinal,
+		ShortMessage:       []byte("hello"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case receipt := <-receipts:
+		if receipt.ID != messageID || receipt.State != smpp.StateDelivered || receipt.Text != "hello" {
+			t.Errorf("receipt = %+v, want message %s delivered", receipt, messageID)
+		}
+	case <-ctx.Done():
+		t.Fatal("no receipt delivered")
+	}
+	if retried := sim.stats.ReceiptRetry.Load(); retried != 1 {
+		t.Errorf("dlr_retried = %d, want 1", retried)
+	}
+}
+
+func TestSMPPSubmitErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want smpp.Status
+	}{
+		{"throttled", Config{ThrottleRate: 1}, smpp.StatusThrottled},
+		{"temporary error", Config{ErrorRate: 1}, smpp.StatusSystemError},
+		{"rejected", Config{RejectRate: 1}, smpp.StatusInvalidDstAddr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := smpp.NewClient(smpp.Config{Addr: startSMPP(t, NewSimulator(tt.cfg)), SystemID: "gateway"})
+			defer client.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err := client.Submit(ctx, smpp.Message{DestAddr: "8801712345678", ShortMessage: []byte("hello")})
+			var statusErr *smpp.StatusError
+			if !errors.As(err, &statusErr) || statusErr.Status != tt.want {
+				t.Errorf("Submit() error = %v, want status %s", err, tt.want)
+			}
+		})
+	}
+}
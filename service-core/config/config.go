@@ -1,10 +1,17 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+
+	"myproject/msgid"
 )
 
 type Config struct {
@@ -21,6 +28,19 @@ type Config struct {
 	InfluxDBToken  string
 	InfluxDBOrg    string
 	InfluxDBBucket string
+
+	// NodeID is NODE_ID, -1 when it is not set or invalid
+	NodeID int
+	// NodeIDFromHostname derives the node ID from the StatefulSet pod ordinal in HOSTNAME when NODE_ID is not set
+	NodeIDFromHostname bool
+	// Replicas is how many instances of the gateway run, each needing its own node ID
+	Replicas        int
+	SMSBatchMaxSize int
+	IdempotencyTTL  time.Duration
+	DNDMessageTypes []string
+
+	RabbitMQPoolConnections int
+	RabbitMQPoolChannels    int
 }
 
 func LoadEnv() {
@@ -44,12 +64,84 @@ func GetConfig() *Config {
 		InfluxDBToken:  getEnv("INFLUXDB_TOKEN", "your_token"),
 		InfluxDBOrg:    getEnv("INFLUXDB_ORG", "your_org"),
 		InfluxDBBucket: getEnv("INFLUXDB_BUCKET", "your_bucket"),
+
+		NodeID:             getEnvInt("NODE_ID", -1),
+		NodeIDFromHostname: getEnv("NODE_ID_FROM_HOSTNAME", "false") == "true",
+
+		Replicas:        getEnvInt("REPLICAS", 1),
+		SMSBatchMaxSize: getEnvInt("SMS_BATCH_MAX_SIZE", 1000),
+		IdempotencyTTL:  getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		DNDMessageTypes: getEnvList("DND_MESSAGE_TYPES", "promotional,marketing"),
+
+		RabbitMQPoolConnections: getEnvInt("RABBITMQ_POOL_CONNECTIONS", 2),
+		RabbitMQPoolChannels:    getEnvInt("RABBITMQ_POOL_CHANNELS", 8),
 	}
 }
 
+// podOrdinal matches the ordinal at the end of a StatefulSet pod name, e.g. sms-gateway-2
+var podOrdinal = regexp.MustCompile(`-(\d+)$`)
+
+// ResolveNodeID returns the message ID node of this instance: NODE_ID, else the ordinal of the StatefulSet
+// pod named by HOSTNAME when NodeIDFromHostname is set, else 0 when a single replica runs. Replicas sharing
+// a node ID would issue the same IDs.
+func (c *Config) ResolveNodeID() (int, error) {
+	if raw := os.Getenv("NODE_ID"); raw != "" {
+		if c.NodeID < 0 || c.NodeID > msgid.MaxNodeID {
+			return 0, fmt.Errorf("NODE_ID must be between 0 and %d, got %q", msgid.MaxNodeID, raw)
+		}
+		return c.NodeID, nil
+	}
+	if c.NodeIDFromHostname {
+		hostname := os.Getenv("HOSTNAME")
+		match := podOrdinal.FindStringSubmatch(hostname)
+		if match == nil {
+			return 0, fmt.Errorf("NODE_ID_FROM_HOSTNAME is set but HOSTNAME %q is not a StatefulSet pod name", hostname)
+		}
+		ordinal, err := strconv.Atoi(match[1])
+		if err != nil || ordinal > msgid.MaxNodeID {
+			return 0, fmt.Errorf("StatefulSet ordinal of HOSTNAME %q is above the highest node ID %d, set NODE_ID", hostname, msgid.MaxNodeID)
+		}
+		return ordinal, nil
+	}
+	if c.Replicas > 1 {
+		return 0, fmt.Errorf("NODE_ID or NODE_ID_FROM_HOSTNAME is required with %d replicas", c.Replicas)
+	}
+	return 0, nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid integer for %s: %q, using default %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid duration for %s: %q, using default %s", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvList(key, defaultValue string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
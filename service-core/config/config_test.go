@@ -0,0 +1,50 @@
+package config
+
+import "testing"
+
+func TestResolveNodeID(t *testing.T) {
+	tests := []struct {
+		name         string
+		nodeID       string
+		fromHostname bool
+		hostname     string
+		replicas     int
+		want         int
+		wantErr      bool
+	}{
+		{"single replica", "", false, "sms-gateway-7d9f8c6b5-x2k4p", 1, 0, false},
+		{"NODE_ID", "12", false, "", 3, 12, false},
+		{"NODE_ID wins over HOSTNAME", "5", true, "sms-gateway-2", 3, 5, false},
+		{"NODE_ID above range", "1024", false, "", 1, 0, true},
+		{"NODE_ID negative", "-3", false, "", 1, 0, true},
+		{"NODE_ID not a number", "one", false, "", 1, 0, true},
+		{"hostname ignored unless enabled", "", false, "sms-gateway-2", 1, 0, false},
+		{"deployment pod ignored", "", false, "sms-gateway-58473", 3, 0, true},
+		{"StatefulSet ordinal", "", true, "sms-gateway-2", 3, 2, false},
+		{"ordinal above range", "", true, "sms-gateway-58473", 3, 0, true},
+		{"no ordinal", "", true, "gateway", 3, 0, true},
+		{"replicas without node", "", false, "", 2, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NODE_ID", tt.nodeID)
+			t.Setenv("HOSTNAME", tt.hostname)
+			fromHostname := "false"
+			if tt.fromHostname {
+				fromHostname = "true"
+			}
+			t.Setenv("NODE_ID_FROM_HOSTNAME", fromHostname)
+			t.Setenv("REPLICAS", "1")
+			cfg := GetConfig()
+			cfg.Replicas = tt.replicas
+
+			got, err := cfg.ResolveNodeID()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveNodeID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ResolveNodeID() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"myproject/rabbitmq"
+)
+
+// Defaults applied to zero Config fields.
+const (
+	DefaultPrefetch       = 500
+	DefaultWorkers        = 200
+	DefaultHeartbeat      = 5 * time.Second
+	DefaultReconnectDelay = 5 * time.Second
+	DefaultStatsInterval  = 5 * time.Second
+	DefaultInfluxBatch    = 5000
+	DefaultInfluxFlush    = 100 * time.Millisecond
+	DefaultTierRefresh    = 10 * time.Second
+)
+
+// Config describes what a consumer consumes and how.
+type Config struct {
+	// InstanceID identifies this consumer in consumer tags, status points and logs.
+	InstanceID string
+	// URLs are the RabbitMQ nodes, tried in turn on every (re)connect.
+	URLs []string
+	// Queues are declared from Topology and consumed each on its own channel, sharing the workers equally.
+	Queues []string
+	// Tiers consume their queues with priority instead, see Tier. TierSource, when set, is asked for the
+	// tiers on every connect and every TierRefresh, so weights follow MsgPriority without a restart.
+	Tiers              []Tier
+	TierSource         func(ctx context.Context) ([]Tier, error)
+	TierRefresh        time.Duration
+	StarvationInterval time.Duration
+	Topology           rabbitmq.Topology
+	// Prefetch is the QoS prefetch count of each queue's channel, Workers the number of concurrent handlers.
+	Prefetch       int
+	Workers        int
+	Heartbeat      time.Duration
+	ReconnectDelay time.Duration
+	StatsInterval  time.Duration
+	Influx         InfluxConfig
+	// Declare runs after the topology on every connection, for queues the handler publishes to.
+	Declare func(ch *amqp.Channel) error
+}
+
+// InfluxConfig configures the batched status writer. Status points are discarded when URL is empty.
+type InfluxConfig struct {
+	URL           string
+	Token         string
+	Org           string
+	Bucket        string
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// ConfigFromEnv builds a Config for the queues from the environment: INSTANCE_ID (defaults to the host name),
+// RABBITMQ_URLS, RABBITMQ_TOPOLOGY_FILE, CONSUMER_PREFETCH, CONSUMER_WORKERS and the INFLUXDB_* settings.
+func ConfigFromEnv(queues ...string) (Config, error) {
+	cfg := Config{Queues: queues}
+
+	cfg.InstanceID = os.Getenv("INSTANCE_ID")
+	if cfg.InstanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return cfg, errors.New("INSTANCE_ID must be set")
+		}
+		cfg.InstanceID = hostname
+	}
+
+	for _, url := range strings.Split(os.Getenv("RABBITMQ_URLS"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			cfg.URLs = append(cfg.URLs, url)
+		}
+	}
+	if len(cfg.URLs) == 0 {
+		return cfg, errors.New("RABBITMQ_URLS must be set with at least one URL")
+	}
+
+	topology, err := rabbitmq.LoadTopology(os.Getenv("RABBITMQ_TOPOLOGY_FILE"))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid RabbitMQ topology: %v", err)
+	}
+	cfg.Topology = topology
+
+	if cfg.Prefetch, err = envInt("CONSUMER_PREFETCH"); err != nil {
+		return cfg, err
+	}
+	if cfg.Workers, err = envInt("CONSUMER_WORKERS"); err != nil {
+		return cfg, err
+	}
+
+	cfg.Influx = InfluxConfig{
+		URL:    os.Getenv("INFLUXDB_URL"),
+		Token:  os.Getenv("INFLUXDB_TOKEN"),
+		Org:    os.Getenv("INFLUXDB_ORG"),
+		Bucket: os.Getenv("INFLUXDB_BUCKET"),
+	}
+	if cfg.Influx.URL != "" && (cfg.Influx.Token == "" || cfg.Influx.Org == "" || cfg.Influx.Bucket == "") {
+		return cfg, errors.New("INFLUXDB_TOKEN, INFLUXDB_ORG, and INFLUXDB_BUCKET must be set with INFLUXDB_URL")
+	}
+
+	return cfg, nil
+}
+
+func (c Config) withDefaults() Config {
+	if c.Prefetch <= 0 {
+		c.Prefetch = DefaultPrefetch
+	}
+	if c.Workers <= 0 {
+		c.Workers = DefaultWorkers
+	}
+	if c.Heartbeat <= 0 {
+		c.Heartbeat = DefaultHeartbeat
+	}
+	if c.ReconnectDelay <= 0 {
+		c.ReconnectDelay = DefaultReconnectDelay
+	}
+	if c.StatsInterval <= 0 {
+		c.StatsInterval = DefaultStatsInterval
+	}
+	if c.TierRefresh <= 0 {
+		c.TierRefresh = DefaultTierRefresh
+	}
+	if c.StarvationInterval <= 0 {
+		c.StarvationInterval = DefaultStarvationInterval
+	}
+	if c.Influx.BatchSize <= 0 {
+		c.Influx.BatchSize = DefaultInfluxBatch
+	}
+	if c.Influx.FlushInterval <= 0 {
+		c.Influx.FlushInterval = DefaultInfluxFlush
+	}
+	return c
+}
+
+func envInt(key string) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", key, value)
+	}
+	return parsed, nil
+}
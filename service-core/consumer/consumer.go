@@ -0,0 +1,431 @@
+// Package consumer runs RabbitMQ consumers for the SMS queues. It manages the connection lifecycle,
+// prefetch, the worker pool, ack/retry/park semantics, batched status writes and metrics, so a consumer
+// for a new MNO or message type only implements a Handler.
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"myproject/rabbitmq"
+)
+
+// Consumer consumes the configured queues and hands every delivery to its Handler.
+type Consumer struct {
+	cfg     Config
+	handler Handler
+	status  *StatusWriter
+	metrics *Metrics
+	nextURL int
+}
+
+type job struct {
+	queue    string
+	channel  *amqp.Channel
+	delivery amqp.Delivery
+	received time.Time
+}
+
+// New creates a consumer for the handler. Zero Config fields get their defaults.
+func New(cfg Config, handler Handler) (*Consumer, error) {
+	if handler == nil {
+		return nil, errors.New("consumer handler is required")
+	}
+	if len(cfg.URLs) == 0 {
+		return nil, errors.New("at least one RabbitMQ URL is required")
+	}
+	if len(cfg.Queues) == 0 && len(cfg.Tiers) == 0 && cfg.TierSource == nil {
+		return nil, errors.New("at least one queue is required")
+	}
+	if err := cfg.Topology.Validate(); err != nil {
+		return nil, err
+	}
+
+	cfg = cfg.withDefaults()
+	return &Consumer{
+		cfg:     cfg,
+		handler: handler,
+		status:  NewStatusWriter(cfg.Influx, cfg.InstanceID),
+		metrics: NewMetrics(),
+	}, nil
+}
+
+// Metrics returns the counters of the consumer.
+func (c *Consumer) Metrics() *Metrics {
+	return c.metrics
+}
+
+// Status returns the status writer of the consumer, nil when InfluxDB is not configured.
+func (c *Consumer) Status() *StatusWriter {
+	return c.status
+}
+
+// Run consumes until ctx is cancelled, reconnecting whenever the connection or channel closes.
+// It returns an error when the first connection cannot be set up, for example because a queue
+// exists with arguments that differ from the topology.
+func (c *Consumer) Run(ctx context.Context) error {
+	go c.logStats(ctx)
+
+	started := false
+	for {
+		err := c.session(ctx, &started)
+		if ctx.Err() != nil {
+			log.Printf("[%s] Consumer stopped", c.cfg.InstanceID)
+			return nil
+		}
+		if !started {
+			return err
+		}
+
+		log.Printf("[%s] Consumer session ended: %v, reconnecting in %v", c.cfg.InstanceID, err, c.cfg.ReconnectDelay)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.cfg.ReconnectDelay):
+		}
+	}
+}
+
+// Close flushes the pending status points.
+func (c *Consumer) Close() {
+	c.status.Close()
+}
+
+// session connects, declares, consumes and processes deliveries until ctx is cancelled or the connection
+// is lost. In-flight handlers finish before it returns; deliveries still waiting for a worker are requeued.
+func (c *Consumer) session(ctx context.Context, started *bool) error {
+	tiers := sortTiers(c.tiers(ctx))
+	if len(tiers) == 0 {
+		return errors.New("no queues to consume")
+	}
+	queues := make([]string, 0, len(tiers))
+	for _, tier := range tiers {
+		queues = append(queues, tier.Queue)
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := rabbitmq.CheckBrokerVersion(conn); err != nil {
+		return err
+	}
+
+	// A failed declaration closes its channel, so declare on one of its own
+	declareCh, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("channel creation failed: %v", err)
+	}
+	if err := c.declare(declareCh, queues); err != nil {
+		return err
+	}
+	declareCh.Close()
+
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := make(chan *amqp.Error, len(tiers))
+
+	// Every queue has its own channel and prefetch, so a backlog on one tier never holds back
+	// the deliveries of another
+	channels := make(map[string]*amqp.Channel, len(tiers))
+	sources := make(map[string]<-chan amqp.Delivery, len(tiers))
+	for _, queue := range queues {
+		ch, err := conn.Channel()
+		if err != nil {
+			return fmt.Errorf("channel creation failed: %v", err)
+		}
+		if err := ch.Qos(c.cfg.Prefetch, 0, false); err != nil {
+			return fmt.Errorf("qos failed: %v", err)
+		}
+		// Postponed, retried and parked messages are republished on the channel they came from, and acked
+		// only once the broker confirmed the copy
+		if err := ch.Confirm(false); err != nil {
+			return fmt.Errorf("confirm mode failed: %v", err)
+		}
+		go func(closed chan *amqp.Error) {
+			if err, ok := <-closed; ok {
+				chClosed <- err
+			}
+		}(ch.NotifyClose(make(chan *amqp.Error, 1)))
+
+		deliveries, err := ch.Consume(queue, c.consumerTag(queue), false, false, false, false, nil)
+		if err != nil {
+			return fmt.Errorf("failed to consume %s: %v", queue, err)
+		}
+		channels[queue] = ch
+		sources[queue] = deliveries
+	}
+	*started = true
+	log.Printf("[%s] Consuming %s with %d workers, prefetch %d", c.cfg.InstanceID, describeTiers(tiers), c.cfg.Workers, c.cfg.Prefetch)
+
+	sched := newScheduler(tiers, c.cfg.StarvationInterval)
+
+	// Forwarders end when their delivery channel closes, on cancel or when the connection is lost
+	var forwarders sync.WaitGroup
+	for queue, deliveries := range sources {
+		forwarders.Add(1)
+		go func(queue string, ch *amqp.Channel, deliveries <-chan amqp.Delivery) {
+			defer forwarders.Done()
+			for delivery := range deliveries {
+				sched.push(job{queue: queue, channel: ch, delivery: delivery, received: time.Now()})
+			}
+		}(queue, channels[queue], deliveries)
+	}
+
+	done := make(chan struct{})
+	idle := make(chan struct{}, c.cfg.Workers)
+	jobs := make(chan job)
+	go sched.dispatch(done, idle, jobs)
+
+	var workers sync.WaitGroup
+	for i := 0; i < c.cfg.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				idle <- struct{}{}
+				j, ok := <-jobs
+				if !ok {
+					return
+				}
+				if ctx.Err() != nil {
+					c.requeue(j)
+					continue
+				}
+				// A handler that started finishes and settles its delivery even when shutdown begins meanwhile
+				c.process(context.WithoutCancel(ctx), j)
+			}
+		}()
+	}
+
+	if c.cfg.TierSource != nil {
+		go c.refreshTiers(ctx, done, sched)
+	}
+
+	var sessionErr error
+	select {
+	case <-ctx.Done():
+		for queue, ch := range channels {
+			ch.Cancel(c.consumerTag(queue), false)
+		}
+	case err := <-connClosed:
+		sessionErr = fmt.Errorf("connection closed: %v", err)
+	case err := <-chClosed:
+		sessionErr = fmt.Errorf("channel closed: %v", err)
+		// Delivery channels only close with the connection, so close it to stop the forwarders
+		conn.Close()
+	}
+
+	forwarders.Wait()
+	close(done)
+	workers.Wait()
+	return sessionErr
+}
+
+// tiers returns the tiers to consume: those of TierSource when it has any, else Tiers,
+// else the configured queues with equal weights.
+func (c *Consumer) tiers(ctx context.Context) []Tier {
+	if c.cfg.TierSource != nil {
+		tiers, err := c.cfg.TierSource(ctx)
+		if err != nil {
+			log.Printf("[%s] Failed to load priority tiers: %v", c.cfg.InstanceID, err)
+		} else if len(tiers) > 0 {
+			return tiers
+		}
+	}
+	if len(c.cfg.Tiers) > 0 {
+		return c.cfg.Tiers
+	}
+	tiers := make([]Tier, 0, len(c.cfg.Queues))
+	for _, queue := range c.cfg.Queues {
+		tiers = append(tiers, Tier{Queue: queue, Weight: 1})
+	}
+	return tiers
+}
+
+// refreshTiers applies weight changes from TierSource until done is closed. Queues added or removed
+// in the source are picked up on the next connect.
+func (c *Consumer) refreshTiers(ctx context.Context, done <-chan struct{}, sched *scheduler) {
+	ticker := time.NewTicker(c.cfg.TierRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			tiers, err := c.cfg.TierSource(ctx)
+			if err != nil {
+				log.Printf("[%s] Failed to refresh priority tiers: %v", c.cfg.InstanceID, err)
+				continue
+			}
+			sched.setWeights(tiers)
+		}
+	}
+}
+
+func describeTiers(tiers []Tier) string {
+	parts := make([]string, 0, len(tiers))
+	for _, tier := range tiers {
+		parts = append(parts, fmt.Sprintf("%s (level %d, weight %d)", tier.Queue, tier.Level, tier.Weight))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// dial connects to the first reachable node, starting after the node used last time.
+func (c *Consumer) dial() (*amqp.Connection, error) {
+	for i := range c.cfg.URLs {
+		url := c.cfg.URLs[(c.nextURL+i)%len(c.cfg.URLs)]
+		conn, err := amqp.DialConfig(url, amqp.Config{Heartbeat: c.cfg.Heartbeat})
+		if err == nil {
+			c.nextURL = (c.nextURL + i + 1) % len(c.cfg.URLs)
+			log.Printf("Connected to RabbitMQ at %s", url)
+			return conn, nil
+		}
+		log.Printf("Failed to connect to %s: %v", url, err)
+	}
+	return nil, errors.New("failed to connect to any RabbitMQ node")
+}
+
+// declare reconciles the topology and the consumed queues, failing when they exist with other arguments.
+func (c *Consumer) declare(ch *amqp.Channel, queues []string) error {
+	if err := c.cfg.Topology.Declare(ch); err != nil {
+		return err
+	}
+	for _, queue := range queues {
+		if err := c.cfg.Topology.DeclareQueue(ch, queue); err != nil {
+			return err
+		}
+	}
+	if c.cfg.Declare != nil {
+		return c.cfg.Declare(ch)
+	}
+	return nil
+}
+
+func (c *Consumer) consumerTag(queue string) string {
+	return fmt.Sprintf("sms-consumer-%s-%s", c.cfg.InstanceID, queue)
+}
+
+// process runs the handler on one delivery and settles it according to the result.
+func (c *Consumer) process(ctx context.Context, j job) {
+	d := &Delivery{
+		Delivery: j.delivery,
+		Queue:    j.queue,
+		Channel:  j.channel,
+		Status:   c.status,
+		Metrics:  c.metrics,
+	}
+	c.settle(ctx, d, c.handle(ctx, d))
+}
+
+// requeue returns a delivery that was not handed to the handler before shutdown to its queue, so
+// stopping a consumer does not use up a retry of every prefetched message.
+func (c *Consumer) requeue(j job) {
+	if err := j.delivery.Nack(false, true); err != nil {
+		log.Printf("Failed to requeue message %s: %v", j.delivery.MessageId, err)
+		c.metrics.Inc(MetricErrors)
+		return
+	}
+	c.metrics.Inc(MetricRequeued)
+}
+
+// handle calls the handler, retrying the delivery when the handler panics.
+func (c *Consumer) handle(ctx context.Context, d *Delivery) (result Result) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("Handler panicked on message %s from %s: %v", d.MessageId, d.Queue, recovered)
+			result = RetryLater(fmt.Sprintf("handler panic: %v", recovered))
+		}
+	}()
+	return c.handler.Handle(ctx, d)
+}
+
+// settle acks, requeues, postpones, retries or parks a delivery. Postponed, retried and parked messages
+// are acked only after they were republished, and requeued when that fails.
+func (c *Consumer) settle(ctx context.Context, d *Delivery, result Result) {
+	switch result.Action {
+	case Ack:
+		if err := d.Ack(false); err != nil {
+			log.Printf("Failed to ack message %s: %v", d.MessageId, err)
+			c.metrics.Inc(MetricErrors)
+			return
+		}
+		c.metrics.Inc(MetricAcked)
+
+	case Requeue:
+		if err := d.Nack(false, true); err != nil {
+			log.Printf("Failed to requeue message %s: %v", d.MessageId, err)
+			c.metrics.Inc(MetricErrors)
+			return
+		}
+		c.metrics.Inc(MetricRequeued)
+
+	case Postpone:
+		delay, err := c.cfg.Topology.Delay(d.Channel, d.Queue, d.Delivery, result.Delay)
+		if err != nil {
+			log.Printf("Failed to postpone message %s: %v", d.MessageId, err)
+			c.metrics.Inc(MetricErrors)
+			d.Nack(false, true)
+			return
+		}
+		log.Printf("Postponed message %s from %s by %v: %s", d.MessageId, d.Queue, delay, result.Reason)
+		c.metrics.Inc(MetricDelayed)
+		if err := d.Ack(false); err != nil {
+			log.Printf("Failed to ack message %s: %v", d.MessageId, err)
+			c.metrics.Inc(MetricErrors)
+		}
+
+	case Retry, Park:
+		var outcome rabbitmq.RetryOutcome
+		var err error
+		if result.Action == Retry {
+			outcome, err = c.cfg.Topology.Retry(d.Channel, d.Queue, d.Delivery, result.Reason)
+		} else {
+			outcome = rabbitmq.RetryOutcome{RetryCount: d.RetryCount(), Parked: true}
+			err = c.cfg.Topology.Park(d.Channel, d.Queue, d.Delivery, result.Reason)
+		}
+		if err != nil {
+			log.Printf("Failed to %s message %s: %v", result.Action, d.MessageId, err)
+			c.metrics.Inc(MetricErrors)
+			d.Nack(false, true)
+			return
+		}
+
+		if outcome.Parked {
+			c.metrics.Inc(MetricParked)
+		} else {
+			c.metrics.Inc(MetricRetried)
+		}
+		if failureHandler, ok := c.handler.(FailureHandler); ok {
+			failureHandler.Failed(ctx, d, outcome, result.Reason)
+		}
+		if err := d.Ack(false); err != nil {
+			log.Printf("Failed to ack message %s: %v", d.MessageId, err)
+			c.metrics.Inc(MetricErrors)
+		}
+
+	default:
+		log.Printf("Unknown action %d for message %s, requeueing", result.Action, d.MessageId)
+		d.Nack(false, true)
+	}
+}
+
+func (c *Consumer) logStats(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.StatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			log.Printf("[%s] Stats - %s", c.cfg.InstanceID, c.metrics)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"myproject/rabbitmq"
+)
+
+// Action is what the consumer does with a delivery once its handler returns.
+type Action int
+
+const (
+	// Ack acknowledges a delivery that was processed.
+	Ack Action = iota
+	// Retry schedules the delivery on the next retry tier of its queue, or parks it once it ran out of retries.
+	Retry
+	// Park moves a delivery that cannot succeed on retry straight to the dead-letter queue.
+	Park
+	// Requeue returns the delivery to its queue for immediate redelivery.
+	Requeue
+	// Postpone redelivers the delivery after a delay without counting a retry, e.g. when a rate limit is reached.
+	Postpone
+)
+
+func (a Action) String() string {
+	switch a {
+	case Ack:
+		return "ack"
+	case Retry:
+		return "retry"
+	case Park:
+		return "park"
+	case Requeue:
+		return "requeue"
+	case Postpone:
+		return "postpone"
+	}
+	return "unknown"
+}
+
+// Result is returned by a Handler for every delivery.
+type Result struct {
+	Action Action
+	// Reason explains a retry or park and is recorded in the message headers.
+	Reason string
+	// Delay is how long a postponed delivery should wait at least.
+	Delay time.Duration
+}
+
+// Done acknowledges the delivery.
+func Done() Result {
+	return Result{Action: Ack}
+}
+
+// RetryLater schedules the delivery for a delayed retry.
+func RetryLater(reason string) Result {
+	return Result{Action: Retry, Reason: reason}
+}
+
+// Discard parks the delivery in the dead-letter queue without further retries.
+func Discard(reason string) Result {
+	return Result{Action: Park, Reason: reason}
+}
+
+// Redeliver requeues the delivery for immediate redelivery.
+func Redeliver() Result {
+	return Result{Action: Requeue}
+}
+
+// Later redelivers the delivery after at least delay without using up its retries.
+func Later(reason string, delay time.Duration) Result {
+	return Result{Action: Postpone, Reason: reason, Delay: delay}
+}
+
+// Delivery is a message handed to a Handler together with the resources of the consumer processing it.
+type Delivery struct {
+	amqp.Delivery
+	// Queue is the queue the message was consumed from.
+	Queue string
+	// Channel is the confirm-mode channel the message was consumed on; it may be used to publish follow-up messages.
+	Channel *amqp.Channel
+	// Status writes batched status points to InfluxDB.
+	Status *StatusWriter
+	// Metrics holds the counters logged by the consumer.
+	Metrics *Metrics
+}
+
+// RetryCount returns the number of retries the message already had.
+func (d *Delivery) RetryCount() int {
+	return rabbitmq.RetryCount(d.Headers)
+}
+
+// Handler processes the messages of a consumer. Handle is called concurrently from the worker pool.
+type Handler interface {
+	Handle(ctx context.Context, d *Delivery) Result
+}
+
+// HandlerFunc adapts a function to the Handler interface.
+type HandlerFunc func(ctx context.Context, d *Delivery) Result
+
+// Handle calls f.
+func (f HandlerFunc) Handle(ctx context.Context, d *Delivery) Result {
+	return f(ctx, d)
+}
+
+// FailureHandler is implemented by handlers that record retried and parked messages,
+// for example to write a status or send a delivery receipt. Failed is called after
+// the message was scheduled for retry or parked, before it is acked.
+type FailureHandler interface {
+	Failed(ctx context.Context, d *Delivery, outcome rabbitmq.RetryOutcome, reason string)
+}
@@ -0,0 +1,88 @@
+package consumer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counters maintained by the consumer itself.
+const (
+	MetricAcked    = "acked"
+	MetricRetried  = "retried"
+	MetricParked   = "parked"
+	MetricRequeued = "requeued"
+	MetricDelayed  = "delayed"
+	MetricErrors   = "errors"
+)
+
+// Metrics is a set of named counters safe for concurrent use.
+type Metrics struct {
+	mu       sync.RWMutex
+	counters map[string]*uint64
+}
+
+// NewMetrics creates an empty set of counters.
+func NewMetrics() *Metrics {
+	return &Metrics{counters: make(map[string]*uint64)}
+}
+
+// Inc increments the named counter.
+func (m *Metrics) Inc(name string) {
+	m.Add(name, 1)
+}
+
+// Add adds delta to the named counter, creating it on first use.
+func (m *Metrics) Add(name string, delta uint64) {
+	m.mu.RLock()
+	counter, ok := m.counters[name]
+	m.mu.RUnlock()
+	if !ok {
+		m.mu.Lock()
+		if counter, ok = m.counters[name]; !ok {
+			counter = new(uint64)
+			m.counters[name] = counter
+		}
+		m.mu.Unlock()
+	}
+	atomic.AddUint64(counter, delta)
+}
+
+// Get returns the value of the named counter.
+func (m *Metrics) Get(name string) uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if counter, ok := m.counters[name]; ok {
+		return atomic.LoadUint64(counter)
+	}
+	return 0
+}
+
+// Snapshot returns the current value of every counter.
+func (m *Metrics) Snapshot() map[string]uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	snapshot := make(map[string]uint64, len(m.counters))
+	for name, counter := range m.counters {
+		snapshot[name] = atomic.LoadUint64(counter)
+	}
+	return snapshot
+}
+
+// String formats the counters sorted by name, e.g. "acked: 10, parked: 1".
+func (m *Metrics) String() string {
+	snapshot := m.Snapshot()
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %d", name, snapshot[name]))
+	}
+	return strings.Join(parts, ", ")
+}
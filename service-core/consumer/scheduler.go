@@ -0,0 +1,206 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TiersKey is the Redis key holding the priority tiers published by the gateway from MsgPriority
+const TiersKey = "consumer:tiers"
+
+// DefaultStarvationInterval is the longest a waiting tier goes without being served.
+const DefaultStarvationInterval = 1 * time.Second
+
+// Tier is a queue consumed with priority. Lower levels are more urgent.
+type Tier struct {
+	Queue string `json:"queue"`
+	Level int    `json:"priority_level"`
+	// Weight is the tier's share of the workers while several tiers have waiting messages, 0 for DefaultWeight(Level).
+	Weight int `json:"weight"`
+}
+
+// DefaultWeight gives every priority level four times the share of the level below it,
+// so a burst on a higher tier takes almost every free worker.
+func DefaultWeight(level int) int {
+	if level < 0 {
+		level = 0
+	}
+	if level > 4 {
+		level = 4
+	}
+	return 1 << (2 * (4 - level))
+}
+
+// ParseTiers decodes the tiers stored under TiersKey, ordered from highest to lowest priority.
+func ParseTiers(data []byte) ([]Tier, error) {
+	var tiers []Tier
+	if err := json.Unmarshal(data, &tiers); err != nil {
+		return nil, fmt.Errorf("invalid priority tiers: %v", err)
+	}
+	return sortTiers(tiers), nil
+}
+
+func sortTiers(tiers []Tier) []Tier {
+	sorted := make([]Tier, 0, len(tiers))
+	seen := make(map[string]bool)
+	for _, tier := range tiers {
+		if tier.Queue == "" || seen[tier.Queue] {
+			continue
+		}
+		seen[tier.Queue] = true
+		if tier.Weight <= 0 {
+			tier.Weight = DefaultWeight(tier.Level)
+		}
+		sorted = append(sorted, tier)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Level < sorted[j].Level })
+	return sorted
+}
+
+// tierState holds the deliveries received for one tier and not yet handed to a worker.
+type tierState struct {
+	Tier
+	pending    []job
+	current    int
+	lastServed time.Time
+}
+
+// scheduler hands deliveries to free workers, choosing between tiers by smooth weighted round robin
+// among the tiers with waiting messages. A tier that has waited StarvationInterval since it was last
+// served goes next regardless of its weight.
+type scheduler struct {
+	mu         sync.Mutex
+	tiers      []*tierState
+	byQueue    map[string]*tierState
+	starvation time.Duration
+	notify     chan struct{}
+}
+
+func newScheduler(tiers []Tier, starvation time.Duration) *scheduler {
+	s := &scheduler{
+		byQueue:    make(map[string]*tierState, len(tiers)),
+		starvation: starvation,
+		notify:     make(chan struct{}, 1),
+	}
+	now := time.Now()
+	for _, tier := range sortTiers(tiers) {
+		state := &tierState{Tier: tier, lastServed: now}
+		s.tiers = append(s.tiers, state)
+		s.byQueue[tier.Queue] = state
+	}
+	return s
+}
+
+// push queues a delivery of a tier and wakes the dispatcher.
+func (s *scheduler) push(j job) {
+	s.mu.Lock()
+	if state, ok := s.byQueue[j.queue]; ok {
+		if len(state.pending) == 0 {
+			// The starvation clock starts when the tier has something to wait for
+			state.lastServed = maxTime(state.lastServed, j.received)
+		}
+		state.pending = append(state.pending, j)
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// setWeights updates the weights of the scheduled tiers. Tiers of queues not consumed are ignored.
+func (s *scheduler) setWeights(tiers []Tier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tier := range sortTiers(tiers) {
+		if state, ok := s.byQueue[tier.Queue]; ok {
+			state.Weight = tier.Weight
+			state.Level = tier.Level
+		}
+	}
+}
+
+// next blocks until a delivery is waiting and returns the one to process next.
+// It returns false once done is closed and nothing is waiting.
+func (s *scheduler) next(done <-chan struct{}) (job, bool) {
+	for {
+		if j, ok := s.pick(time.Now()); ok {
+			return j, true
+		}
+		select {
+		case <-s.notify:
+		case <-done:
+			if j, ok := s.pick(time.Now()); ok {
+				return j, true
+			}
+			return job{}, false
+		}
+	}
+}
+
+func (s *scheduler) pick(now time.Time) (job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Starvation protection: serve the most urgent tier that has waited too long
+	for _, state := range s.tiers {
+		if len(state.pending) > 0 && now.Sub(state.lastServed) >= s.starvation {
+			return s.pop(state, now), true
+		}
+	}
+
+	var best *tierState
+	total := 0
+	for _, state := range s.tiers {
+		if len(state.pending) == 0 {
+			continue
+		}
+		state.current += state.Weight
+		total += state.Weight
+		if best == nil || state.current > best.current {
+			best = state
+		}
+	}
+	if best == nil {
+		return job{}, false
+	}
+	best.current -= total
+	return s.pop(best, now), true
+}
+
+func (s *scheduler) pop(state *tierState, now time.Time) job {
+	j := state.pending[0]
+	state.pending[0] = job{}
+	state.pending = state.pending[1:]
+	state.lastServed = now
+	if len(state.pending) == 0 {
+		state.current = 0
+	}
+	return j
+}
+
+// dispatch hands scheduled deliveries to workers as they become free, then closes jobs.
+// Workers send on idle before every receive from jobs, so idle must have room for every worker.
+func (s *scheduler) dispatch(done <-chan struct{}, idle <-chan struct{}, jobs chan<- job) {
+	defer close(jobs)
+	for {
+		// Choose only once a worker is free, so a delivery that arrives meanwhile can still go first
+		<-idle
+		j, ok := s.next(done)
+		if !ok {
+			return
+		}
+		jobs <- j
+	}
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
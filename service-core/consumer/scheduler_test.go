@@ -0,0 +1,171 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDefaultWeight(t *testing.T) {
+	tests := []struct {
+		level int
+		want  int
+	}{
+		{-1, 256},
+		{0, 256},
+		{1, 64},
+		{2, 16},
+		{3, 4},
+		{4, 1},
+		{9, 1},
+	}
+	for _, tt := range tests {
+		if got := DefaultWeight(tt.level); got != tt.want {
+			t.Errorf("DefaultWeight(%d) = %d, want %d", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := ParseTiers([]byte(`[
+		{"queue": "sms.bulk", "priority_level": 3},
+		{"queue": "sms.otp", "priority_level": 0, "weight": 10},
+		{"queue": "", "priority_level": 1},
+		{"queue": "sms.bulk", "priority_level": 0}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Tier{
+		{Queue: "sms.otp", Level: 0, Weight: 10},
+		{Queue: "sms.bulk", Level: 3, Weight: 4},
+	}
+	if len(tiers) != len(want) {
+		t.Fatalf("ParseTiers() = %+v, want %+v", tiers, want)
+	}
+	for i := range want {
+		if tiers[i] != want[i] {
+			t.Errorf("tier %d = %+v, want %+v", i, tiers[i], want[i])
+		}
+	}
+
+	if _, err := ParseTiers([]byte("{")); err == nil {
+		t.Error("ParseTiers() accepted invalid JSON")
+	}
+}
+
+// pickAll picks a delivery at each of the times and returns their queues
+func pickAll(s *scheduler, times []time.Time) []string {
+	queues := make([]string, 0, len(times))
+	for _, now := range times {
+		j, ok := s.pick(now)
+		if !ok {
+			break
+		}
+		queues = append(queues, j.queue)
+	}
+	return queues
+}
+
+func TestSchedulerWeights(t *testing.T) {
+	tiers := []Tier{
+		{Queue: "high", Level: 0, Weight: 3},
+		{Queue: "low", Level: 1, Weight: 1},
+	}
+	s := newScheduler(tiers, time.Hour)
+	now := time.Now()
+	for i := 0; i < 8; i++ {
+		s.push(job{queue: "high", received: now})
+		s.push(job{queue: "low", received: now})
+	}
+
+	times := make([]time.Time, 16)
+	for i := range times {
+		times[i] = now
+	}
+	got := pickAll(s, times)
+	want := []string{"high", "high", "low", "high", "high", "high", "low", "high", "high", "high", "low", "low", "low", "low", "low", "low"}
+	if len(got) != len(want) {
+		t.Fatalf("picked %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("picked %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSchedulerStarvation(t *testing.T) {
+	const starvation = time.Second
+	start := time.Now()
+
+	tests := []struct {
+		name string
+		// lowAt is when the low priority delivery arrives, relative to start
+		lowAt time.Duration
+		// picks are the times of the picks, relative to start
+		picks []time.Duration
+		// want is the pick that serves the low tier, -1 when none does
+		want int
+	}{
+		{"served by weight once high drains", 0, []time.Duration{0, 0, 0, 0}, 3},
+		{"starved tier goes first", 0, []time.Duration{0, starvation / 2, starvation, starvation}, 2},
+		{"clock starts on arrival", 2 * starvation, []time.Duration{2 * starvation, 2*starvation + starvation/2}, -1},
+		{"starved after arrival", 2 * starvation, []time.Duration{2 * starvation, 2*starvation + starvation/2, 3 * starvation}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The high tier always outweighs the low one, so only the guard can serve low while high is busy
+			s := newScheduler([]Tier{
+				{Queue: "high", Level: 0, Weight: 1000},
+				{Queue: "low", Level: 4, Weight: 1},
+			}, starvation)
+			s.tiers[0].lastServed = start
+			s.tiers[1].lastServed = start
+			for i := 0; i < 3; i++ {
+				s.push(job{queue: "high", received: start})
+			}
+			s.push(job{queue: "low", received: start.Add(tt.lowAt)})
+
+			times := make([]time.Time, len(tt.picks))
+			for i, at := range tt.picks {
+				times[i] = start.Add(at)
+			}
+			got := -1
+			for i, queue := range pickAll(s, times) {
+				if queue == "low" {
+					got = i
+					break
+				}
+			}
+			if got != tt.want {
+				t.Errorf("low tier served at pick %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerDispatch(t *testing.T) {
+	s := newScheduler([]Tier{{Queue: "a", Level: 0}}, DefaultStarvationInterval)
+	done := make(chan struct{})
+	idle := make(chan struct{}, 1)
+	jobs := make(chan job)
+	go s.dispatch(done, idle, jobs)
+
+	s.push(job{queue: "a", received: time.Now()})
+	s.push(job{queue: "unknown", received: time.Now()})
+	idle <- struct{}{}
+	if j := <-jobs; j.queue != "a" {
+		t.Errorf("dispatched %q, want a", j.queue)
+	}
+
+	close(done)
+	idle <- struct{}{}
+	select {
+	case j, ok := <-jobs:
+		if ok {
+			t.Errorf("dispatched %q after done, want jobs closed", j.queue)
+		}
+	case <-time.After(time.Second):
+		t.Error("dispatch did not close jobs once done")
+	}
+}
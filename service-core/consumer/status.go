@@ -0,0 +1,62 @@
+package consumer
+
+import (
+	"log"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+)
+
+// StatusWriter writes status points to InfluxDB in the background, batching them by size and interval.
+// Every point is tagged with the instance that wrote it. A nil StatusWriter discards points.
+type StatusWriter struct {
+	client   influxdb2.Client
+	writeAPI api.WriteAPI
+	instance string
+}
+
+// NewStatusWriter creates a batched writer for the bucket, or returns nil when cfg has no InfluxDB URL.
+func NewStatusWriter(cfg InfluxConfig, instance string) *StatusWriter {
+	if cfg.URL == "" {
+		return nil
+	}
+
+	client := influxdb2.NewClientWithOptions(
+		cfg.URL,
+		cfg.Token,
+		influxdb2.DefaultOptions().
+			SetBatchSize(uint(cfg.BatchSize)).
+			SetFlushInterval(uint(cfg.FlushInterval.Milliseconds())),
+	)
+	writeAPI := client.WriteAPI(cfg.Org, cfg.Bucket)
+	go func() {
+		for err := range writeAPI.Errors() {
+			log.Printf("InfluxDB write error: %v", err)
+		}
+	}()
+
+	return &StatusWriter{client: client, writeAPI: writeAPI, instance: instance}
+}
+
+// Write queues a point of the measurement, adding the instance tag.
+func (s *StatusWriter) Write(measurement string, tags map[string]string, fields map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	pointTags := make(map[string]string, len(tags)+1)
+	for key, value := range tags {
+		pointTags[key] = value
+	}
+	pointTags["instance"] = s.instance
+	s.writeAPI.WritePoint(influxdb2.NewPoint(measurement, pointTags, fields, time.Now()))
+}
+
+// Close flushes the queued points and closes the client.
+func (s *StatusWriter) Close() {
+	if s == nil {
+		return
+	}
+	s.writeAPI.Flush()
+	s.client.Close()
+}
@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"myproject/models"
+	"myproject/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAudit stores an audit record for an action of the current user.
+// Failures are logged and do not fail the request.
+func recordAudit(c *gin.Context, action, resource string, details interface{}) {
+	data, err := json.Marshal(details)
+	if err != nil {
+		log.Printf("Failed to encode audit details for %s: %v", action, err)
+	}
+
+	entry := models.AuditLog{
+		UserID:   callerApp(c),
+		Action:   action,
+		Resource: resource,
+		Details:  string(data),
+	}
+	if err := utils.GetDB().Create(&entry).Error; err != nil {
+		log.Printf("Failed to record audit log for %s on %s: %v", action, resource, err)
+	}
+}
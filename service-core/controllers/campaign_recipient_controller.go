@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"myproject/models"
+	"myproject/msisdn"
 	"myproject/utils"
 	"net/http"
 
@@ -31,7 +32,7 @@ func GetCampaignRecipients(c *gin.Context) {
 
 // CreateCampaignRecipient creates a new campaign recipient
 // @Summary Create a new campaign recipient
-// @Description Create a new campaign recipient with campaign ID, recipient ID, and status
+// @Description Create a new campaign recipient with campaign ID, recipient ID, MSISDN, and status
 // @Tags Campaign Recipients
 // @Accept json
 // @Produce json
@@ -66,9 +67,20 @@ func CreateCampaignRecipient(c *gin.Context) {
 		return
 	}
 
+	var number string
+	if value, ok := input["msisdn"].(string); ok {
+		normalized, err := msisdn.Normalize(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid msisdn: " + err.Error()})
+			return
+		}
+		number = normalized
+	}
+
 	recipient := models.CampaignRecipient{
 		CampaignID: uint(campaignID),
 		Recipient:  uint(recipientID),
+		MSISDN:     number,
 		Status:     status,
 	}
 
@@ -84,7 +96,7 @@ func CreateCampaignRecipient(c *gin.Context) {
 
 // UpdateCampaignRecipient updates an existing campaign recipient
 // @Summary Update an existing campaign recipient
-// @Description Update a campaign recipient by ID with optional fields: campaign ID, recipient ID, and status
+// @Description Update a campaign recipient by ID with optional fields: campaign ID, recipient ID, MSISDN, and status
 // @Tags Campaign Recipients
 // @Accept json
 // @Produce json
@@ -119,6 +131,14 @@ func UpdateCampaignRecipient(c *gin.Context) {
 	if recipientIDFloat, ok := input["recipient"].(float64); ok {
 		recipient.Recipient = uint(recipientIDFloat)
 	}
+	if value, ok := input["msisdn"].(string); ok {
+		normalized, err := msisdn.Normalize(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid msisdn: " + err.Error()})
+			return
+		}
+		recipient.MSISDN = normalized
+	}
 	if status, ok := input["status"].(string); ok {
 		recipient.Status = status
 	}
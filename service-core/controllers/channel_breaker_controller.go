@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"myproject/mnochannel"
+	"myproject/utils"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// channelBreaker is an active channel with the state of its circuit breaker
+type channelBreaker struct {
+	MNO         string `json:"mno"`
+	ChannelType string `json:"channel_type"`
+	Priority    int    `json:"priority"`
+	mnochannel.Breaker
+}
+
+// GetChannelBreakers returns the circuit breaker of every active MNO channel
+// @Summary Get channel circuit breakers
+// @Description Get the circuit breaker state (closed, open or half_open) of every active MNO channel with its consecutive failures, failure and slow call rates over the sliding window, and when an open breaker lets a trial submission through
+// @Tags MNO Channels
+// @Produce json
+// @Param mno query string false "MNO name"
+// @Success 200 {array} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /mno-channels/breakers [get]
+func GetChannelBreakers(c *gin.Context) {
+	redisClient := utils.GetRedis()
+	if redisClient == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Redis is not available"})
+		return
+	}
+
+	byMNO, err := mnochannel.Load(c.Request.Context(), redisClient)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load MNO channels"})
+		return
+	}
+	mnos := make([]string, 0, len(byMNO))
+	for mno := range byMNO {
+		if filter := c.Query("mno"); filter == "" || strings.EqualFold(filter, mno) {
+			mnos = append(mnos, mno)
+		}
+	}
+	sort.Strings(mnos)
+
+	result := []channelBreaker{}
+	for _, mno := range mnos {
+		channels := byMNO[mno]
+		breakers, err := mnochannel.ReadBreakers(c.Request.Context(), redisClient, channels)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read channel circuit breakers"})
+			return
+		}
+		for i, channel := range channels {
+			result = append(result, channelBreaker{
+				MNO:         channel.MNO,
+				ChannelType: channel.Type,
+				Priority:    channel.Priority,
+				Breaker:     breakers[i],
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetChannelBreakerEvents returns the latest circuit breaker transitions
+// @Summary Get channel circuit breaker events
+// @Description Get the latest circuit breaker transitions of the MNO channels, newest first. The same events are published on the Redis channel mno:channel:events.
+// @Tags MNO Channels
+// @Produce json
+// @Param limit query int false "Number of events (default 50, at most 100)"
+// @Success 200 {array} mnochannel.Event
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /mno-channels/breakers/events [get]
+func GetChannelBreakerEvents(c *gin.Context) {
+	redisClient := utils.GetRedis()
+	if redisClient == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Redis is not available"})
+		return
+	}
+
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = parsed
+	}
+
+	events, err := mnochannel.RecentEvents(c.Request.Context(), redisClient, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read channel circuit breaker events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,271 @@
+package controllers
+
+import (
+	"errors"
+	"myproject/dlq"
+	"myproject/rabbitmq"
+	"myproject/routing"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DLQActionRequest selects the parked messages to replay or purge
+type DLQActionRequest struct {
+	MsgIDs []string   `json:"msg_ids,omitempty"`
+	MNO    string     `json:"mno,omitempty"`
+	Type   string     `json:"type,omitempty"`
+	From   *time.Time `json:"from,omitempty"`
+	To     *time.Time `json:"to,omitempty"`
+	// All must be set to act on every parked message when no other filter is given
+	All bool `json:"all,omitempty"`
+	// OverrideMNO and OverrideChannelID redirect replayed messages to another operator or channel
+	OverrideMNO       string `json:"override_mno,omitempty"`
+	OverrideChannelID uint   `json:"override_channel_id,omitempty"`
+}
+
+func (r DLQActionRequest) filter() dlq.Filter {
+	filter := dlq.Filter{MsgIDs: r.MsgIDs, MNO: r.MNO, Type: r.Type}
+	if r.From != nil {
+		filter.From = *r.From
+	}
+	if r.To != nil {
+		filter.To = *r.To
+	}
+	return filter
+}
+
+// DLQController handles dead-letter queue operations
+type DLQController struct {
+	RabbitMQ *rabbitmq.RabbitMQ
+	Browser  *dlq.Browser
+}
+
+// NewDLQController initializes a DLQController
+func NewDLQController(rmq *rabbitmq.RabbitMQ) *DLQController {
+	return &DLQController{RabbitMQ: rmq, Browser: dlq.NewBrowser(rmq)}
+}
+
+// GetDLQs lists the dead-letter queues with their message counts
+// @Summary List dead-letter queues
+// @Description Lists the dead-letter queue of every queue in the topology and of every configured message type with the number of parked messages
+// @Tags Queues
+// @Produce json
+// @Success 200 {array} dlq.Summary
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/queues/dlq [get]
+func (d *DLQController) GetDLQs(c *gin.Context) {
+	topology := d.RabbitMQ.Topology()
+	queues := make(map[string]bool)
+	for _, queue := range topology.Queues {
+		queues[queue.Name] = true
+	}
+	for _, typeRoute := range routing.MessageTypes() {
+		queues[typeRoute.Queue] = true
+	}
+
+	names := make([]string, 0, len(queues))
+	for name := range queues {
+		if topology.Queue(name).DeadLetterQueue {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	summaries := []dlq.Summary{}
+	for _, name := range names {
+		summary, err := d.Browser.Count(name)
+		if errors.Is(err, dlq.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect dead-letter queues"})
+			return
+		}
+		summaries = append(summaries, summary)
+	}
+
+	c.JSON(http.StatusOK, summaries)
+}
+
+// GetDLQMessages lists the parked messages of a queue
+// @Summary List parked messages
+// @Description Lists parked messages of a queue with their failure reason and headers. Listed messages stay in the dead-letter queue.
+// @Tags Queues
+// @Produce json
+// @Param queue path string true "Queue name, e.g. general"
+// @Param mno query string false "Only messages for this MNO"
+// @Param type query string false "Only messages of this type"
+// @Param msg_id query string false "Comma separated message IDs"
+// @Param from query string false "Parked at or after (RFC3339)"
+// @Param to query string false "Parked at or before (RFC3339)"
+// @Param limit query int false "Maximum number of messages" default(100)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/queues/dlq/{queue} [get]
+func (d *DLQController) GetDLQMessages(c *gin.Context) {
+	queue := c.Param("queue")
+
+	filter := dlq.Filter{MNO: c.Query("mno"), Type: c.Query("type")}
+	if ids := c.Query("msg_id"); ids != "" {
+		filter.MsgIDs = strings.Split(ids, ",")
+	}
+	var err error
+	if value := c.Query("from"); value != "" {
+		if filter.From, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected RFC3339"})
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if filter.To, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, expected RFC3339"})
+			return
+		}
+	}
+
+	limit := defaultHistoryLimit
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxHistoryLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	messages, err := d.Browser.List(queue, filter, limit)
+	if errors.Is(err, dlq.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead-letter queue not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read dead-letter queue"})
+		return
+	}
+
+	recordAudit(c, "dlq.view", dlq.Name(queue), gin.H{"filter": c.Request.URL.RawQuery, "count": len(messages)})
+
+	c.JSON(http.StatusOK, gin.H{"queue": queue, "count": len(messages), "messages": messages})
+}
+
+// ReplayDLQMessages sends parked messages back to their queue
+// @Summary Replay parked messages
+// @Description Publishes the selected parked messages back to their original queue with a fresh retry count, optionally to another MNO or channel
+// @Tags Queues
+// @Accept json
+// @Produce json
+// @Param queue path string true "Queue name, e.g. general"
+// @Param input body DLQActionRequest true "Messages to replay"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/queues/dlq/{queue}/replay [post]
+func (d *DLQController) ReplayDLQMessages(c *gin.Context) {
+	queue := c.Param("queue")
+
+	var input DLQActionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter := input.filter()
+	if filter.IsEmpty() && !input.All {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Select messages with a filter or set all to true"})
+		return
+	}
+
+	override := dlq.Override{ChannelID: input.OverrideChannelID}
+	if input.OverrideChannelID != 0 && input.OverrideMNO == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "override_channel_id requires override_mno"})
+		return
+	}
+	if input.OverrideMNO != "" {
+		route, ok := routing.FindMNO(input.OverrideMNO)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or inactive override_mno"})
+			return
+		}
+		override.MNO = route.MNOName
+
+		if input.OverrideChannelID != 0 {
+			found := false
+			for _, channel := range route.Channels {
+				if channel.ChannelID == input.OverrideChannelID {
+					found = true
+					break
+				}
+			}
+			if !found {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "override_channel_id is not an active channel of override_mno"})
+				return
+			}
+		}
+	}
+
+	replayed, err := d.Browser.Replay(queue, filter, override)
+	recordAudit(c, "dlq.replay", dlq.Name(queue), gin.H{"request": input, "replayed": replayed, "error": errorString(err)})
+	if errors.Is(err, dlq.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead-letter queue not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Replay stopped: " + err.Error(), "replayed": replayed})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Messages replayed", "replayed": replayed})
+}
+
+// PurgeDLQMessages deletes parked messages
+// @Summary Purge parked messages
+// @Description Deletes the selected parked messages, or every parked message of the queue when all is set without a filter
+// @Tags Queues
+// @Accept json
+// @Produce json
+// @Param queue path string true "Queue name, e.g. general"
+// @Param input body DLQActionRequest true "Messages to purge"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/queues/dlq/{queue}/purge [post]
+func (d *DLQController) PurgeDLQMessages(c *gin.Context) {
+	queue := c.Param("queue")
+
+	var input DLQActionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter := input.filter()
+	if filter.IsEmpty() && !input.All {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Select messages with a filter or set all to true"})
+		return
+	}
+
+	purged, err := d.Browser.Purge(queue, filter)
+	recordAudit(c, "dlq.purge", dlq.Name(queue), gin.H{"request": input, "purged": purged, "error": errorString(err)})
+	if errors.Is(err, dlq.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead-letter queue not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Purge stopped: " + err.Error(), "purged": purged})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Messages purged", "purged": purged})
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"myproject/dlr"
+	"myproject/models"
+	"myproject/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// syncDLRApp updates the Redis set consumers check before publishing receipts for an application
+func syncDLRApp(app string) {
+	redisClient := utils.GetRedis()
+	if redisClient == nil {
+		return
+	}
+	if err := dlr.SyncApp(context.Background(), utils.GetDB(), redisClient, app); err != nil {
+		log.Printf("Failed to sync DLR apps for %s: %v", app, err)
+	}
+}
+
+// GetDLRWebhook returns the webhook of the calling application
+// @Summary Get the DLR webhook
+// @Description Get the delivery receipt webhook registered by the calling application
+// @Tags DLR
+// @Produce json
+// @Success 200 {object} models.DLRWebhook
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/dlr/webhook [get]
+func GetDLRWebhook(c *gin.Context) {
+	db := utils.GetDB()
+	var webhook models.DLRWebhook
+
+	if err := db.Where("app = ?", callerApp(c)).First(&webhook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "DLR webhook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// SaveDLRWebhook registers or updates the webhook of the calling application
+// @Summary Register the DLR webhook
+// @Description Register or update the callback URL that receives signed delivery receipts for the calling application.
+// @Description The callback URL must use https and must not target a loopback or private address.
+// @Description A secret is generated when none is given; it is only returned by this call.
+// @Tags DLR
+// @Accept json
+// @Produce json
+// @Param input body map[string]interface{} true "callback_url, optional secret and active"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/dlr/webhook [put]
+func SaveDLRWebhook(c *gin.Context) {
+	var input map[string]interface{}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	app := callerApp(c)
+	db := utils.GetDB()
+	var webhook models.DLRWebhook
+
+	err := db.Where("app = ?", app).First(&webhook).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch DLR webhook"})
+		return
+	}
+	exists := err == nil
+	webhook.App = app
+	if !exists {
+		webhook.Active = true
+	}
+
+	if callbackURL, ok := input["callback_url"].(string); ok {
+		webhook.CallbackURL = callbackURL
+	}
+	if err := dlr.ValidateCallbackURL(webhook.CallbackURL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid callback_url: " + err.Error()})
+		return
+	}
+	if active, ok := input["active"].(bool); ok {
+		webhook.Active = active
+	}
+
+	// Only return the secret when it was set by this call
+	var secret string
+	if value, ok := input["secret"].(string); ok && value != "" {
+		secret = value
+	} else if !exists {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+		secret = hex.EncodeToString(buf)
+	}
+	if secret != "" {
+		webhook.Secret = secret
+	}
+
+	if err := db.Save(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save DLR webhook"})
+		return
+	}
+
+	syncDLRApp(app)
+
+	response := gin.H{"webhook": webhook}
+	if secret != "" {
+		response["secret"] = secret
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteDLRWebhook removes the webhook of the calling application
+// @Summary Delete the DLR webhook
+// @Description Stop sending delivery receipts to the calling application
+// @Tags DLR
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/dlr/webhook [delete]
+func DeleteDLRWebhook(c *gin.Context) {
+	app := callerApp(c)
+	db := utils.GetDB()
+	var webhook models.DLRWebhook
+
+	if err := db.Where("app = ?", app).First(&webhook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "DLR webhook not found"})
+		return
+	}
+
+	if err := db.Delete(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete DLR webhook"})
+		return
+	}
+
+	syncDLRApp(app)
+
+	c.JSON(http.StatusOK, gin.H{"message": "DLR webhook deleted successfully"})
+}
+
+// GetDLRAttempts lists the receipt delivery attempts of the calling application
+// @Summary List DLR delivery attempts
+// @Description List the attempts to post delivery receipts to the calling application, newest first
+// @Tags DLR
+// @Produce json
+// @Param msg_id query string false "Only attempts for this message"
+// @Param limit query int false "Maximum number of attempts" default(100)
+// @Success 200 {array} models.DLRAttempt
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/dlr/attempts [get]
+func GetDLRAttempts(c *gin.Context) {
+	limit := defaultHistoryLimit
+	if value := c.Query("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxHistoryLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	query := utils.GetDB().Where("app = ?", callerApp(c))
+	if msgID := c.Query("msg_id"); msgID != "" {
+		query = query.Where("msg_id = ?", msgID)
+	}
+
+	var attempts []models.DLRAttempt
+	if err := query.Order("created_at DESC").Limit(limit).Find(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch DLR attempts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, attempts)
+}
@@ -1,13 +1,30 @@
 package controllers
 
 import (
+	"context"
+	"log"
+	dndlist "myproject/dnd"
 	"myproject/models"
+	"myproject/msisdn"
 	"myproject/utils"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+// syncDNDNumbers updates the Redis DND set used for filtering after entries for these numbers changed
+func syncDNDNumbers(numbers ...string) {
+	redisClient := utils.GetRedis()
+	if redisClient == nil {
+		return
+	}
+	for _, number := range numbers {
+		if err := dndlist.SyncNumber(context.Background(), utils.GetDB(), redisClient, number); err != nil {
+			log.Printf("Failed to sync DND set for %s: %v", number, err)
+		}
+	}
+}
+
 // GetDNDs retrieves all DND entries
 // @Summary Get all DND entries
 // @Description Get all DND entries
@@ -54,6 +71,12 @@ func CreateDND(c *gin.Context) {
 		return
 	}
 
+	phoneNumber, err := msisdn.Normalize(phoneNumber)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone_number: " + err.Error()})
+		return
+	}
+
 	reason, ok := input["reason"].(string)
 	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reason"})
@@ -79,6 +102,8 @@ func CreateDND(c *gin.Context) {
 		return
 	}
 
+	syncDNDNumbers(dnd.Phone_Number)
+
 	c.JSON(http.StatusCreated, dnd)
 }
 
@@ -112,9 +137,15 @@ func UpdateDND(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "DND entry not found"})
 		return
 	}
+	previousNumber := dnd.Phone_Number
 
 	if phoneNumber, ok := input["phone_number"].(string); ok {
-		dnd.Phone_Number = phoneNumber
+		normalized, err := msisdn.Normalize(phoneNumber)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone_number: " + err.Error()})
+			return
+		}
+		dnd.Phone_Number = normalized
 	}
 	if reason, ok := input["reason"].(string); ok {
 		dnd.Reason = reason
@@ -128,6 +159,8 @@ func UpdateDND(c *gin.Context) {
 		return
 	}
 
+	syncDNDNumbers(previousNumber, dnd.Phone_Number)
+
 	c.JSON(http.StatusOK, dnd)
 }
 
@@ -158,6 +191,8 @@ func DeleteDND(c *gin.Context) {
 		return
 	}
 
+	syncDNDNumbers(dnd.Phone_Number)
+
 	c.JSON(http.StatusOK, gin.H{"message": "DND entry deleted successfully"})
 }
 
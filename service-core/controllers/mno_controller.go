@@ -1,11 +1,19 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myproject/mnoadapter"
 	"myproject/models"
+	"myproject/routing"
+	"myproject/smpp"
 	"myproject/utils"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // GetMNOs retrieves all MNOs
@@ -79,6 +87,8 @@ func CreateMNO(c *gin.Context) {
 		return
 	}
 
+	routing.RefreshMNORoutes()
+
 	c.JSON(http.StatusCreated, mno)
 }
 
@@ -128,6 +138,8 @@ func UpdateMNO(c *gin.Context) {
 		return
 	}
 
+	routing.RefreshMNORoutes()
+
 	c.JSON(http.StatusOK, mno)
 }
 
@@ -158,6 +170,8 @@ func DeleteMNO(c *gin.Context) {
 		return
 	}
 
+	routing.RefreshMNORoutes()
+
 	c.JSON(http.StatusOK, gin.H{"message": "MNO deleted successfully"})
 }
 
@@ -185,9 +199,68 @@ func GetMNODetails(c *gin.Context) {
 	c.JSON(http.StatusOK, mno)
 }
 
+// applyConnectionInput sets the optional SMSC connection fields and HTTP adapter configuration of a channel
+// and checks that an SMPP channel can bind
+func applyConnectionInput(channel *models.MnoChannels, input map[string]interface{}) error {
+	for field, target := range map[string]*string{
+		"host":        &channel.Host,
+		"system_id":   &channel.SystemID,
+		"password":    &channel.Password,
+		"system_type": &channel.SystemType,
+		"bind_mode":   &channel.BindMode,
+		"source_addr": &channel.SourceAddr,
+	} {
+		if value, exists := input[field]; exists {
+			text, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("Invalid %s", field)
+			}
+			*target = text
+		}
+	}
+	for field, target := range map[string]*int{
+		"port":        &channel.Port,
+		"window_size": &channel.WindowSize,
+	} {
+		if value, exists := input[field]; exists {
+			number, ok := value.(float64)
+			if !ok || number < 0 {
+				return fmt.Errorf("Invalid %s", field)
+			}
+			*target = int(number)
+		}
+	}
+
+	if value, exists := input["http_config"]; exists {
+		if value == nil {
+			channel.HTTPConfig = ""
+		} else {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return errors.New("Invalid http_config")
+			}
+			if _, err := mnoadapter.ParseHTTPConfig(data); err != nil {
+				return fmt.Errorf("Invalid http_config: %v", err)
+			}
+			channel.HTTPConfig = string(data)
+		}
+	}
+
+	if !strings.EqualFold(channel.ChannelType, "SMPP") {
+		return nil
+	}
+	if _, err := smpp.ParseBindMode(channel.BindMode); err != nil {
+		return errors.New("Invalid bind_mode, expected transmitter, receiver or transceiver")
+	}
+	if channel.Host == "" || channel.Port == 0 || channel.SystemID == "" {
+		return errors.New("SMPP channels require host, port and system_id")
+	}
+	return nil
+}
+
 // CreateMNOChannel creates a new channel for an MNO
 // @Summary Create a new MNO channel
-// @Description Create a new channel for an MNO with the provided details
+// @Description Create a new channel for an MNO with the provided details. SMPP channels also take host, port, system_id, password, system_type, bind_mode, window_size and source_addr; HTTP channels take an http_config object describing the operator API.
 // @Tags MNO Channels
 // @Accept json
 // @Produce json
@@ -204,25 +277,31 @@ func CreateMNOChannel(c *gin.Context) {
 		return
 	}
 
-	mnoID, ok := input["mno_id"].(uint)
+	mnoIDStr, ok := input["mno_id"].(string)
 	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mno_id"})
 		return
 	}
 
+	mnoID, err := uuid.Parse(mnoIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mno_id"})
+		return
+	}
+
 	channelType, ok := input["channel_type"].(string)
 	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel_type"})
 		return
 	}
 
-	priority, ok := input["priority"].(int)
+	priority, ok := input["priority"].(float64)
 	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority"})
 		return
 	}
 
-	tps, ok := input["tps"].(int)
+	tps, ok := input["tps"].(float64)
 	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tps"})
 		return
@@ -237,10 +316,14 @@ func CreateMNOChannel(c *gin.Context) {
 	channel := models.MnoChannels{
 		MNOID:       mnoID,
 		ChannelType: channelType,
-		Priority:    priority,
-		TPS:         tps,
+		Priority:    int(priority),
+		TPS:         int(tps),
 		Status:      status,
 	}
+	if err := applyConnectionInput(&channel, input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	db := utils.GetDB()
 
@@ -249,6 +332,8 @@ func CreateMNOChannel(c *gin.Context) {
 		return
 	}
 
+	routing.RefreshMNORoutes()
+
 	c.JSON(http.StatusCreated, channel)
 }
 
@@ -286,21 +371,27 @@ func UpdateMNOChannel(c *gin.Context) {
 	if channelType, ok := input["channel_type"].(string); ok {
 		channel.ChannelType = channelType
 	}
-	if priority, ok := input["priority"].(int); ok {
-		channel.Priority = priority
+	if priority, ok := input["priority"].(float64); ok {
+		channel.Priority = int(priority)
 	}
-	if tps, ok := input["tps"].(int); ok {
-		channel.TPS = tps
+	if tps, ok := input["tps"].(float64); ok {
+		channel.TPS = int(tps)
 	}
 	if status, ok := input["status"].(string); ok {
 		channel.Status = status
 	}
+	if err := applyConnectionInput(&channel, input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := db.Save(&channel).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update MNO channel"})
 		return
 	}
 
+	routing.RefreshMNORoutes()
+
 	c.JSON(http.StatusOK, channel)
 }
 
@@ -331,5 +422,7 @@ func DeleteMNOChannel(c *gin.Context) {
 		return
 	}
 
+	routing.RefreshMNORoutes()
+
 	c.JSON(http.StatusOK, gin.H{"message": "MNO channel deleted successfully"})
 }
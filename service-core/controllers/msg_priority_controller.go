@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"myproject/models"
+	"myproject/routing"
 	"myproject/utils"
 	"net/http"
 
@@ -31,7 +32,7 @@ func GetMsgPriorities(c *gin.Context) {
 
 // CreateMsgPriority creates a new SMS priority configuration
 // @Summary Create a new SMS priority configuration
-// @Description Create a new SMS priority configuration with message type, priority level, and description
+// @Description Create a new SMS priority configuration with message type, priority level, description and an optional consumer weight
 // @Tags SMS Priority
 // @Accept json
 // @Produce json
@@ -54,7 +55,7 @@ func CreateMsgPriority(c *gin.Context) {
 		return
 	}
 
-	priorityLevel, ok := input["priority_level"].(int)
+	priorityLevel, ok := input["priority_level"].(float64)
 	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority_level"})
 		return
@@ -66,9 +67,18 @@ func CreateMsgPriority(c *gin.Context) {
 		return
 	}
 
+	weight := 0.0
+	if value, exists := input["weight"]; exists {
+		if weight, ok = value.(float64); !ok || weight < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid weight"})
+			return
+		}
+	}
+
 	priority := models.MsgPriority{
 		Message_Type:   messageType,
-		Priority_Level: priorityLevel,
+		Priority_Level: int(priorityLevel),
+		Weight:         int(weight),
 		Description:    description,
 	}
 
@@ -79,12 +89,14 @@ func CreateMsgPriority(c *gin.Context) {
 		return
 	}
 
+	routing.RefreshMsgPriorities()
+
 	c.JSON(http.StatusCreated, priority)
 }
 
 // UpdateMsgPriority updates an existing SMS priority configuration
 // @Summary Update an existing SMS priority configuration
-// @Description Update an SMS priority configuration by ID with optional fields: message type, priority level, and description
+// @Description Update an SMS priority configuration by ID with optional fields: message type, priority level, weight, and description
 // @Tags SMS Priority
 // @Accept json
 // @Produce json
@@ -116,8 +128,16 @@ func UpdateMsgPriority(c *gin.Context) {
 	if messageType, ok := input["message_type"].(string); ok {
 		priority.Message_Type = messageType
 	}
-	if priorityLevel, ok := input["priority_level"].(int); ok {
-		priority.Priority_Level = priorityLevel
+	if priorityLevel, ok := input["priority_level"].(float64); ok {
+		priority.Priority_Level = int(priorityLevel)
+	}
+	if value, exists := input["weight"]; exists {
+		weight, ok := value.(float64)
+		if !ok || weight < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid weight"})
+			return
+		}
+		priority.Weight = int(weight)
 	}
 	if description, ok := input["description"].(string); ok {
 		priority.Description = description
@@ -128,6 +148,8 @@ func UpdateMsgPriority(c *gin.Context) {
 		return
 	}
 
+	routing.RefreshMsgPriorities()
+
 	c.JSON(http.StatusOK, priority)
 }
 
@@ -158,6 +180,8 @@ func DeleteMsgPriority(c *gin.Context) {
 		return
 	}
 
+	routing.RefreshMsgPriorities()
+
 	c.JSON(http.StatusOK, gin.H{"message": "SMS priority configuration deleted successfully"})
 }
 
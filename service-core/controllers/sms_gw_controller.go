@@ -3,32 +3,79 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"myproject/config"
+	"myproject/dnd"
+	"myproject/idempotency"
+	"myproject/msgid"
+	"myproject/msisdn"
 	"myproject/rabbitmq"
+	"myproject/routing"
+	"myproject/smsencoding"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/redis/go-redis/v9"
 )
 
 // SMSRequest represents an incoming SMS API request
 type SMSRequest struct {
-	SMSText string `json:"sms_text" example:"Hello, this is a test message"`
-	MSISDN  string `json:"msisdn" example:"01712345678"`
+	SMSText   string `json:"sms_text" example:"Hello, this is a test message"`
+	MSISDN    string `json:"msisdn" example:"+8801712345678"`
+	Type      string `json:"type,omitempty" example:"otp"`
+	RequestID string `json:"request_id,omitempty" example:"TXN-20250406-000123"`
+}
+
+// SMSBatchRequest represents an incoming bulk SMS API request
+type SMSBatchRequest struct {
+	Messages []SMSRequest `json:"messages"`
+}
+
+// SMSBatchResult reports the outcome of one message in a batch
+type SMSBatchResult struct {
+	Index     int    `json:"index"`
+	MsgID     string `json:"msg_id,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+	Segments  int    `json:"segments,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SMSBatchResponse is returned by the bulk SMS API
+type SMSBatchResponse struct {
+	Message  string           `json:"message"`
+	Accepted int              `json:"accepted"`
+	Rejected int              `json:"rejected"`
+	Results  []SMSBatchResult `json:"results"`
+}
+
+// batchGroup collects the batch messages bound for one queue and priority
+type batchGroup struct {
+	indexes  []int
+	payloads []MessagePayload
+	messages [][]byte
 }
 
 // MessagePayload defines the structure of the message to be sent
 type MessagePayload struct {
-	MNO    string `json:"mno"`
-	MsgID  string `json:"msg_id"`
-	MSISDN string `json:"msisdn"`
-	Status string `json:"status"`
-	Text   string `json:"text"`
-	Type   string `json:"type"`
+	App       string `json:"app,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+	MNO       string `json:"mno"`
+	MsgID     string `json:"msg_id"`
+	MSISDN    string `json:"msisdn"`
+	RequestID string `json:"request_id,omitempty"`
+	Segments  int    `json:"segments,omitempty"`
+	Status    string `json:"status"`
+	Text      string `json:"text"`
+	Type      string `json:"type"`
 }
 
 // SMSGatewayController handles SMS processing
@@ -36,22 +83,34 @@ type SMSGatewayController struct {
 	InfluxClient influxdb2.Client
 	Config       *config.Config
 	RabbitMQ     *rabbitmq.RabbitMQ
+	Redis        *redis.Client
+	Idempotency  *idempotency.Store
 }
 
 // NewSMSGatewayController initializes an SMSGatewayController
-func NewSMSGatewayController(client influxdb2.Client, cfg *config.Config, rmq *rabbitmq.RabbitMQ) *SMSGatewayController {
-	return &SMSGatewayController{InfluxClient: client, Config: cfg, RabbitMQ: rmq}
+func NewSMSGatewayController(client influxdb2.Client, cfg *config.Config, rmq *rabbitmq.RabbitMQ, redisClient *redis.Client) *SMSGatewayController {
+	return &SMSGatewayController{
+		InfluxClient: client,
+		Config:       cfg,
+		RabbitMQ:     rmq,
+		Redis:        redisClient,
+		Idempotency:  idempotency.NewStore(redisClient, cfg.IdempotencyTTL),
+	}
 }
 
 // ProcessSMS receives an SMS request and processes it
 // @Summary Send an SMS message
-// @Description Receives an SMS text and MSISDN, determines the carrier, queues the message, and logs it in InfluxDB
+// @Description Receives an SMS text, MSISDN and message type, determines the carrier, queues the message on the queue and priority configured for its type, and logs it in InfluxDB.
+// @Description A repeated request_id or Idempotency-Key returns the original msg_id without queueing again.
+// @Description Promotional messages to numbers on the DND list are recorded with status dnd_blocked and not queued.
+// @Description Success is only returned once RabbitMQ has confirmed the message.
 // @Tags SMS Gateway
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string false "Client request ID, overrides request_id in the body"
 // @Param smsRequest body SMSRequest true "SMS request payload"
 // @Success 200 {object} map[string]interface{} "SMS received and queued"
-// @Failure 400 {object} map[string]string "Invalid request format or carrier prefix"
+// @Failure 400 {object} map[string]string "Invalid request format, carrier prefix or message type"
 // @Failure 500 {object} map[string]string "Failed to write to InfluxDB"
 // @Router /sms/send [post]
 func (s *SMSGatewayController) ProcessSMS(c *gin.Context) {
@@ -61,68 +120,241 @@ func (s *SMSGatewayController) ProcessSMS(c *gin.Context) {
 		return
 	}
 
-	if len(smsReq.MSISDN) != 11 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "MSISDN must be an 11-digit number"})
-		return
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		smsReq.RequestID = key
 	}
 
-	// Determine MNO based on MSISDN prefix
-	mno := getMNO(smsReq.MSISDN[:3])
-	if mno == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid carrier prefix"})
+	route, typeRoute, err := validateSMS(&smsReq)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Generate unique message ID
-	msgID := generateMsgID()
+	// Generate unique, time-ordered message ID
+	msgID := msgid.New()
+
+	// Return the original message if this request ID was already submitted
+	app := callerApp(c)
+	if smsReq.RequestID != "" {
+		original, err := s.Idempotency.Reserve(c, app, smsReq.RequestID, idempotency.Record{MsgID: msgID, Status: idempotency.StatusProcessing})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check request_id"})
+			return
+		}
+		if original != nil {
+			c.JSON(http.StatusOK, gin.H{"message": "Duplicate request, SMS already received", "msg_id": original.MsgID, "status": original.Status, "duplicate": true})
+			return
+		}
+	}
 
 	// Prepare message payload for RabbitMQ
-	messageData := map[string]string{
-		"msg_id": msgID,
-		"msisdn": smsReq.MSISDN,
-		"text":   smsReq.SMSText,
-		"mno":    mno,
-		"type":   "general", // Can be OTP, transactional, promotional, etc.
-		"status": "queued",
+	payload := newQueuedPayload(msgID, smsReq, route.MNOName, typeRoute.Type)
+	payload.App = app
+
+	// Promotional traffic to numbers on the DND list is recorded but never queued
+	blocked, err := s.isDNDBlocked(c, typeRoute.Type, smsReq.MSISDN)
+	if err != nil {
+		s.releaseRequestID(c, app, smsReq.RequestID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check DND list"})
+		return
+	}
+	if blocked {
+		payload.Status = dnd.StatusBlocked
+		s.completeRequestID(c, app, smsReq.RequestID, payload)
+
+		writeAPI := s.InfluxClient.WriteAPIBlocking(s.Config.InfluxDBOrg, s.Config.InfluxDBBucket)
+		if err := writeAPI.WritePoint(context.Background(), newDeliveryPoint(payload)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write to InfluxDB"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "SMS blocked by DND", "msg_id": msgID, "status": payload.Status})
+		return
 	}
 
-	messageJSON, err := json.Marshal(messageData)
+	messageJSON, err := json.Marshal(payload)
 	if err != nil {
+		s.releaseRequestID(c, app, smsReq.RequestID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to serialize message data"})
 		return
 	}
 
-	// Publish to RabbitMQ queue
-	err = s.RabbitMQ.PublishWithPriority("general", messageJSON, 1) // Adjust priority if needed
+	// Publish to the queue configured for the message type
+	err = s.publish(typeRoute, messageJSON)
 	if err != nil {
+		s.releaseRequestID(c, app, smsReq.RequestID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish message to RabbitMQ"})
 		return
 	}
+	s.completeRequestID(c, app, smsReq.RequestID, payload)
 
 	// Log the message in InfluxDB
 	writeAPI := s.InfluxClient.WriteAPIBlocking(s.Config.InfluxDBOrg, s.Config.InfluxDBBucket)
-	point := influxdb2.NewPoint("sms_delivery",
-		map[string]string{
-			"msg_id": msgID,
-			"type":   "general",
-			"mno":    mno,
-			"msisdn": smsReq.MSISDN,
-			"text":   smsReq.SMSText,
-			"status": "queued",
-		},
-		map[string]interface{}{
-			"retry_count":           0,
-			"queue_time":            time.Now().UnixMilli(),
-			"carrier_response_time": 0,
-		},
-		time.Now())
-
-	if err := writeAPI.WritePoint(context.Background(), point); err != nil {
+	if err := writeAPI.WritePoint(context.Background(), newDeliveryPoint(payload)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write to InfluxDB"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "SMS received and queued", "msg_id": msgID})
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "SMS received and queued",
+		"msg_id":   msgID,
+		"type":     typeRoute.Type,
+		"encoding": payload.Encoding,
+		"segments": payload.Segments,
+	})
+}
+
+// ProcessSMSBatch receives a batch of SMS requests and processes each one independently
+// @Summary Send a batch of SMS messages
+// @Description Validates every message, queues the valid ones grouped by message type, logs them in InfluxDB in one batch and reports a result per message.
+// @Description Messages whose request_id was already submitted return the original msg_id and are not queued again.
+// @Description A message is only reported as queued once RabbitMQ has confirmed it.
+// @Tags SMS Gateway
+// @Accept json
+// @Produce json
+// @Param smsBatchRequest body SMSBatchRequest true "SMS batch payload"
+// @Success 200 {object} SMSBatchResponse "Per-message results"
+// @Failure 400 {object} map[string]string "Invalid request format or batch size"
+// @Failure 500 {object} map[string]string "Failed to publish messages or write to InfluxDB"
+// @Router /sms/send-batch [post]
+func (s *SMSGatewayController) ProcessSMSBatch(c *gin.Context) {
+	var batchReq SMSBatchRequest
+	if err := c.ShouldBindJSON(&batchReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if len(batchReq.Messages) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Batch must contain at least one message"})
+		return
+	}
+	if len(batchReq.Messages) > s.Config.SMSBatchMaxSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Batch must not contain more than %d messages", s.Config.SMSBatchMaxSize)})
+		return
+	}
+
+	app := callerApp(c)
+	results := make([]SMSBatchResult, len(batchReq.Messages))
+	groups := make(map[routing.TypeRoute]*batchGroup)
+	var order []routing.TypeRoute
+	var points []*write.Point
+
+	for i, smsReq := range batchReq.Messages {
+		results[i].Index = i
+
+		route, typeRoute, err := validateSMS(&smsReq)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		msgID := msgid.New()
+		if smsReq.RequestID != "" {
+			original, err := s.Idempotency.Reserve(c, app, smsReq.RequestID, idempotency.Record{MsgID: msgID, Status: idempotency.StatusProcessing})
+			if err != nil {
+				results[i].Error = "Failed to check request_id"
+				continue
+			}
+			if original != nil {
+				results[i].MsgID = original.MsgID
+				results[i].Status = original.Status
+				results[i].Duplicate = true
+				continue
+			}
+		}
+
+		payload := newQueuedPayload(msgID, smsReq, route.MNOName, typeRoute.Type)
+		payload.App = app
+
+		blocked, err := s.isDNDBlocked(c, typeRoute.Type, smsReq.MSISDN)
+		if err != nil {
+			s.releaseRequestID(c, app, smsReq.RequestID)
+			results[i].Error = "Failed to check DND list"
+			continue
+		}
+		if blocked {
+			payload.Status = dnd.StatusBlocked
+			s.completeRequestID(c, app, smsReq.RequestID, payload)
+			results[i].MsgID = payload.MsgID
+			results[i].Status = payload.Status
+			points = append(points, newDeliveryPoint(payload))
+			continue
+		}
+
+		messageJSON, err := json.Marshal(payload)
+		if err != nil {
+			s.releaseRequestID(c, app, smsReq.RequestID)
+			results[i].Error = "Failed to serialize message data"
+			continue
+		}
+
+		group, ok := groups[typeRoute]
+		if !ok {
+			group = &batchGroup{}
+			groups[typeRoute] = group
+			order = append(order, typeRoute)
+		}
+		group.indexes = append(group.indexes, i)
+		group.payloads = append(group.payloads, payload)
+		group.messages = append(group.messages, messageJSON)
+	}
+
+	// Publish the valid messages to RabbitMQ, one group per message type
+	var publishErr error
+	for _, typeRoute := range order {
+		group := groups[typeRoute]
+
+		published := 0
+		err := s.RabbitMQ.EnsureQueue(typeRoute.Queue)
+		if err == nil {
+			published, err = s.RabbitMQ.PublishBatchWithPriority(typeRoute.Queue, group.messages, typeRoute.Priority)
+		}
+		if err != nil {
+			publishErr = err
+		}
+
+		for n, i := range group.indexes {
+			payload := group.payloads[n]
+			if n < published {
+				s.completeRequestID(c, app, payload.RequestID, payload)
+				results[i].MsgID = payload.MsgID
+				results[i].Status = payload.Status
+				results[i].Encoding = payload.Encoding
+				results[i].Segments = payload.Segments
+				points = append(points, newDeliveryPoint(payload))
+			} else {
+				s.releaseRequestID(c, app, payload.RequestID)
+				results[i].Error = "Failed to publish message to RabbitMQ"
+			}
+		}
+	}
+	if publishErr != nil && len(points) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish messages to RabbitMQ"})
+		return
+	}
+
+	// Log the published messages in InfluxDB with a single write
+	if len(points) > 0 {
+		writeAPI := s.InfluxClient.WriteAPIBlocking(s.Config.InfluxDBOrg, s.Config.InfluxDBBucket)
+		if err := writeAPI.WritePoint(context.Background(), points...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write to InfluxDB"})
+			return
+		}
+	}
+
+	rejected := 0
+	for _, result := range results {
+		if result.Error != "" {
+			rejected++
+		}
+	}
+
+	c.JSON(http.StatusOK, SMSBatchResponse{
+		Message:  "SMS batch processed",
+		Accepted: len(results) - rejected,
+		Rejected: rejected,
+		Results:  results,
+	})
 }
 
 // PublishMillionMessages publishes 1 million messages to the specified queue and logs them in InfluxDB
@@ -138,6 +370,7 @@ func (s *SMSGatewayController) ProcessSMS(c *gin.Context) {
 func (s *SMSGatewayController) PublishMillionMessages(c *gin.Context) {
 	const totalMessages = 1_000_000
 	const batchSize = 10_000 // Batch size for progress logging
+	const publishWorkers = 32
 
 	// Get query parameters
 	queueName := c.DefaultQuery("queueName", "general")
@@ -151,7 +384,7 @@ func (s *SMSGatewayController) PublishMillionMessages(c *gin.Context) {
 	// Base message payload
 	baseMsg := MessagePayload{
 		MNO:    "Robi",
-		MsgID:  "2025032102343877835", // Will be overridden for uniqueness
+		MsgID:  "", // Will be generated for each message
 		MSISDN: "01814266295",
 		Status: "queued",
 		Text:   "",
@@ -161,53 +394,74 @@ func (s *SMSGatewayController) PublishMillionMessages(c *gin.Context) {
 	startTime := time.Now()
 	log.Printf("Starting to publish %d messages to queue %s with priority %d", totalMessages, queueName, priority)
 
-	for i := 0; i < totalMessages; i++ {
-		// Create a unique MsgID for each message
-		msg := baseMsg
-		msg.MsgID = fmt.Sprintf("20250321%010d", i) // Unique ID: 202503210000000001 to 20250321000999999
-
-		// Marshal to JSON for RabbitMQ
-		msgBytes, err := json.Marshal(msg)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to marshal message %d: %v", i, err)})
-			return
-		}
-
-		// Publish to RabbitMQ
-		err = s.RabbitMQ.PublishWithPriority(queueName, msgBytes, priority)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to publish message %d: %v", i, err)})
-			return
-		}
+	// Publish from several workers so the channel pool is used concurrently
+	var (
+		next      int64 = -1
+		published int64
+		firstErr  error
+		errOnce   sync.Once
+		stop      = make(chan struct{})
+		wg        sync.WaitGroup
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			close(stop)
+		})
+	}
+	writeAPI := s.InfluxClient.WriteAPIBlocking(s.Config.InfluxDBOrg, s.Config.InfluxDBBucket)
 
-		// Log to InfluxDB
-		writeAPI := s.InfluxClient.WriteAPIBlocking(s.Config.InfluxDBOrg, s.Config.InfluxDBBucket)
-		point := influxdb2.NewPoint("sms_delivery",
-			map[string]string{
-				"msg_id": msg.MsgID,
-				"type":   msg.Type,
-				"mno":    msg.MNO,
-				"msisdn": msg.MSISDN,
-				"text":   msg.Text,
-				"status": msg.Status,
-			},
-			map[string]interface{}{
-				"retry_count":           0,
-				"queue_time":            time.Now().UnixMilli(),
-				"carrier_response_time": 0,
-			},
-			time.Now())
-
-		if err := writeAPI.WritePoint(context.Background(), point); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to write message %d to InfluxDB: %v", i, err)})
-			return
-		}
+	for w := 0; w < publishWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				i := atomic.AddInt64(&next, 1)
+				if i >= totalMessages {
+					return
+				}
+
+				// Create a unique MsgID for each message
+				msg := baseMsg
+				msg.MsgID = msgid.New()
+
+				// Marshal to JSON for RabbitMQ
+				msgBytes, err := json.Marshal(msg)
+				if err != nil {
+					fail(fmt.Errorf("Failed to marshal message %d: %v", i, err))
+					return
+				}
+
+				// Publish to RabbitMQ
+				if err := s.RabbitMQ.PublishWithPriority(queueName, msgBytes, priority); err != nil {
+					fail(fmt.Errorf("Failed to publish message %d: %v", i, err))
+					return
+				}
+
+				// Log to InfluxDB
+				if err := writeAPI.WritePoint(context.Background(), newDeliveryPoint(msg)); err != nil {
+					fail(fmt.Errorf("Failed to write message %d to InfluxDB: %v", i, err))
+					return
+				}
+
+				// Log progress every batchSize messages
+				if done := atomic.AddInt64(&published, 1); done%batchSize == 0 {
+					elapsed := time.Since(startTime)
+					log.Printf("Published %d of %d messages (%.2f%%) to queue and InfluxDB in %v", done, totalMessages, float64(done)/float64(totalMessages)*100, elapsed)
+				}
+			}
+		}()
+	}
+	wg.Wait()
 
-		// Log progress every batchSize messages
-		if (i+1)%batchSize == 0 {
-			elapsed := time.Since(startTime)
-			log.Printf("Published %d of %d messages (%.2f%%) to queue and InfluxDB in %v", i+1, totalMessages, float64(i+1)/float64(totalMessages)*100, elapsed)
-		}
+	if firstErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": firstErr.Error(), "published": atomic.LoadInt64(&published)})
+		return
 	}
 
 	// Calculate and log total time taken
@@ -224,8 +478,17 @@ func (s *SMSGatewayController) PublishMillionMessages(c *gin.Context) {
 	})
 }
 
+// GetRabbitMQStatistics returns cluster-wide RabbitMQ statistics
+// @Summary RabbitMQ cluster statistics
+// @Description Returns every cluster node with its alarms, partitions and running state, and the queues with their quorum leader and members. Results are cached for a few seconds.
+// @Tags SMS Gateway
+// @Produce json
+// @Param vhost query string false "Only queues of this vhost"
+// @Success 200 {object} rabbitmq.Statistics
+// @Failure 500 {object} map[string]interface{}
+// @Router /sms/rabbitmq-stats [get]
 func (s *SMSGatewayController) GetRabbitMQStatistics(c *gin.Context) {
-	stats, err := s.RabbitMQ.GetStatistics()
+	stats, err := s.RabbitMQ.GetStatistics(c.Query("vhost"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to retrieve RabbitMQ statistics: %v", err)})
 		return
@@ -234,21 +497,123 @@ func (s *SMSGatewayController) GetRabbitMQStatistics(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
-// getMNO determines the carrier based on MSISDN prefix
-func getMNO(prefix string) string {
-	switch prefix {
-	case "018":
-		return "Robi"
-	case "017":
-		return "GP"
-	case "016":
-		return "Airtel"
-	default:
-		return ""
+// callerApp identifies the calling application used to scope client request IDs
+func callerApp(c *gin.Context) string {
+	if userID, exists := c.Get("userID"); exists {
+		return fmt.Sprint(userID)
+	}
+	return "anonymous"
+}
+
+// completeRequestID records the queued message for a client request ID
+func (s *SMSGatewayController) completeRequestID(ctx context.Context, app, requestID string, payload MessagePayload) {
+	if requestID == "" {
+		return
+	}
+	record := idempotency.Record{MsgID: payload.MsgID, Status: payload.Status}
+	if err := s.Idempotency.Complete(ctx, app, requestID, record); err != nil {
+		log.Printf("Failed to store request_id %s for msg_id %s: %v", requestID, payload.MsgID, err)
+	}
+}
+
+// releaseRequestID frees a client request ID whose message was not queued
+func (s *SMSGatewayController) releaseRequestID(ctx context.Context, app, requestID string) {
+	if requestID == "" {
+		return
+	}
+	if err := s.Idempotency.Release(ctx, app, requestID); err != nil {
+		log.Printf("Failed to release request_id %s: %v", requestID, err)
 	}
 }
 
-// generateMsgID generates a unique message ID
-func generateMsgID() string {
-	return time.Now().Format("20060102150405") + fmt.Sprint(rand.Intn(100000))
+// validateSMS checks an SMS request, normalizes its MSISDN to the local form and
+// resolves the carrier and message type routing
+func validateSMS(smsReq *SMSRequest) (routing.Route, routing.TypeRoute, error) {
+	number, err := msisdn.Normalize(smsReq.MSISDN)
+	if err != nil {
+		return routing.Route{}, routing.TypeRoute{}, err
+	}
+	smsReq.MSISDN = number
+
+	if smsReq.SMSText == "" {
+		return routing.Route{}, routing.TypeRoute{}, errors.New("SMS text must not be empty")
+	}
+	if info := smsencoding.Analyze(smsReq.SMSText); info.Segments > smsencoding.MaxSegments {
+		return routing.Route{}, routing.TypeRoute{}, fmt.Errorf("SMS text must not exceed %d segments", smsencoding.MaxSegments)
+	}
+
+	if err := idempotency.ValidateKey(smsReq.RequestID); err != nil {
+		return routing.Route{}, routing.TypeRoute{}, err
+	}
+
+	// Determine MNO from the configured prefix routing table
+	route, ok := routing.ResolveMNO(smsReq.MSISDN)
+	if !ok {
+		return routing.Route{}, routing.TypeRoute{}, errors.New("Invalid carrier prefix")
+	}
+
+	// Determine queue and priority from the configured message types
+	msgType := smsReq.Type
+	if msgType == "" {
+		msgType = routing.DefaultType
+	}
+	typeRoute, ok := routing.ResolveType(msgType)
+	if !ok {
+		return routing.Route{}, routing.TypeRoute{}, fmt.Errorf("Unknown message type: %s", msgType)
+	}
+	return route, typeRoute, nil
+}
+
+// isDNDBlocked reports whether a message type is DND filtered and the MSISDN is on the DND list
+func (s *SMSGatewayController) isDNDBlocked(ctx context.Context, msgType, number string) (bool, error) {
+	if !dnd.AppliesTo(s.Config.DNDMessageTypes, msgType) {
+		return false, nil
+	}
+	return dnd.IsBlocked(ctx, s.Redis, number)
+}
+
+// publish sends a message to the queue and priority configured for its type
+func (s *SMSGatewayController) publish(typeRoute routing.TypeRoute, message []byte) error {
+	if err := s.RabbitMQ.EnsureQueue(typeRoute.Queue); err != nil {
+		return err
+	}
+	return s.RabbitMQ.PublishWithPriority(typeRoute.Queue, message, typeRoute.Priority)
+}
+
+// newQueuedPayload builds the RabbitMQ payload for an accepted SMS request
+func newQueuedPayload(msgID string, smsReq SMSRequest, mno, msgType string) MessagePayload {
+	info := smsencoding.Analyze(smsReq.SMSText)
+	return MessagePayload{
+		Encoding:  string(info.Encoding),
+		Segments:  info.Segments,
+		MNO:       mno,
+		MsgID:     msgID,
+		MSISDN:    smsReq.MSISDN,
+		RequestID: smsReq.RequestID,
+		Status:    "queued",
+		Text:      smsReq.SMSText,
+		Type:      msgType,
+	}
+}
+
+// newDeliveryPoint builds the sms_delivery InfluxDB point recording a message and its status
+func newDeliveryPoint(payload MessagePayload) *write.Point {
+	return influxdb2.NewPoint("sms_delivery",
+		map[string]string{
+			"msg_id": payload.MsgID,
+			"type":   payload.Type,
+			"mno":    payload.MNO,
+			"msisdn": payload.MSISDN,
+			"text":   payload.Text,
+			"status": payload.Status,
+		},
+		map[string]interface{}{
+			"retry_count":           0,
+			"queue_time":            time.Now().UnixMilli(),
+			"carrier_response_time": 0,
+			"request_id":            payload.RequestID,
+			"encoding":              payload.Encoding,
+			"segments":              payload.Segments,
+		},
+		time.Now())
 }
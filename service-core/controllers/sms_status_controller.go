@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"fmt"
+	"myproject/msgid"
+	"myproject/msisdn"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxStatusWindow is the widest time range accepted by the MSISDN history lookup
+	maxStatusWindow = 31 * 24 * time.Hour
+	// legacyStatusWindow is how far back the status of a message ID without a timestamp is looked up
+	legacyStatusWindow = maxStatusWindow
+	// defaultHistoryLimit is the number of messages returned when no limit is given
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// SMSStatusEvent is one recorded step in the lifecycle of a message
+type SMSStatusEvent struct {
+	Status      string    `json:"status"`
+	Time        time.Time `json:"time"`
+	Source      string    `json:"source"`
+	Instance    string    `json:"instance,omitempty"`
+	Segment     int       `json:"segment,omitempty"`
+	RetryCount  int64     `json:"retry_count"`
+	ProcessTime int64     `json:"processing_time_ms,omitempty"`
+}
+
+// SMSStatusResponse is the full lifecycle of a message
+type SMSStatusResponse struct {
+	MsgID      string           `json:"msg_id"`
+	MSISDN     string           `json:"msisdn,omitempty"`
+	MNO        string           `json:"mno,omitempty"`
+	Type       string           `json:"type,omitempty"`
+	Status     string           `json:"status"`
+	RetryCount int64            `json:"retry_count"`
+	QueuedAt   *time.Time       `json:"queued_at,omitempty"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+	Events     []SMSStatusEvent `json:"events"`
+}
+
+// SMSHistoryItem summarizes one message sent to an MSISDN
+type SMSHistoryItem struct {
+	MsgID     string    `json:"msg_id"`
+	MNO       string    `json:"mno"`
+	Type      string    `json:"type"`
+	Status    string    `json:"status"`
+	QueuedAt  time.Time `json:"queued_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetSMSStatus returns the lifecycle of a message
+// @Summary Get SMS status by message ID
+// @Description Returns every recorded status of a message (queued, submitted, delivered, failed) with timestamps and retry count
+// @Tags SMS Gateway
+// @Produce json
+// @Param msg_id path string true "Message ID"
+// @Success 200 {object} SMSStatusResponse
+// @Failure 404 {object} map[string]string "Message not found"
+// @Failure 500 {object} map[string]string "Failed to query InfluxDB"
+// @Router /sms/{msg_id} [get]
+func (s *SMSGatewayController) GetSMSStatus(c *gin.Context) {
+	msgID := c.Param("msg_id")
+
+	// Message IDs carry their creation time, which bounds the query range; IDs issued before
+	// snowflake IDs are looked up over the last legacyStatusWindow
+	start := time.Now().Add(-legacyStatusWindow)
+	if createdAt, err := msgid.Time(msgID); err == nil {
+		start = createdAt.Add(-time.Minute)
+	}
+
+	flux := fmt.Sprintf(`from(bucket: %s)
+  |> range(start: %s)
+  |> filter(fn: (r) => r._measurement == "sms_delivery" or r._measurement == "final_sms_delivery" or r._measurement == "sms_segment")
+  |> filter(fn: (r) => r.msg_id == %s)
+  |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")`,
+		fluxString(s.Config.InfluxDBBucket), start.Format(time.RFC3339), fluxString(msgID))
+
+	result, err := s.InfluxClient.QueryAPI(s.Config.InfluxDBOrg).Query(c, flux)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query InfluxDB"})
+		return
+	}
+	defer result.Close()
+
+	status := SMSStatusResponse{MsgID: msgID, Events: []SMSStatusEvent{}}
+	for result.Next() {
+		record := result.Record()
+		event := SMSStatusEvent{
+			Status:      recordString(record.ValueByKey("status")),
+			Time:        record.Time(),
+			Source:      record.Measurement(),
+			Instance:    recordString(record.ValueByKey("instance")),
+			RetryCount:  recordInt(record.ValueByKey("retry_count")),
+			ProcessTime: recordInt(record.ValueByKey("processing_time_ms")),
+		}
+		if record.Measurement() == "sms_segment" {
+			event.Segment = int(recordInt(record.ValueByKey("seq")))
+		}
+		if record.Measurement() == "sms_delivery" {
+			status.MSISDN = recordString(record.ValueByKey("msisdn"))
+			status.Type = recordString(record.ValueByKey("type"))
+			if status.QueuedAt == nil {
+				queuedAt := record.Time()
+				status.QueuedAt = &queuedAt
+			}
+		}
+		if mno := recordString(record.ValueByKey("mno")); mno != "" {
+			status.MNO = mno
+		}
+		status.Events = append(status.Events, event)
+	}
+	if result.Err() != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query InfluxDB"})
+		return
+	}
+
+	if len(status.Events) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	sort.SliceStable(status.Events, func(i, j int) bool {
+		return status.Events[i].Time.Before(status.Events[j].Time)
+	})
+	for _, event := range status.Events {
+		if event.RetryCount > status.RetryCount {
+			status.RetryCount = event.RetryCount
+		}
+	}
+	latest := status.Events[len(status.Events)-1]
+	status.Status = latest.Status
+	status.UpdatedAt = latest.Time
+
+	c.JSON(http.StatusOK, status)
+}
+
+// GetSMSByMSISDN lists the messages sent to one MSISDN in a time window
+// @Summary List SMS messages sent to an MSISDN
+// @Description Lists messages sent to an MSISDN between from and to (RFC3339, default the last 24 hours) with their latest status
+// @Tags SMS Gateway
+// @Produce json
+// @Param msisdn query string true "MSISDN in local or international form"
+// @Param from query string false "Start of the window (RFC3339)"
+// @Param to query string false "End of the window (RFC3339)"
+// @Param limit query int false "Maximum number of messages" default(100)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string "Invalid MSISDN or time window"
+// @Failure 500 {object} map[string]string "Failed to query InfluxDB"
+// @Router /sms [get]
+func (s *SMSGatewayController) GetSMSByMSISDN(c *gin.Context) {
+	number, err := msisdn.Normalize(c.Query("msisdn"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, expected RFC3339"})
+			return
+		}
+	}
+	from := to.Add(-24 * time.Hour)
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected RFC3339"})
+			return
+		}
+	}
+	if !from.Before(to) || to.Sub(from) > maxStatusWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to and the window must not exceed 31 days"})
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxHistoryLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit)})
+			return
+		}
+	}
+
+	bucket := fluxString(s.Config.InfluxDBBucket)
+	window := fmt.Sprintf("range(start: %s, stop: %s)", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	queryAPI := s.InfluxClient.QueryAPI(s.Config.InfluxDBOrg)
+
+	// Messages accepted for the MSISDN, newest first
+	flux := fmt.Sprintf(`from(bucket: %s)
+  |> %s
+  |> filter(fn: (r) => r._measurement == "sms_delivery" and r.msisdn == %s and r._field == "queue_time")
+  |> group()
+  |> sort(columns: ["_time"], desc: true)
+  |> limit(n: %d)`, bucket, window, fluxString(number), limit)
+
+	result, err := queryAPI.Query(c, flux)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query InfluxDB"})
+		return
+	}
+	defer result.Close()
+
+	items := []SMSHistoryItem{}
+	index := make(map[string]int)
+	for result.Next() {
+		record := result.Record()
+		msgID := recordString(record.ValueByKey("msg_id"))
+		if _, seen := index[msgID]; seen {
+			continue
+		}
+		index[msgID] = len(items)
+		items = append(items, SMSHistoryItem{
+			MsgID:     msgID,
+			MNO:       recordString(record.ValueByKey("mno")),
+			Type:      recordString(record.ValueByKey("type")),
+			Status:    recordString(record.ValueByKey("status")),
+			QueuedAt:  record.Time(),
+			UpdatedAt: record.Time(),
+		})
+	}
+	if result.Err() != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query InfluxDB"})
+		return
+	}
+
+	// Latest delivery outcome recorded by the consumers for those messages
+	if len(items) > 0 {
+		ids := make([]string, 0, len(items))
+		for _, item := range items {
+			ids = append(ids, fluxString(item.MsgID))
+		}
+
+		flux = fmt.Sprintf(`from(bucket: %s)
+  |> range(start: %s)
+  |> filter(fn: (r) => r._measurement == "final_sms_delivery" and contains(value: r.msg_id, set: [%s]))
+  |> group(columns: ["msg_id"])
+  |> last(column: "_time")`, bucket, from.Format(time.RFC3339), strings.Join(ids, ", "))
+
+		finals, err := queryAPI.Query(c, flux)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query InfluxDB"})
+			return
+		}
+		defer finals.Close()
+
+		for finals.Next() {
+			record := finals.Record()
+			i, ok := index[recordString(record.ValueByKey("msg_id"))]
+			if !ok || record.Time().Before(items[i].UpdatedAt) {
+				continue
+			}
+			items[i].Status = recordString(record.ValueByKey("status"))
+			items[i].UpdatedAt = record.Time()
+		}
+		if finals.Err() != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query InfluxDB"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"msisdn":   number,
+		"from":     from,
+		"to":       to,
+		"count":    len(items),
+		"messages": items,
+	})
+}
+
+// fluxString quotes a value as a Flux string literal
+func fluxString(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`).Replace(value) + `"`
+}
+
+func recordString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return ""
+}
+
+func recordInt(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case uint64:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
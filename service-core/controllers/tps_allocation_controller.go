@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"myproject/models"
+	"myproject/routing"
+	"myproject/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// allocatedShare sums the TPS shares of a channel, leaving out the allocation being updated
+func allocatedShare(db *gorm.DB, channelID uint, exclude uuid.UUID) (int, error) {
+	var total int
+	err := db.Model(&models.ChannelTPSAllocation{}).
+		Where("channel_id = ? AND id <> ?", channelID, exclude).
+		Select("COALESCE(SUM(share_percent), 0)").Scan(&total).Error
+	return total, err
+}
+
+// sharePercent reads a share_percent value, which must be a whole percentage so that no TPS is lost to truncation
+func sharePercent(value interface{}) (int, bool) {
+	share, ok := value.(float64)
+	if !ok || share != math.Trunc(share) {
+		return 0, false
+	}
+	return int(share), true
+}
+
+// validateAllocation checks that the message type is not allocated twice on the channel
+// and that the channel's shares add up to at most 100 percent
+func validateAllocation(db *gorm.DB, allocation models.ChannelTPSAllocation) (int, error) {
+	if allocation.Share_Percent < 1 || allocation.Share_Percent > 100 {
+		return http.StatusBadRequest, errors.New("share_percent must be between 1 and 100")
+	}
+
+	var count int64
+	if err := db.Model(&models.ChannelTPSAllocation{}).
+		Where("channel_id = ? AND message_type = ? AND id <> ?", allocation.ChannelID, allocation.Message_Type, allocation.ID).
+		Count(&count).Error; err != nil {
+		return http.StatusInternalServerError, errors.New("Failed to check TPS allocations")
+	}
+	if count > 0 {
+		return http.StatusConflict, fmt.Errorf("message type %s already has a TPS allocation on this channel", allocation.Message_Type)
+	}
+
+	total, err := allocatedShare(db, allocation.ChannelID, allocation.ID)
+	if err != nil {
+		return http.StatusInternalServerError, errors.New("Failed to check TPS allocations")
+	}
+	if total+allocation.Share_Percent > 100 {
+		return http.StatusBadRequest, fmt.Errorf("share_percent exceeds the channel TPS, %d%% is left to allocate", 100-total)
+	}
+	return http.StatusOK, nil
+}
+
+// GetTPSAllocations retrieves the TPS allocations, optionally of one channel
+// @Summary Get TPS allocations
+// @Description Get the share of MNO channel TPS reserved for each SMS type, optionally filtered by channel
+// @Tags TPS Allocation
+// @Accept json
+// @Produce json
+// @Param channel_id query int false "MNO Channel ID"
+// @Success 200 {array} models.ChannelTPSAllocation
+// @Failure 500 {object} map[string]interface{}
+// @Router /tps_allocation [get]
+func GetTPSAllocations(c *gin.Context) {
+	db := utils.GetDB()
+	var allocations []models.ChannelTPSAllocation
+
+	query := db.Order("channel_id, share_percent DESC")
+	if channelID := c.Query("channel_id"); channelID != "" {
+		query = query.Where("channel_id = ?", channelID)
+	}
+	if err := query.Find(&allocations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch TPS allocations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, allocations)
+}
+
+// CreateTPSAllocation reserves a share of an MNO channel's TPS for an SMS type
+// @Summary Create a TPS allocation
+// @Description Reserve a percentage of an MNO channel's TPS for an SMS type. Higher priority types may borrow the unused share of lower priority types, never the reverse.
+// @Tags TPS Allocation
+// @Accept json
+// @Produce json
+// @Param input body map[string]interface{} true "TPS allocation details: channel_id, message_type, share_percent (a whole percentage)"
+// @Success 201 {object} models.ChannelTPSAllocation
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /tps_allocation [post]
+func CreateTPSAllocation(c *gin.Context) {
+	var input map[string]interface{}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	channelID, ok := input["channel_id"].(float64)
+	if !ok || channelID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel_id"})
+		return
+	}
+
+	messageType, ok := input["message_type"].(string)
+	if !ok || routing.NormalizeType(messageType) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message_type"})
+		return
+	}
+
+	share, ok := sharePercent(input["share_percent"])
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "share_percent must be a whole number"})
+		return
+	}
+
+	db := utils.GetDB()
+
+	var channel models.MnoChannels
+	if err := db.Where("channel_id = ?", uint(channelID)).First(&channel).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MNO channel not found"})
+		return
+	}
+
+	allocation := models.ChannelTPSAllocation{
+		ChannelID:     channel.ChannelID,
+		Message_Type:  routing.NormalizeType(messageType),
+		Share_Percent: share,
+	}
+	if status, err := validateAllocation(db, allocation); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.Create(&allocation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create TPS allocation"})
+		return
+	}
+
+	routing.RefreshMNORoutes()
+
+	c.JSON(http.StatusCreated, allocation)
+}
+
+// UpdateTPSAllocation updates an existing TPS allocation
+// @Summary Update a TPS allocation
+// @Description Update a TPS allocation by ID with optional fields: message type and share percent
+// @Tags TPS Allocation
+// @Accept json
+// @Produce json
+// @Param id path string true "TPS Allocation ID"
+// @Param input body map[string]interface{} true "TPS allocation details"
+// @Success 200 {object} models.ChannelTPSAllocation
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /tps_allocation/{id} [put]
+func UpdateTPSAllocation(c *gin.Context) {
+	var input map[string]interface{}
+
+	allocationID := c.Param("id")
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := utils.GetDB()
+	var allocation models.ChannelTPSAllocation
+
+	if err := db.Where("id = ?", allocationID).First(&allocation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "TPS allocation not found"})
+		return
+	}
+
+	if value, exists := input["message_type"]; exists {
+		messageType, ok := value.(string)
+		if !ok || routing.NormalizeType(messageType) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message_type"})
+			return
+		}
+		allocation.Message_Type = routing.NormalizeType(messageType)
+	}
+	if value, exists := input["share_percent"]; exists {
+		share, ok := sharePercent(value)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "share_percent must be a whole number"})
+			return
+		}
+		allocation.Share_Percent = share
+	}
+	if status, err := validateAllocation(db, allocation); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.Save(&allocation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update TPS allocation"})
+		return
+	}
+
+	routing.RefreshMNORoutes()
+
+	c.JSON(http.StatusOK, allocation)
+}
+
+// DeleteTPSAllocation deletes a TPS allocation, returning its share to the capacity shared by all types
+// @Summary Delete a TPS allocation
+// @Description Delete a TPS allocation by ID
+// @Tags TPS Allocation
+// @Accept json
+// @Produce json
+// @Param id path string true "TPS Allocation ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /tps_allocation/{id} [delete]
+func DeleteTPSAllocation(c *gin.Context) {
+	allocationID := c.Param("id")
+
+	db := utils.GetDB()
+	var allocation models.ChannelTPSAllocation
+
+	if err := db.Where("id = ?", allocationID).First(&allocation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "TPS allocation not found"})
+		return
+	}
+
+	if err := db.Delete(&allocation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete TPS allocation"})
+		return
+	}
+
+	routing.RefreshMNORoutes()
+
+	c.JSON(http.StatusOK, gin.H{"message": "TPS allocation deleted successfully"})
+}
+
+// GetTPSAllocationDetails retrieves a TPS allocation by ID
+// @Summary Get TPS allocation details
+// @Description Get details of a TPS allocation by ID
+// @Tags TPS Allocation
+// @Accept json
+// @Produce json
+// @Param id path string true "TPS Allocation ID"
+// @Success 200 {object} models.ChannelTPSAllocation
+// @Failure 404 {object} map[string]interface{}
+// @Router /tps_allocation/{id} [get]
+func GetTPSAllocationDetails(c *gin.Context) {
+	allocationID := c.Param("id")
+
+	db := utils.GetDB()
+	var allocation models.ChannelTPSAllocation
+
+	if err := db.Where("id = ?", allocationID).First(&allocation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "TPS allocation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, allocation)
+}
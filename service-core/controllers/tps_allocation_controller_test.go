@@ -0,0 +1,24 @@
+package controllers
+
+import "testing"
+
+func TestSharePercent(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  int
+		ok    bool
+	}{
+		{float64(33), 33, true},
+		{float64(100), 100, true},
+		{33.5, 0, false},
+		{0.1, 0, false},
+		{"33", 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := sharePercent(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("sharePercent(%v) = %d, %v, want %d, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package dlq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myproject/rabbitmq"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// MaxScan is the most messages read from a dead-letter queue by one operation
+const MaxScan = 10000
+
+// Headers added to replayed messages
+const (
+	ReplayedAtHeader  = "x-replayed-at"
+	ReplayCountHeader = "x-replay-count"
+)
+
+// ErrNotFound is returned when the dead-letter queue does not exist
+var ErrNotFound = errors.New("dead-letter queue not found")
+
+// Message is a parked message as shown to operators
+type Message struct {
+	MessageID  string                 `json:"message_id,omitempty"`
+	MsgID      string                 `json:"msg_id"`
+	MNO        string                 `json:"mno"`
+	Type       string                 `json:"type"`
+	MSISDN     string                 `json:"msisdn"`
+	Reason     string                 `json:"reason"`
+	RetryCount int                    `json:"retry_count"`
+	ParkedAt   *time.Time             `json:"parked_at,omitempty"`
+	Headers    map[string]interface{} `json:"headers"`
+	Payload    json.RawMessage        `json:"payload"`
+}
+
+// Filter selects parked messages. Empty fields match every message.
+type Filter struct {
+	MsgIDs []string
+	MNO    string
+	Type   string
+	From   time.Time
+	To     time.Time
+}
+
+// IsEmpty reports whether the filter matches every message
+func (f Filter) IsEmpty() bool {
+	return len(f.MsgIDs) == 0 && f.MNO == "" && f.Type == "" && f.From.IsZero() && f.To.IsZero()
+}
+
+// Matches reports whether a parked message is selected by the filter
+func (f Filter) Matches(m Message) bool {
+	if len(f.MsgIDs) > 0 {
+		found := false
+		for _, id := range f.MsgIDs {
+			if id == m.MsgID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.MNO != "" && !strings.EqualFold(f.MNO, m.MNO) {
+		return false
+	}
+	if f.Type != "" && !strings.EqualFold(f.Type, m.Type) {
+		return false
+	}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		if m.ParkedAt == nil {
+			return false
+		}
+		if !f.From.IsZero() && m.ParkedAt.Before(f.From) {
+			return false
+		}
+		if !f.To.IsZero() && m.ParkedAt.After(f.To) {
+			return false
+		}
+	}
+	return true
+}
+
+// Override changes where replayed messages are delivered
+type Override struct {
+	MNO       string
+	ChannelID uint
+}
+
+// Summary is the size of one dead-letter queue
+type Summary struct {
+	Queue      string `json:"queue"`
+	DeadLetter string `json:"dead_letter_queue"`
+	Messages   int    `json:"messages"`
+}
+
+// Browser inspects, replays and purges the dead-letter queues of the topology
+type Browser struct {
+	rmq *rabbitmq.RabbitMQ
+}
+
+// NewBrowser creates a Browser
+func NewBrowser(rmq *rabbitmq.RabbitMQ) *Browser {
+	return &Browser{rmq: rmq}
+}
+
+// Name returns the dead-letter queue of a queue
+func Name(queue string) string {
+	return queue + rabbitmq.DeadLetterSuffix
+}
+
+// Count returns the number of messages parked for a queue
+func (b *Browser) Count(queue string) (Summary, error) {
+	summary := Summary{Queue: queue, DeadLetter: Name(queue)}
+	ch, err := b.rmq.Channel()
+	if err != nil {
+		return summary, err
+	}
+	defer ch.Close()
+
+	state, err := ch.QueueDeclarePassive(summary.DeadLetter, true, false, false, false, nil)
+	if err != nil {
+		return summary, notFound(err)
+	}
+	summary.Messages = state.Messages
+	return summary, nil
+}
+
+// List returns up to limit parked messages of a queue selected by the filter.
+// Messages are read without being acked and return to the queue when the channel closes; dead-letter
+// queues have no delivery limit, so browsing never drops them.
+func (b *Browser) List(queue string, filter Filter, limit int) ([]Message, error) {
+	messages := []Message{}
+	err := b.scan(queue, func(ch *amqp.Channel, delivery amqp.Delivery, message Message) (bool, error) {
+		if filter.Matches(message) {
+			messages = append(messages, message)
+		}
+		return len(messages) < limit, nil
+	})
+	return messages, err
+}
+
+// Replay publishes the selected parked messages back to their queue with a fresh retry count
+// and removes them from the dead-letter queue once the broker confirmed them.
+func (b *Browser) Replay(queue string, filter Filter, override Override) (int, error) {
+	replayed := 0
+	err := b.scan(queue, func(ch *amqp.Channel, delivery amqp.Delivery, message Message) (bool, error) {
+		if !filter.Matches(message) {
+			return true, nil
+		}
+
+		body, err := applyOverride(delivery.Body, override)
+		if err != nil {
+			return false, fmt.Errorf("failed to rewrite message %s: %v", message.MsgID, err)
+		}
+
+		confirmation, err := ch.PublishWithDeferredConfirm("", queue, false, false, amqp.Publishing{
+			Headers:      replayHeaders(delivery.Headers),
+			ContentType:  delivery.ContentType,
+			Body:         body,
+			DeliveryMode: amqp.Persistent,
+			Priority:     delivery.Priority,
+			MessageId:    delivery.MessageId,
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to replay message %s: %v", message.MsgID, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), rabbitmq.ConfirmTimeout)
+		acked, err := confirmation.WaitContext(ctx)
+		cancel()
+		if err != nil || !acked {
+			return false, fmt.Errorf("replay of message %s was not confirmed", message.MsgID)
+		}
+
+		if err := delivery.Ack(false); err != nil {
+			return false, err
+		}
+		replayed++
+		return true, nil
+	})
+	return replayed, err
+}
+
+// Purge deletes the selected parked messages of a queue. An empty filter purges the whole queue.
+func (b *Browser) Purge(queue string, filter Filter) (int, error) {
+	if filter.IsEmpty() {
+		ch, err := b.rmq.Channel()
+		if err != nil {
+			return 0, err
+		}
+		defer ch.Close()
+
+		purged, err := ch.QueuePurge(Name(queue), false)
+		return purged, notFound(err)
+	}
+
+	purged := 0
+	err := b.scan(queue, func(ch *amqp.Channel, delivery amqp.Delivery, message Message) (bool, error) {
+		if !filter.Matches(message) {
+			return true, nil
+		}
+		if err := delivery.Ack(false); err != nil {
+			return false, err
+		}
+		purged++
+		return true, nil
+	})
+	return purged, err
+}
+
+// scan reads the dead-letter queue of queue on a dedicated confirm-mode channel until it is empty,
+// MaxScan messages were read or fn returns false. Messages fn does not ack are requeued on return.
+func (b *Browser) scan(queue string, fn func(ch *amqp.Channel, delivery amqp.Delivery, message Message) (bool, error)) error {
+	ch, err := b.rmq.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	if err := ch.Confirm(false); err != nil {
+		return fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+
+	for i := 0; i < MaxScan; i++ {
+		delivery, ok, err := ch.Get(Name(queue), false)
+		if err != nil {
+			return notFound(err)
+		}
+		if !ok {
+			return nil
+		}
+
+		more, err := fn(ch, delivery, parse(delivery))
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
+
+// parse extracts the message fields and failure details of a parked delivery
+func parse(delivery amqp.Delivery) Message {
+	message := Message{
+		MessageID:  delivery.MessageId,
+		RetryCount: rabbitmq.RetryCount(delivery.Headers),
+		Headers:    map[string]interface{}(delivery.Headers),
+		Payload:    json.RawMessage(delivery.Body),
+	}
+	if message.Headers == nil {
+		message.Headers = map[string]interface{}{}
+	}
+	if !json.Valid(delivery.Body) {
+		message.Payload, _ = json.Marshal(string(delivery.Body))
+	}
+
+	var payload struct {
+		MsgID  string `json:"msg_id"`
+		MNO    string `json:"mno"`
+		Type   string `json:"type"`
+		MSISDN string `json:"msisdn"`
+	}
+	if err := json.Unmarshal(delivery.Body, &payload); err == nil {
+		message.MsgID = payload.MsgID
+		message.MNO = payload.MNO
+		message.Type = payload.Type
+		message.MSISDN = payload.MSISDN
+	}
+
+	// Messages parked by the consumers carry the reason, the broker records x-death for
+	// messages dead-lettered by TTL, rejection or the delivery limit
+	if reason, ok := delivery.Headers[rabbitmq.FailureReasonHeader].(string); ok {
+		message.Reason = reason
+	}
+	if value, ok := delivery.Headers[rabbitmq.ParkedAtHeader].(string); ok {
+		if parkedAt, err := time.Parse(time.RFC3339, value); err == nil {
+			message.ParkedAt = &parkedAt
+		}
+	}
+	if deaths, ok := delivery.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		if death, ok := deaths[0].(amqp.Table); ok {
+			if reason, ok := death["reason"].(string); ok && message.Reason == "" {
+				message.Reason = reason
+			}
+			if diedAt, ok := death["time"].(time.Time); ok && message.ParkedAt == nil {
+				message.ParkedAt = &diedAt
+			}
+		}
+	}
+	return message
+}
+
+// applyOverride points a message at another operator or channel, keeping every other field
+func applyOverride(body []byte, override Override) ([]byte, error) {
+	if override.MNO == "" && override.ChannelID == 0 {
+		return body, nil
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if override.MNO != "" {
+		payload["mno"] = override.MNO
+	}
+	if override.ChannelID != 0 {
+		payload["channel_id"] = override.ChannelID
+	}
+	return json.Marshal(payload)
+}
+
+// replayHeaders drops the retry and dead-letter history so the message gets its full retry budget again
+func replayHeaders(headers amqp.Table) amqp.Table {
+	replayed := amqp.Table{}
+	for key, value := range headers {
+		switch {
+		case key == rabbitmq.RetryCountHeader, key == rabbitmq.FailureReasonHeader, key == rabbitmq.ParkedAtHeader:
+		case key == "x-death", strings.HasPrefix(key, "x-first-death-"), strings.HasPrefix(key, "x-last-death-"):
+		default:
+			replayed[key] = value
+		}
+	}
+
+	count := int32(1)
+	if previous, ok := headers[ReplayCountHeader].(int32); ok {
+		count = previous + 1
+	}
+	replayed[ReplayCountHeader] = count
+	replayed[ReplayedAtHeader] = time.Now().UTC().Format(time.RFC3339)
+	return replayed
+}
+
+// notFound maps the broker's NOT_FOUND channel error to ErrNotFound
+func notFound(err error) error {
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+package dlq
+
+import (
+	"encoding/json"
+	"errors"
+	"myproject/rabbitmq"
+	"reflect"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestFilterMatches(t *testing.T) {
+	parkedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	message := Message{MsgID: "42", MNO: "GP", Type: "otp", ParkedAt: &parkedAt}
+	tests := []struct {
+		name    string
+		filter  Filter
+		message Message
+		want    bool
+	}{
+		{"empty", Filter{}, message, true},
+		{"message ID", Filter{MsgIDs: []string{"7", "42"}}, message, true},
+		{"other message IDs", Filter{MsgIDs: []string{"7"}}, message, false},
+		{"MNO ignores case", Filter{MNO: "gp"}, message, true},
+		{"other MNO", Filter{MNO: "robi"}, message, false},
+		{"type ignores case", Filter{Type: "OTP"}, message, true},
+		{"other type", Filter{Type: "promotional"}, message, false},
+		{"within range", Filter{From: parkedAt.Add(-time.Hour), To: parkedAt.Add(time.Hour)}, message, true},
+		{"range bounds are inclusive", Filter{From: parkedAt, To: parkedAt}, message, true},
+		{"before range", Filter{From: parkedAt.Add(time.Minute)}, message, false},
+		{"after range", Filter{To: parkedAt.Add(-time.Minute)}, message, false},
+		{"range without parked time", Filter{From: parkedAt}, Message{MsgID: "42"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(tt.message); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+			if tt.filter.IsEmpty() != (tt.name == "empty") {
+				t.Errorf("IsEmpty() = %v", tt.filter.IsEmpty())
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	parkedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	diedAt := parkedAt.Add(time.Hour)
+	body := []byte(`{"msg_id":"42","mno":"gp","type":"otp","msisdn":"01712345678","message":"hi"}`)
+	tests := []struct {
+		name     string
+		delivery amqp.Delivery
+		want     Message
+	}{
+		{"parked by a consumer", amqp.Delivery{MessageId: "m-1", Body: body, Headers: amqp.Table{
+			rabbitmq.RetryCountHeader:    int32(3),
+			rabbitmq.FailureReasonHeader: "operator returned 500",
+			rabbitmq.ParkedAtHeader:      parkedAt.Format(time.RFC3339),
+		}}, Message{
+			MessageID: "m-1", MsgID: "42", MNO: "gp", Type: "otp", MSISDN: "01712345678",
+			Reason: "operator returned 500", RetryCount: 3, ParkedAt: &parkedAt,
+		}},
+		{"dead-lettered by the broker", amqp.Delivery{Body: body, Headers: amqp.Table{
+			"x-death": []interface{}{amqp.Table{"reason": "expired", "time": diedAt}},
+		}}, Message{MsgID: "42", MNO: "gp", Type: "otp", MSISDN: "01712345678", Reason: "expired", ParkedAt: &diedAt}},
+		{"not JSON", amqp.Delivery{Body: []byte("garbage")}, Message{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parse(tt.delivery)
+			if got.Headers == nil {
+				t.Error("Headers is nil")
+			}
+			if !json.Valid(got.Payload) {
+				t.Errorf("Payload %s is not JSON", got.Payload)
+			}
+			got.Headers, got.Payload = nil, nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOverride(t *testing.T) {
+	body := []byte(`{"msg_id":"42","mno":"gp","channel_id":3,"message":"hi"}`)
+	tests := []struct {
+		name     string
+		override Override
+		want     map[string]interface{}
+	}{
+		{"none", Override{}, map[string]interface{}{"msg_id": "42", "mno": "gp", "channel_id": 3.0, "message": "hi"}},
+		{"MNO", Override{MNO: "robi"}, map[string]interface{}{"msg_id": "42", "mno": "robi", "channel_id": 3.0, "message": "hi"}},
+		{"channel", Override{ChannelID: 7}, map[string]interface{}{"msg_id": "42", "mno": "gp", "channel_id": 7.0, "message": "hi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := applyOverride(body, tt.override)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyOverride() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := applyOverride([]byte("garbage"), Override{MNO: "robi"}); err == nil {
+		t.Error("applyOverride() rewrote a body that is not JSON")
+	}
+}
+
+func TestReplayHeaders(t *testing.T) {
+	headers := amqp.Table{
+		"x-trace-id":                 "abc",
+		rabbitmq.RetryCountHeader:    int32(3),
+		rabbitmq.FailureReasonHeader: "failed",
+		rabbitmq.ParkedAtHeader:      "2025-03-01T12:00:00Z",
+		rabbitmq.OriginalQueueHeader: "otp",
+		"x-death":                    []interface{}{},
+		"x-first-death-reason":       "rejected",
+		"x-last-death-queue":         "otp",
+	}
+	got := replayHeaders(headers)
+	if got[ReplayedAtHeader] == nil {
+		t.Error("no replay time")
+	}
+	delete(got, ReplayedAtHeader)
+	want := amqp.Table{"x-trace-id": "abc", rabbitmq.OriginalQueueHeader: "otp", ReplayCountHeader: int32(1)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replayHeaders() = %v, want %v", got, want)
+	}
+
+	if count := replayHeaders(amqp.Table{ReplayCountHeader: int32(2)})[ReplayCountHeader]; count != int32(3) {
+		t.Errorf("replay count = %v, want 3", count)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	if err := notFound(&amqp.Error{Code: amqp.NotFound}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("notFound(NOT_FOUND) = %v, want ErrNotFound", err)
+	}
+	other := &amqp.Error{Code: amqp.AccessRefused}
+	if err := notFound(other); err != other {
+		t.Errorf("notFound(ACCESS_REFUSED) = %v", err)
+	}
+	if err := notFound(nil); err != nil {
+		t.Errorf("notFound(nil) = %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package dlr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"myproject/models"
+	"myproject/rabbitmq"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+)
+
+const (
+	dispatchWorkers = 10
+	callbackTimeout = 10 * time.Second
+	reconnectDelay  = 5 * time.Second
+)
+
+// Dispatcher posts delivery receipts from QueueName to the registered webhooks
+type Dispatcher struct {
+	db     *gorm.DB
+	rmq    *rabbitmq.RabbitMQ
+	client *http.Client
+}
+
+// NewDispatcher creates a Dispatcher
+func NewDispatcher(db *gorm.DB, rmq *rabbitmq.RabbitMQ) *Dispatcher {
+	return &Dispatcher{
+		db:     db,
+		rmq:    rmq,
+		client: newCallbackClient(callbackTimeout),
+	}
+}
+
+// Run consumes receipts until ctx is cancelled, reopening the channel when it closes
+func (d *Dispatcher) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := d.consume(ctx); err != nil {
+			log.Printf("DLR dispatcher stopped: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (d *Dispatcher) consume(ctx context.Context) error {
+	ch, err := d.rmq.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	if err := DeclareQueues(ch); err != nil {
+		return err
+	}
+	if err := ch.Qos(dispatchWorkers*2, 0, false); err != nil {
+		return fmt.Errorf("qos failed: %v", err)
+	}
+	// Retries are published on the consuming channel, so it confirms them before the receipt is acked
+	if err := ch.Confirm(false); err != nil {
+		return fmt.Errorf("confirm mode failed: %v", err)
+	}
+	deliveries, err := ch.Consume(QueueName, "", false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("consume failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < dispatchWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case delivery, ok := <-deliveries:
+					if !ok {
+						return
+					}
+					d.handle(ctx, ch, delivery)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return errors.New("delivery channel closed")
+}
+
+func (d *Dispatcher) handle(ctx context.Context, ch *amqp.Channel, delivery amqp.Delivery) {
+	var event Event
+	if err := json.Unmarshal(delivery.Body, &event); err != nil {
+		log.Printf("Dropping malformed DLR: %v", err)
+		delivery.Ack(false)
+		return
+	}
+	if event.Attempt < 1 {
+		event.Attempt = 1
+	}
+
+	var webhook models.DLRWebhook
+	err := d.db.Where("app = ? AND active = ?", event.App, true).First(&webhook).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		delivery.Ack(false)
+		return
+	}
+	if err != nil {
+		// Wait in the shortest delay queue rather than requeueing straight back while the database is down
+		log.Printf("Failed to load DLR webhook for %s: %v", event.App, err)
+		if err := Publish(ch, RetryQueue(1), event); err != nil {
+			log.Printf("Failed to delay DLR for %s: %v", event.MsgID, err)
+			delivery.Nack(false, true)
+			return
+		}
+		delivery.Ack(false)
+		return
+	}
+
+	attempt := models.DLRAttempt{
+		WebhookID: webhook.ID,
+		App:       event.App,
+		MsgID:     event.MsgID,
+		Status:    event.Status,
+		Attempt:   event.Attempt,
+	}
+	// Webhooks registered before callback URLs were restricted are given up without posting
+	retryable := true
+	if err := ValidateCallbackURL(webhook.CallbackURL); err != nil {
+		attempt.Error = err.Error()
+		retryable = false
+	} else if attempt.ResponseCode, err = d.post(ctx, webhook, event); err != nil {
+		attempt.Error = err.Error()
+		retryable = !errors.Is(err, ErrPrivateTarget)
+	} else {
+		attempt.Delivered = true
+	}
+
+	// Failed receipts wait in the delay queue for their attempt before coming back
+	if !attempt.Delivered && retryable && event.Attempt < MaxAttempts {
+		retryAt := time.Now().Add(Backoff(event.Attempt))
+		attempt.NextRetryAt = &retryAt
+
+		retry := event
+		retry.Attempt++
+		if err := Publish(ch, RetryQueue(event.Attempt), retry); err != nil {
+			log.Printf("Failed to schedule DLR retry for %s: %v", event.MsgID, err)
+			delivery.Nack(false, true)
+			return
+		}
+	}
+
+	if err := d.db.Create(&attempt).Error; err != nil {
+		log.Printf("Failed to record DLR attempt for %s: %v", event.MsgID, err)
+	}
+	if !attempt.Delivered && attempt.NextRetryAt == nil {
+		log.Printf("Giving up DLR for %s to %s after %d attempts", event.MsgID, webhook.CallbackURL, event.Attempt)
+	}
+	delivery.Ack(false)
+}
+
+// post sends a signed receipt and returns the HTTP status of the callback
+func (d *Dispatcher) post(ctx context.Context, webhook models.DLRWebhook, event Event) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+	req.Header.Set(AttemptHeader, strconv.Itoa(event.Attempt))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
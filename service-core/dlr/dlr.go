@@ -0,0 +1,158 @@
+package dlr
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"myproject/dnd"
+	"myproject/models"
+	"myproject/rabbitmq"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// QueueName is the queue consumers publish delivery receipts to
+const QueueName = "dlr"
+
+// AppsKey is the Redis set holding every client application with an active webhook
+const AppsKey = "dlr:apps"
+
+// Terminal message statuses reported to client applications
+const (
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+	StatusExpired   = "expired"
+)
+
+// Headers sent with every callback
+const (
+	SignatureHeader = "X-DLR-Signature"
+	TimestampHeader = "X-DLR-Timestamp"
+	AttemptHeader   = "X-DLR-Attempt"
+)
+
+// MaxAttempts is the number of times a receipt is posted before it is given up
+const MaxAttempts = 6
+
+// BaseBackoff is the delay before the first retry, doubled for every following one
+const BaseBackoff = 30 * time.Second
+
+// Event is the delivery receipt posted to the callback URL of a client application
+type Event struct {
+	MsgID     string    `json:"msg_id"`
+	RequestID string    `json:"request_id,omitempty"`
+	App       string    `json:"app"`
+	MSISDN    string    `json:"msisdn"`
+	MNO       string    `json:"mno"`
+	Type      string    `json:"type"`
+	Status    string    `json:"status"`
+	Segments  int       `json:"segments,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Attempt   int       `json:"attempt"`
+}
+
+// IsTerminal reports whether a message status is final and should be reported
+func IsTerminal(status string) bool {
+	switch status {
+	case StatusDelivered, StatusFailed, StatusExpired, dnd.StatusBlocked:
+		return true
+	}
+	return false
+}
+
+// Sign returns the signature header value for a callback body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns the delay before retrying a receipt whose attempt failed
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	return BaseBackoff << (attempt - 1)
+}
+
+// RetryQueue returns the delay queue holding receipts whose attempt failed
+func RetryQueue(attempt int) string {
+	return fmt.Sprintf("%s.retry.%d", QueueName, attempt)
+}
+
+// DeclareQueues declares the receipt queue and one delay queue per retry.
+// Delay queues have no consumers, expired receipts are dead-lettered back to QueueName.
+func DeclareQueues(ch *amqp.Channel) error {
+	if _, err := ch.QueueDeclare(QueueName, true, false, false, false, amqp.Table{"x-queue-type": amqp.QueueTypeQuorum}); err != nil {
+		return fmt.Errorf("failed to declare queue %s: %v", QueueName, err)
+	}
+	for attempt := 1; attempt < MaxAttempts; attempt++ {
+		_, err := ch.QueueDeclare(RetryQueue(attempt), true, false, false, false, amqp.Table{
+			"x-queue-type":              amqp.QueueTypeQuorum,
+			"x-message-ttl":             Backoff(attempt).Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": QueueName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to declare queue %s: %v", RetryQueue(attempt), err)
+		}
+	}
+	return nil
+}
+
+// Publish queues a receipt on the given queue and waits for the broker to confirm it; ch must be in confirm mode
+func Publish(ch *amqp.Channel, queue string, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return rabbitmq.PublishConfirmed(ch, "", queue, amqp.Publishing{
+		ContentType:  "application/json",
+		Body:         body,
+		DeliveryMode: amqp.Persistent,
+	})
+}
+
+// Sync rebuilds the Redis set of applications with an active webhook
+func Sync(ctx context.Context, db *gorm.DB, client *redis.Client) (int, error) {
+	var apps []string
+	if err := db.Model(&models.DLRWebhook{}).Where("active = ?", true).Pluck("app", &apps).Error; err != nil {
+		return 0, fmt.Errorf("failed to load DLR webhooks: %v", err)
+	}
+
+	pipe := client.TxPipeline()
+	pipe.Del(ctx, AppsKey)
+	if len(apps) > 0 {
+		members := make([]interface{}, 0, len(apps))
+		for _, app := range apps {
+			members = append(members, app)
+		}
+		pipe.SAdd(ctx, AppsKey, members...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to sync DLR apps: %v", err)
+	}
+	return len(apps), nil
+}
+
+// SyncApp updates the Redis set for one application after its webhook changed
+func SyncApp(ctx context.Context, db *gorm.DB, client *redis.Client, app string) error {
+	var count int64
+	if err := db.Model(&models.DLRWebhook{}).Where("app = ? AND active = ?", app, true).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check DLR webhook: %v", err)
+	}
+
+	if count > 0 {
+		return client.SAdd(ctx, AppsKey, app).Err()
+	}
+	return client.SRem(ctx, AppsKey, app).Err()
+}
@@ -0,0 +1,132 @@
+package dnd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"myproject/models"
+	"myproject/msisdn"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// SetKey is the Redis set holding every MSISDN with an active DND entry
+const SetKey = "dnd:msisdns"
+
+// StatusBlocked is recorded for messages that were not sent because of DND
+const StatusBlocked = "dnd_blocked"
+
+// AppliesTo reports whether DND filtering applies to a message type
+func AppliesTo(filteredTypes []string, msgType string) bool {
+	for _, t := range filteredTypes {
+		if strings.EqualFold(strings.TrimSpace(t), msgType) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBlocked reports whether an MSISDN is on the DND list
+func IsBlocked(ctx context.Context, client *redis.Client, msisdn string) (bool, error) {
+	return client.SIsMember(ctx, SetKey, msisdn).Result()
+}
+
+// NormalizeEntries rewrites the phone numbers of DND entries stored before numbers were normalized to the local
+// 11-digit form, so every entry of a number is found by its normalized form. Invalid numbers are left as they are.
+func NormalizeEntries(db *gorm.DB) (int, error) {
+	var phoneNumbers []string
+	if err := db.Model(&models.DND{}).Distinct().Pluck("phone_number", &phoneNumbers).Error; err != nil {
+		return 0, fmt.Errorf("failed to load DND entries: %v", err)
+	}
+
+	migrated := 0
+	for _, phoneNumber := range phoneNumbers {
+		number, err := msisdn.Normalize(phoneNumber)
+		if err != nil || number == phoneNumber {
+			continue
+		}
+		result := db.Model(&models.DND{}).Where("phone_number = ?", phoneNumber).Update("phone_number", number)
+		if result.Error != nil {
+			return migrated, fmt.Errorf("failed to normalize DND entries of %s: %v", phoneNumber, result.Error)
+		}
+		migrated += int(result.RowsAffected)
+	}
+	return migrated, nil
+}
+
+// Sync normalizes the stored DND entries and rebuilds the Redis DND set from the active ones
+func Sync(ctx context.Context, db *gorm.DB, client *redis.Client) (int, error) {
+	if migrated, err := NormalizeEntries(db); err != nil {
+		return 0, err
+	} else if migrated > 0 {
+		log.Printf("Normalized the phone numbers of %d DND entries", migrated)
+	}
+
+	var phoneNumbers []string
+	if err := db.Model(&models.DND{}).Where("LOWER(status) = ?", "active").Distinct().Pluck("phone_number", &phoneNumbers).Error; err != nil {
+		return 0, fmt.Errorf("failed to load DND entries: %v", err)
+	}
+
+	// Numbers are checked in normalized form; invalid entries cannot match any request
+	numbers := make([]string, 0, len(phoneNumbers))
+	seen := make(map[string]bool, len(phoneNumbers))
+	skipped := 0
+	for _, phoneNumber := range phoneNumbers {
+		number, err := msisdn.Normalize(phoneNumber)
+		if err != nil {
+			skipped++
+			continue
+		}
+		if !seen[number] {
+			seen[number] = true
+			numbers = append(numbers, number)
+		}
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d DND entries with an invalid phone number", skipped)
+	}
+
+	// Build the new set under a temporary key and swap it in atomically
+	tmpKey := SetKey + ":sync"
+	pipe := client.TxPipeline()
+	pipe.Del(ctx, tmpKey)
+	for start := 0; start < len(numbers); start += 1000 {
+		end := min(start+1000, len(numbers))
+		members := make([]interface{}, 0, end-start)
+		for _, number := range numbers[start:end] {
+			members = append(members, number)
+		}
+		pipe.SAdd(ctx, tmpKey, members...)
+	}
+	if len(numbers) > 0 {
+		pipe.Rename(ctx, tmpKey, SetKey)
+	} else {
+		pipe.Del(ctx, SetKey)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to sync DND set: %v", err)
+	}
+	return len(numbers), nil
+}
+
+// SyncNumber updates the Redis DND set for one MSISDN after its DND entries changed. Entries are matched
+// by the normalized number, which every stored entry uses once Sync normalized them.
+func SyncNumber(ctx context.Context, db *gorm.DB, client *redis.Client, phoneNumber string) error {
+	number, err := msisdn.Normalize(phoneNumber)
+	if err != nil {
+		// Invalid numbers are never added to the set
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&models.DND{}).Where("phone_number = ? AND LOWER(status) = ?", number, "active").Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check DND entries: %v", err)
+	}
+
+	if count > 0 {
+		return client.SAdd(ctx, SetKey, number).Err()
+	}
+	return client.SRem(ctx, SetKey, number).Err()
+}
@@ -0,0 +1,93 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// StatusProcessing marks a request that has been claimed but not yet queued
+const StatusProcessing = "processing"
+
+// MaxKeyLength is the longest client request ID accepted
+const MaxKeyLength = 128
+
+// Record is the outcome remembered for a client request ID
+type Record struct {
+	MsgID  string `json:"msg_id"`
+	Status string `json:"status"`
+}
+
+// Store keeps client request IDs in Redis, scoped per calling application
+type Store struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewStore creates an idempotency store whose entries expire after ttl
+func NewStore(client *redis.Client, ttl time.Duration) *Store {
+	return &Store{client: client, ttl: ttl}
+}
+
+// ValidateKey checks that a client request ID can be stored
+func ValidateKey(key string) error {
+	if len(key) > MaxKeyLength {
+		return fmt.Errorf("request_id must not be longer than %d characters", MaxKeyLength)
+	}
+	return nil
+}
+
+// Reserve claims a request ID for a new message. If the ID was already claimed
+// the original record is returned and the caller must not publish again.
+func (s *Store) Reserve(ctx context.Context, app, key string, record Record) (*Record, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	redisKey := s.redisKey(app, key)
+	ok, err := s.client.SetNX(ctx, redisKey, data, s.ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve request ID: %v", err)
+	}
+	if ok {
+		return nil, nil
+	}
+
+	existing, err := s.client.Get(ctx, redisKey).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			// The previous claim expired or was released between the two calls
+			return s.Reserve(ctx, app, key, record)
+		}
+		return nil, fmt.Errorf("failed to read request ID: %v", err)
+	}
+
+	var original Record
+	if err := json.Unmarshal(existing, &original); err != nil {
+		return nil, fmt.Errorf("failed to decode request ID record: %v", err)
+	}
+	return &original, nil
+}
+
+// Complete stores the final record for a reserved request ID
+func (s *Store) Complete(ctx context.Context, app, key string, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.redisKey(app, key), data, s.ttl).Err()
+}
+
+// Release drops a reserved request ID so that the client can retry it
+func (s *Store) Release(ctx context.Context, app, key string) error {
+	return s.client.Del(ctx, s.redisKey(app, key)).Err()
+}
+
+func (s *Store) redisKey(app, key string) string {
+	return fmt.Sprintf("idempotency:sms:%s:%s", app, key)
+}
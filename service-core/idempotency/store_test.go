@@ -0,0 +1,90 @@
+package idempotency
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// testStore returns a store on the Redis server in REDIS_URL, skipping the test when none is reachable
+func testStore(t *testing.T, ttl time.Duration) *Store {
+	t.Helper()
+	addr := os.Getenv("REDIS_URL")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr, DB: 15})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		t.Skipf("Redis is not reachable at %s: %v", addr, err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return NewStore(client, ttl)
+}
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{"", false},
+		{"order-42", false},
+		{strings.Repeat("x", MaxKeyLength), false},
+		{strings.Repeat("x", MaxKeyLength+1), true},
+	}
+	for _, tt := range tests {
+		if err := ValidateKey(tt.key); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateKey(%d characters) error = %v, wantErr %v", len(tt.key), err, tt.wantErr)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	store := testStore(t, time.Minute)
+	ctx := context.Background()
+	app, key := "test-app", "reserve-"+t.Name()
+	store.Release(ctx, app, key)
+	t.Cleanup(func() { store.Release(ctx, app, key) })
+
+	first := Record{MsgID: "first", Status: StatusProcessing}
+	existing, err := store.Reserve(ctx, app, key, first)
+	if err != nil || existing != nil {
+		t.Fatalf("first Reserve() = %+v, %v, want a new claim", existing, err)
+	}
+
+	// A retry of the same request ID returns the original message instead of claiming it again
+	existing, err = store.Reserve(ctx, app, key, Record{MsgID: "second", Status: StatusProcessing})
+	if err != nil || existing == nil || *existing != first {
+		t.Fatalf("second Reserve() = %+v, %v, want %+v", existing, err, first)
+	}
+
+	completed := Record{MsgID: "first", Status: "queued"}
+	if err := store.Complete(ctx, app, key, completed); err != nil {
+		t.Fatal(err)
+	}
+	existing, err = store.Reserve(ctx, app, key, Record{MsgID: "third", Status: StatusProcessing})
+	if err != nil || existing == nil || *existing != completed {
+		t.Fatalf("Reserve() after Complete() = %+v, %v, want %+v", existing, err, completed)
+	}
+
+	// The same request ID of another application is a different request
+	otherApp := "other-app"
+	t.Cleanup(func() { store.Release(ctx, otherApp, key) })
+	if existing, err := store.Reserve(ctx, otherApp, key, first); err != nil || existing != nil {
+		t.Errorf("Reserve() of another app = %+v, %v, want a new claim", existing, err)
+	}
+
+	// A released request ID can be retried
+	if err := store.Release(ctx, app, key); err != nil {
+		t.Fatal(err)
+	}
+	if existing, err := store.Reserve(ctx, app, key, first); err != nil || existing != nil {
+		t.Errorf("Reserve() after Release() = %+v, %v, want a new claim", existing, err)
+	}
+}
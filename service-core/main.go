@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -16,9 +17,13 @@ import (
 
 	"myproject/config"
 	"myproject/controllers"
+	"myproject/dlr"
+	"myproject/dnd"
 	"myproject/middleware"
 	"myproject/models"
+	"myproject/msgid"
 	"myproject/routes"
+	"myproject/routing"
 	"myproject/utils"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
@@ -63,6 +68,19 @@ func main() {
 	// Test error logging
 	errorLogger.Println("This is a test error message") // Should appear in error.log
 
+	// Load Configuration
+	cfg := config.GetConfig()
+
+	// Configure the message ID generator for this instance before anything can issue IDs
+	nodeID, err := cfg.ResolveNodeID()
+	if err != nil {
+		errorLogger.Fatalf("Cannot resolve the message ID node: %v", err)
+	}
+	if err := msgid.SetNodeID(nodeID); err != nil {
+		errorLogger.Fatalf("Invalid NODE_ID: %v", err)
+	}
+	appLogger.Printf("Message ID node %d", nodeID)
+
 	// Initialize database
 	db, err := utils.InitDB()
 	if err != nil {
@@ -77,7 +95,8 @@ func main() {
 		err = db.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.Campaign{},
 			&models.SeederLog{}, &models.CampaignRecipient{}, &models.CampaignWorkflowProcessing{},
 			&models.CampaignWorkflowProcessing{}, &models.CampaignWorkflow{}, &models.CampaignWorkflowUser{},
-			&models.DND{}, &models.MNO{}, &models.MnoChannels{}, &models.MsgPriority{},
+			&models.DND{}, &models.MNO{}, &models.MnoChannels{}, &models.ChannelTPSAllocation{}, &models.MsgPriority{},
+			&models.DLRWebhook{}, &models.DLRAttempt{}, &models.AuditLog{},
 		)
 		if err != nil {
 			errorLogger.Fatal("Failed to migrate database:", err)
@@ -86,8 +105,34 @@ func main() {
 		appLogger.Println("AutoMigrate is disabled. Skipping database migrations.")
 	}
 
+	// Load MNO prefix routing table and message type priorities
+	if err := routing.LoadMNORoutes(db); err != nil {
+		errorLogger.Printf("Failed to load MNO routing table: %v", err)
+	}
+	if err := routing.LoadMsgPriorities(db); err != nil {
+		errorLogger.Printf("Failed to load message type priorities: %v", err)
+	}
+
 	// Initialize Redis
-	// redisClient := utils.InitRedis()
+	redisClient := utils.InitRedis()
+
+	// Load the DND list into Redis for O(1) lookups
+	if count, err := dnd.Sync(context.Background(), db, redisClient); err != nil {
+		errorLogger.Printf("Failed to sync DND list to Redis: %v", err)
+	} else {
+		appLogger.Printf("DND list synced to Redis with %d numbers", count)
+	}
+	if count, err := dlr.Sync(context.Background(), db, redisClient); err != nil {
+		errorLogger.Printf("Failed to sync DLR webhooks to Redis: %v", err)
+	} else {
+		appLogger.Printf("DLR webhooks synced to Redis for %d apps", count)
+	}
+	if err := routing.SyncChannels(context.Background(), redisClient); err != nil {
+		errorLogger.Printf("Failed to sync MNO channels to Redis: %v", err)
+	}
+	if err := routing.SyncPriorities(context.Background(), redisClient); err != nil {
+		errorLogger.Printf("Failed to sync consumer priority tiers to Redis: %v", err)
+	}
 
 	// Initialize Gin router
 	router := gin.Default()
@@ -117,14 +162,29 @@ func main() {
 	rabbitMQusername := os.Getenv("RABBITMQ_USER")
 	rabbitMQpassword := os.Getenv("RABBITMQ_PASSWORD")
 
-	rmq, err := rabbitmq.NewRabbitMQ(rabbitMQURLs, rabbitMQmanagementURL, rabbitMQusername, rabbitMQpassword)
+	topology, err := rabbitmq.LoadTopology(os.Getenv("RABBITMQ_TOPOLOGY_FILE"))
+	if err != nil {
+		errorLogger.Fatalf("Invalid RabbitMQ topology: %v", err)
+	}
+
+	rmq, err := rabbitmq.NewRabbitMQ(rabbitMQURLs, rabbitMQmanagementURL, rabbitMQusername, rabbitMQpassword, topology, rabbitmq.PoolConfig{
+		Connections:           cfg.RabbitMQPoolConnections,
+		ChannelsPerConnection: cfg.RabbitMQPoolChannels,
+	})
 	if err != nil {
 		errorLogger.Fatalf("Failed to connect to RabbitMQ: %v", err)
 	}
 	defer rmq.Close()
 
-	// Load Configuration
-	cfg := config.GetConfig()
+	// Queues of message types configured in MsgPriority but not listed in the topology
+	for _, typeRoute := range routing.MessageTypes() {
+		if err := rmq.EnsureQueue(typeRoute.Queue); err != nil {
+			errorLogger.Fatalf("Failed to declare queue for message type %s: %v", typeRoute.Type, err)
+		}
+	}
+
+	// Post delivery receipts recorded by the consumers to client webhooks
+	go dlr.NewDispatcher(db, rmq).Run(context.Background())
 
 	// Initialize InfluxDB client
 	influxClient := influxdb2.NewClient(cfg.InfluxDBURL, cfg.InfluxDBToken)
@@ -146,9 +206,12 @@ func main() {
 		routes.SetupMNORoutes(apiRoutes)
 		routes.SetupDndRoutes(apiRoutes)
 		routes.SetupMsgPriorityRoutes(apiRoutes)
+		routes.SetupTPSAllocationRoutes(apiRoutes)
 		routes.SetupCampaignRecipientRoutes(apiRoutes)
 		routes.SetupCampaignWorkflowRoutes(apiRoutes)
-		routes.SetupSMSGatewayRoutes(apiRoutes, influxClient, cfg, rmq)
+		routes.SetupSMSGatewayRoutes(apiRoutes, influxClient, cfg, rmq, redisClient)
+		routes.SetupDLRRoutes(apiRoutes)
+		routes.SetupQueueRoutes(apiRoutes, rmq)
 	}
 
 	// Start server
@@ -0,0 +1,87 @@
+// Package mnoadapter submits SMS to MNO APIs behind a common interface, so each operator or
+// channel is described by configuration rather than code.
+package mnoadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"myproject/smsencoding"
+)
+
+// Statuses an operator response is mapped to
+const (
+	// StatusSubmitted means the operator accepted the part for delivery
+	StatusSubmitted = "submitted"
+	// StatusDelivered means the operator reported the part delivered synchronously
+	StatusDelivered = "delivered"
+	// StatusRetry is a temporary failure, such as an operator outage
+	StatusRetry = "retry"
+	// StatusThrottled means the operator refused the part because of its rate limit
+	StatusThrottled = "throttled"
+	// StatusFailed is a permanent rejection, such as an invalid number; retrying cannot succeed
+	StatusFailed = "failed"
+	// StatusUnknown means the part was sent but no answer was received, so the operator may have accepted it
+	StatusUnknown = "unknown"
+)
+
+var (
+	// ErrThrottled matches the errors of parts refused because of the operator's rate limit
+	ErrThrottled = errors.New("throttled by operator")
+	// ErrUnknown matches the errors of parts sent without an answer; resubmitting them could deliver them twice
+	ErrUnknown = errors.New("submission outcome unknown")
+)
+
+// Submission is one part of an SMS submitted to an operator
+type Submission struct {
+	MsgID    string
+	MSISDN   string
+	Text     string
+	Encoding smsencoding.Encoding
+	// Seq and Total number the parts of a long message, sent with UDH
+	Seq   int
+	Total int
+	UDH   []byte
+}
+
+// Result is the operator's answer to an accepted submission
+type Result struct {
+	// Status is StatusSubmitted or StatusDelivered
+	Status string
+	// MessageID is the operator's ID of the part, when it returns one
+	MessageID string
+	// Code is the operator's response code
+	Code string
+}
+
+// Error is a submission the operator did not accept
+type Error struct {
+	// Status is StatusRetry, StatusThrottled, StatusFailed or StatusUnknown
+	Status  string
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("operator returned %s (%s): %s", e.Code, e.Status, e.Message)
+	}
+	return fmt.Sprintf("operator returned %s (%s)", e.Code, e.Status)
+}
+
+// Is makes throttling errors match ErrThrottled and unanswered ones ErrUnknown
+func (e *Error) Is(target error) bool {
+	return target == ErrThrottled && e.Status == StatusThrottled || target == ErrUnknown && e.Status == StatusUnknown
+}
+
+// Permanent reports whether err is a rejection that retrying cannot fix
+func Permanent(err error) bool {
+	var adapterErr *Error
+	return errors.As(err, &adapterErr) && adapterErr.Status == StatusFailed
+}
+
+// MNOAdapter submits SMS parts to an operator. Submit is called concurrently.
+type MNOAdapter interface {
+	Submit(ctx context.Context, s Submission) (Result, error)
+}
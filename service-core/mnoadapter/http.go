@@ -0,0 +1,440 @@
+package mnoadapter
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"myproject/smsencoding"
+)
+
+// Auth schemes of an HTTP API
+const (
+	AuthNone        = "none"
+	AuthBasic       = "basic"
+	AuthToken       = "token"
+	AuthSignedQuery = "signed_query"
+)
+
+// DefaultHTTPTimeout bounds a request when the configuration sets no timeout
+const DefaultHTTPTimeout = 10 * time.Second
+
+// maxResponseBody bounds the part of a response that is parsed
+const maxResponseBody = 64 * 1024
+
+// HTTPConfig describes an operator's HTTP SMS API. URL, Headers, Query and Body are text/template
+// templates rendered for every part; see templateData for the fields and funcs available.
+type HTTPConfig struct {
+	URL       string            `json:"url"`
+	Method    string            `json:"method,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Query     map[string]string `json:"query,omitempty"`
+	Body      string            `json:"body,omitempty"`
+	Auth      AuthConfig        `json:"auth"`
+	TimeoutMS int               `json:"timeout_ms,omitempty"`
+	Response  ResponseConfig    `json:"response"`
+}
+
+// AuthConfig is how requests are authenticated
+type AuthConfig struct {
+	// Scheme is none, basic, token or signed_query
+	Scheme   string `json:"scheme"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Token is sent in Header (default Authorization) after Prefix (default Bearer)
+	Token  string `json:"token,omitempty"`
+	Header string `json:"header,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	// Secret signs the query for signed_query: the sorted, encoded query including the timestamp
+	// parameter is signed with HMAC-SHA256 and the hex signature added as SignatureParam
+	Secret         string `json:"secret,omitempty"`
+	SignatureParam string `json:"signature_param,omitempty"`
+	TimestampParam string `json:"timestamp_param,omitempty"`
+}
+
+// ResponseConfig maps an operator response to a status
+type ResponseConfig struct {
+	// CodePath is the dotted path of the response code in a JSON body, e.g. "result.code" or "data.0.status".
+	// A body that is not JSON is itself the code. Without a path the HTTP status is the code.
+	CodePath      string `json:"code_path,omitempty"`
+	MessageIDPath string `json:"message_id_path,omitempty"`
+	MessagePath   string `json:"message_path,omitempty"`
+	// Codes maps operator codes to submitted, delivered, retry, throttled or failed
+	Codes map[string]string `json:"codes,omitempty"`
+	// DefaultStatus applies to codes missing from Codes; without it the HTTP status decides
+	DefaultStatus string `json:"default_status,omitempty"`
+}
+
+// templateData is available to the request templates, e.g. {{.MSISDN}}, {{json .Text}} or {{ucs2hex .Text}}
+type templateData struct {
+	Submission
+	// Unicode is set for UCS-2 parts
+	Unicode   bool
+	Username  string
+	Password  string
+	Token     string
+	Timestamp int64
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"ucs2hex": func(text string) string {
+		return strings.ToUpper(hex.EncodeToString(smsencoding.EncodeUCS2(text)))
+	},
+	"hex": func(data []byte) string {
+		return strings.ToUpper(hex.EncodeToString(data))
+	},
+}
+
+// ParseHTTPConfig reads and validates an HTTP adapter configuration
+func ParseHTTPConfig(data []byte) (HTTPConfig, error) {
+	var cfg HTTPConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid HTTP adapter configuration: %v", err)
+	}
+	_, err := NewHTTPAdapter(cfg)
+	return cfg, err
+}
+
+// HTTPAdapter submits parts to an operator's HTTP API as described by an HTTPConfig
+type HTTPAdapter struct {
+	cfg     HTTPConfig
+	client  *http.Client
+	url     *template.Template
+	body    *template.Template
+	headers map[string]*template.Template
+	query   map[string]*template.Template
+}
+
+// NewHTTPAdapter validates the configuration and compiles its templates
+func NewHTTPAdapter(cfg HTTPConfig) (*HTTPAdapter, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	cfg.Method = strings.ToUpper(cfg.Method)
+	switch cfg.Method {
+	case "":
+		cfg.Method = http.MethodPost
+	case http.MethodGet, http.MethodPost, http.MethodPut:
+	default:
+		return nil, fmt.Errorf("unsupported method %s", cfg.Method)
+	}
+
+	switch cfg.Auth.Scheme {
+	case "", AuthNone:
+	case AuthBasic:
+		if cfg.Auth.Username == "" {
+			return nil, errors.New("basic auth requires a username")
+		}
+	case AuthToken:
+		if cfg.Auth.Token == "" {
+			return nil, errors.New("token auth requires a token")
+		}
+	case AuthSignedQuery:
+		if cfg.Auth.Secret == "" {
+			return nil, errors.New("signed_query auth requires a secret")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported auth scheme %s", cfg.Auth.Scheme)
+	}
+
+	for code, status := range cfg.Response.Codes {
+		if !validStatus(status) {
+			return nil, fmt.Errorf("invalid status %q for code %s", status, code)
+		}
+	}
+	if cfg.Response.DefaultStatus != "" && !validStatus(cfg.Response.DefaultStatus) {
+		return nil, fmt.Errorf("invalid default_status %q", cfg.Response.DefaultStatus)
+	}
+
+	timeout := DefaultHTTPTimeout
+	if cfg.TimeoutMS > 0 {
+		timeout = time.Duration(cfg.TimeoutMS) * time.Millisecond
+	}
+	a := &HTTPAdapter{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: timeout},
+		headers: make(map[string]*template.Template, len(cfg.Headers)),
+		query:   make(map[string]*template.Template, len(cfg.Query)),
+	}
+
+	var err error
+	if a.url, err = parseTemplate("url", cfg.URL); err != nil {
+		return nil, err
+	}
+	if a.body, err = parseTemplate("body", cfg.Body); err != nil {
+		return nil, err
+	}
+	for name, value := range cfg.Headers {
+		if a.headers[name], err = parseTemplate("header "+name, value); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range cfg.Query {
+		if a.query[name], err = parseTemplate("query "+name, value); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Submit sends one part and maps the response
+func (a *HTTPAdapter) Submit(ctx context.Context, s Submission) (Result, error) {
+	req, err := a.request(ctx, s)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Only errors before the request was written are retried; afterwards the operator may have accepted the part
+	var sent atomic.Bool
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				sent.Store(true)
+			}
+		},
+	}))
+	resp, err := a.client.Do(req)
+	if err != nil {
+		if sent.Load() {
+			return Result{}, &Error{Status: StatusUnknown, Code: "transport", Message: err.Error()}
+		}
+		return Result{}, &Error{Status: StatusRetry, Code: "transport", Message: err.Error()}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return Result{}, &Error{Status: StatusUnknown, Code: "transport", Message: err.Error()}
+	}
+	return a.parse(resp.StatusCode, body)
+}
+
+// request renders the templates into an authenticated request
+func (a *HTTPAdapter) request(ctx context.Context, s Submission) (*http.Request, error) {
+	data := templateData{
+		Submission: s,
+		Unicode:    s.Encoding == smsencoding.UCS2,
+		Username:   a.cfg.Auth.Username,
+		Password:   a.cfg.Auth.Password,
+		Token:      a.cfg.Auth.Token,
+		Timestamp:  time.Now().Unix(),
+	}
+
+	rawURL, err := render(a.url, data)
+	if err != nil {
+		return nil, err
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %v", err)
+	}
+	query := target.Query()
+	for name, tmpl := range a.query {
+		value, err := render(tmpl, data)
+		if err != nil {
+			return nil, err
+		}
+		query.Set(name, value)
+	}
+	if a.cfg.Auth.Scheme == AuthSignedQuery {
+		sign(query, a.cfg.Auth, data.Timestamp)
+	}
+	target.RawQuery = query.Encode()
+
+	var body io.Reader
+	if a.cfg.Body != "" {
+		rendered, err := render(a.body, data)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(rendered)
+	}
+	req, err := http.NewRequestWithContext(ctx, a.cfg.Method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, tmpl := range a.headers {
+		value, err := render(tmpl, data)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(name, value)
+	}
+
+	switch a.cfg.Auth.Scheme {
+	case AuthBasic:
+		req.SetBasicAuth(a.cfg.Auth.Username, a.cfg.Auth.Password)
+	case AuthToken:
+		header, prefix := a.cfg.Auth.Header, a.cfg.Auth.Prefix
+		if header == "" {
+			header = "Authorization"
+			if prefix == "" {
+				prefix = "Bearer"
+			}
+		}
+		value := a.cfg.Auth.Token
+		if prefix != "" {
+			value = prefix + " " + value
+		}
+		req.Header.Set(header, value)
+	}
+	return req, nil
+}
+
+// sign adds the timestamp and the HMAC-SHA256 signature of the sorted query
+func sign(query url.Values, auth AuthConfig, timestamp int64) {
+	signatureParam, timestampParam := auth.SignatureParam, auth.TimestampParam
+	if signatureParam == "" {
+		signatureParam = "signature"
+	}
+	if timestampParam == "" {
+		timestampParam = "timestamp"
+	}
+	query.Del(signatureParam)
+	query.Set(timestampParam, strconv.FormatInt(timestamp, 10))
+
+	mac := hmac.New(sha256.New, []byte(auth.Secret))
+	mac.Write([]byte(query.Encode()))
+	query.Set(signatureParam, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// parse maps the operator response to a result or an error
+func (a *HTTPAdapter) parse(statusCode int, body []byte) (Result, error) {
+	rules := a.cfg.Response
+	code := strconv.Itoa(statusCode)
+	// Plain text bodies such as "1701" are codes themselves, even when they parse as JSON scalars
+	var document interface{}
+	isJSON := false
+	if json.Unmarshal(body, &document) == nil {
+		switch document.(type) {
+		case map[string]interface{}, []interface{}:
+			isJSON = true
+		}
+	}
+	if rules.CodePath != "" {
+		if isJSON {
+			code = lookup(document, rules.CodePath)
+		} else {
+			code = strings.TrimSpace(string(body))
+		}
+	}
+
+	status, ok := rules.Codes[code]
+	if !ok {
+		status = rules.DefaultStatus
+	}
+	if status == "" {
+		status = httpStatus(statusCode)
+	}
+
+	var messageID, message string
+	if isJSON {
+		messageID = lookup(document, rules.MessageIDPath)
+		message = lookup(document, rules.MessagePath)
+	}
+	if message == "" && status != StatusSubmitted && status != StatusDelivered {
+		message = truncate(strings.TrimSpace(string(body)), 200)
+	}
+
+	switch status {
+	case StatusSubmitted, StatusDelivered:
+		return Result{Status: status, MessageID: messageID, Code: code}, nil
+	}
+	return Result{}, &Error{Status: status, Code: code, Message: message}
+}
+
+// httpStatus is the status of an HTTP response without a configured code mapping
+func httpStatus(statusCode int) string {
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		return StatusSubmitted
+	case statusCode == http.StatusTooManyRequests:
+		return StatusThrottled
+	case statusCode == http.StatusRequestTimeout || statusCode >= 500:
+		return StatusRetry
+	}
+	return StatusFailed
+}
+
+// lookup returns the value at a dotted path of a JSON document as a string
+func lookup(document interface{}, path string) string {
+	if path == "" {
+		return ""
+	}
+	value := document
+	for _, key := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			value = node[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return ""
+			}
+			value = node[i]
+		default:
+			return ""
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func validStatus(status string) bool {
+	switch status {
+	case StatusSubmitted, StatusDelivered, StatusRetry, StatusThrottled, StatusFailed:
+		return true
+	}
+	return false
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+func render(tmpl *template.Template, data templateData) (string, error) {
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %v", tmpl.Name(), err)
+	}
+	return out.String(), nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,258 @@
+package mnoadapter
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"myproject/smsencoding"
+)
+
+func TestNewHTTPAdapterValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     HTTPConfig
+		wantErr bool
+	}{
+		{"minimal", HTTPConfig{URL: "https://mno.example/sms"}, false},
+		{"no url", HTTPConfig{}, true},
+		{"unsupported method", HTTPConfig{URL: "https://mno.example/sms", Method: "DELETE"}, true},
+		{"basic without username", HTTPConfig{URL: "https://mno.example/sms", Auth: AuthConfig{Scheme: AuthBasic}}, true},
+		{"token without token", HTTPConfig{URL: "https://mno.example/sms", Auth: AuthConfig{Scheme: AuthToken}}, true},
+		{"signed_query without secret", HTTPConfig{URL: "https://mno.example/sms", Auth: AuthConfig{Scheme: AuthSignedQuery}}, true},
+		{"unknown auth scheme", HTTPConfig{URL: "https://mno.example/sms", Auth: AuthConfig{Scheme: "oauth"}}, true},
+		{"invalid code status", HTTPConfig{URL: "https://mno.example/sms", Response: ResponseConfig{Codes: map[string]string{"0": "ok"}}}, true},
+		{"invalid default status", HTTPConfig{URL: "https://mno.example/sms", Response: ResponseConfig{DefaultStatus: "unknown"}}, true},
+		{"invalid template", HTTPConfig{URL: "https://mno.example/sms", Body: "{{.MSISDN"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewHTTPAdapter(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("NewHTTPAdapter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPAdapterRequest(t *testing.T) {
+	var got *http.Request
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		got, body = r, string(data)
+		w.Write([]byte(`{"result":{"code":"0","id":"op-1"}}`))
+	}))
+	defer server.Close()
+
+	adapter, err := NewHTTPAdapter(HTTPConfig{
+		URL:     server.URL + "/send?channel=1",
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Query:   map[string]string{"to": "{{.MSISDN}}"},
+		Body:    `{"text":{{json .Text}},"unicode":{{.Unicode}},"hex":"{{ucs2hex .Text}}"}`,
+		Auth:    AuthConfig{Scheme: AuthToken, Token: "t0k3n"},
+		Response: ResponseConfig{
+			CodePath:      "result.code",
+			MessageIDPath: "result.id",
+			Codes:         map[string]string{"0": StatusSubmitted},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := adapter.Submit(context.Background(), Submission{MSISDN: "8801712345678", Text: "হ\"i", Encoding: smsencoding.UCS2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (Result{Status: StatusSubmitted, MessageID: "op-1", Code: "0"}) {
+		t.Errorf("Submit() = %+v", result)
+	}
+	if got.Method != http.MethodPost || got.URL.Path != "/send" {
+		t.Errorf("request %s %s, want POST /send", got.Method, got.URL.Path)
+	}
+	if q := got.URL.Query(); q.Get("to") != "8801712345678" || q.Get("channel") != "1" {
+		t.Errorf("query = %s", got.URL.RawQuery)
+	}
+	if auth := got.Header.Get("Authorization"); auth != "Bearer t0k3n" {
+		t.Errorf("Authorization = %q, want Bearer t0k3n", auth)
+	}
+	if want := `{"text":"হ\"i","unicode":true,"hex":"09B900220069"}`; body != want {
+		t.Errorf("body = %s, want %s", body, want)
+	}
+}
+
+func TestHTTPAdapterAuth(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer server.Close()
+
+	t.Run("basic", func(t *testing.T) {
+		adapter, err := NewHTTPAdapter(HTTPConfig{URL: server.URL, Auth: AuthConfig{Scheme: AuthBasic, Username: "gw", Password: "secret"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := adapter.Submit(context.Background(), Submission{MSISDN: "8801712345678"}); err != nil {
+			t.Fatal(err)
+		}
+		if username, password, ok := got.BasicAuth(); !ok || username != "gw" || password != "secret" {
+			t.Errorf("BasicAuth() = %q, %q, %v", username, password, ok)
+		}
+	})
+
+	t.Run("custom token header", func(t *testing.T) {
+		adapter, err := NewHTTPAdapter(HTTPConfig{URL: server.URL, Auth: AuthConfig{Scheme: AuthToken, Token: "key", Header: "X-API-Key"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := adapter.Submit(context.Background(), Submission{}); err != nil {
+			t.Fatal(err)
+		}
+		if key := got.Header.Get("X-API-Key"); key != "key" {
+			t.Errorf("X-API-Key = %q, want key without a prefix", key)
+		}
+	})
+
+	t.Run("signed query", func(t *testing.T) {
+		adapter, err := NewHTTPAdapter(HTTPConfig{
+			URL:   server.URL,
+			Query: map[string]string{"to": "{{.MSISDN}}"},
+			Auth:  AuthConfig{Scheme: AuthSignedQuery, Secret: "s3cr3t", SignatureParam: "sig"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := adapter.Submit(context.Background(), Submission{MSISDN: "8801712345678"}); err != nil {
+			t.Fatal(err)
+		}
+		query := got.URL.Query()
+		signature := query.Get("sig")
+		if query.Get("timestamp") == "" {
+			t.Fatal("no timestamp in the signed query")
+		}
+		query.Del("sig")
+		mac := hmac.New(sha256.New, []byte("s3cr3t"))
+		mac.Write([]byte(query.Encode()))
+		if want := hex.EncodeToString(mac.Sum(nil)); signature != want {
+			t.Errorf("sig = %s, want %s", signature, want)
+		}
+	})
+}
+
+func TestHTTPAdapterParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   ResponseConfig
+		statusCode int
+		body       string
+		want       Result
+		wantStatus string
+	}{
+		{"2xx without mapping", ResponseConfig{}, 200, "OK", Result{Status: StatusSubmitted, Code: "200"}, ""},
+		{"429 without mapping", ResponseConfig{}, 429, "", Result{}, StatusThrottled},
+		{"5xx without mapping", ResponseConfig{}, 503, "", Result{}, StatusRetry},
+		{"4xx without mapping", ResponseConfig{}, 400, "bad number", Result{}, StatusFailed},
+		{"mapped JSON code", ResponseConfig{CodePath: "status", Codes: map[string]string{"1701": StatusSubmitted}}, 200, `{"status":1701,"sms_id":"x"}`, Result{Status: StatusSubmitted, Code: "1701"}, ""},
+		{"plain text code", ResponseConfig{CodePath: "status", Codes: map[string]string{"1701": StatusSubmitted}}, 200, "1701\n", Result{Status: StatusSubmitted, Code: "1701"}, ""},
+		{"code in array", ResponseConfig{CodePath: "data.0.status", MessageIDPath: "data.0.id", Codes: map[string]string{"ok": StatusDelivered}}, 200, `{"data":[{"status":"ok","id":7}]}`, Result{Status: StatusDelivered, MessageID: "7", Code: "ok"}, ""},
+		{"unmapped code with default", ResponseConfig{CodePath: "code", DefaultStatus: StatusRetry}, 200, `{"code":"9"}`, Result{}, StatusRetry},
+		{"mapped rejection", ResponseConfig{CodePath: "code", Codes: map[string]string{"1702": StatusFailed}}, 200, `{"code":"1702"}`, Result{}, StatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter, err := NewHTTPAdapter(HTTPConfig{URL: "https://mno.example/sms", Response: tt.response})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := adapter.parse(tt.statusCode, []byte(tt.body))
+			if tt.wantStatus == "" {
+				if err != nil || got != tt.want {
+					t.Errorf("parse() = %+v, %v, want %+v", got, err, tt.want)
+				}
+				return
+			}
+			var adapterErr *Error
+			if !errors.As(err, &adapterErr) || adapterErr.Status != tt.wantStatus {
+				t.Errorf("parse() error = %v, want status %s", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHTTPAdapterTransportErrors(t *testing.T) {
+	t.Run("connection refused is retried", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		adapter, err := NewHTTPAdapter(HTTPConfig{URL: server.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = adapter.Submit(context.Background(), Submission{})
+		var adapterErr *Error
+		if !errors.As(err, &adapterErr) || adapterErr.Status != StatusRetry {
+			t.Errorf("Submit() error = %v, want status %s", err, StatusRetry)
+		}
+	})
+
+	t.Run("no answer after sending is unknown", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+		}))
+		defer server.Close()
+		adapter, err := NewHTTPAdapter(HTTPConfig{URL: server.URL, Body: "{{.Text}}"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = adapter.Submit(context.Background(), Submission{Text: "hello"})
+		if !errors.Is(err, ErrUnknown) {
+			t.Errorf("Submit() error = %v, want ErrUnknown", err)
+		}
+	})
+}
+
+func TestLookup(t *testing.T) {
+	document := map[string]interface{}{
+		"a": map[string]interface{}{"b": []interface{}{"x", 2.5, true, nil}},
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", ""},
+		{"a.b.0", "x"},
+		{"a.b.1", "2.5"},
+		{"a.b.2", "true"},
+		{"a.b.3", ""},
+		{"a.b.4", ""},
+		{"a.b.x", ""},
+		{"a.missing", ""},
+		{"a.b", `["x",2.5,true,null]`},
+	}
+	for _, tt := range tests {
+		if got := lookup(document, tt.path); got != tt.want {
+			t.Errorf("lookup(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseHTTPConfig(t *testing.T) {
+	if _, err := ParseHTTPConfig([]byte(`{"url":"https://mno.example/sms","auth":{"scheme":"basic","username":"gw"}}`)); err != nil {
+		t.Errorf("ParseHTTPConfig() error = %v", err)
+	}
+	if _, err := ParseHTTPConfig([]byte(`{"url":`)); err == nil {
+		t.Error("ParseHTTPConfig() accepted invalid JSON")
+	}
+	if _, err := ParseHTTPConfig([]byte(`{"auth":{}}`)); err == nil {
+		t.Error("ParseHTTPConfig() accepted a configuration without a url")
+	}
+}
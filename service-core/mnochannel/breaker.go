@@ -0,0 +1,533 @@
+package mnochannel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// EventsChannel is the Redis pub/sub channel breaker transitions are announced on
+const EventsChannel = "mno:channel:events"
+
+// RecentEventsKey is the Redis list holding the latest breaker transitions, newest first
+const RecentEventsKey = "mno:channel:events:recent"
+
+// recentEvents is the number of transitions kept in RecentEventsKey
+const recentEvents = 100
+
+// Circuit breaker states of a channel
+const (
+	// StateClosed channels take traffic
+	StateClosed = "closed"
+	// StateOpen channels take no traffic; it fails over to the next channel by priority
+	StateOpen = "open"
+	// StateHalfOpen channels take one trial submission deciding whether they close or open again
+	StateHalfOpen = "half_open"
+)
+
+// Breaker transition events
+const (
+	// EventOpened is announced when a channel's breaker opens and its traffic fails over
+	EventOpened = "circuit_opened"
+	// EventHalfOpen is announced when a trial submission is let through an open breaker
+	EventHalfOpen = "circuit_half_open"
+	// EventClosed is announced when the trial succeeded and the channel takes its traffic back
+	EventClosed = "circuit_closed"
+)
+
+// ErrNoHealthyChannel matches the errors of MNOs whose every active channel has an open breaker
+var ErrNoHealthyChannel = errors.New("no healthy channel")
+
+// UnavailableError is returned when no channel of an MNO may take traffic
+type UnavailableError struct {
+	MNO string
+	// RetryAfter is the time until the first breaker lets a trial through
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%v for MNO %s, retry in %s", ErrNoHealthyChannel, e.MNO, e.RetryAfter)
+}
+
+// Is makes the error match ErrNoHealthyChannel
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrNoHealthyChannel
+}
+
+// BreakerKey returns the Redis hash holding the circuit breaker of a channel
+func BreakerKey(channelID uint) string {
+	return fmt.Sprintf("mno:channel:breaker:%d", channelID)
+}
+
+// BreakerConfig holds the thresholds opening a channel's breaker
+type BreakerConfig struct {
+	// ConsecutiveFailures opens the breaker after that many failures in a row
+	ConsecutiveFailures int
+	// FailureRate opens the breaker when the share of failed submissions over Window reaches it
+	FailureRate float64
+	// SlowCall is the latency from which a submission is slow, and SlowCallRate the share of slow
+	// submissions over Window opening the breaker
+	SlowCall     time.Duration
+	SlowCallRate float64
+	// Window is the sliding period the rates are measured over; they apply from MinRequests submissions
+	Window      time.Duration
+	MinRequests int
+	// OpenDuration is how long the breaker stays open before a trial submission is let through
+	OpenDuration time.Duration
+}
+
+// DefaultBreakerConfig returns the thresholds used unless configured otherwise
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		ConsecutiveFailures: 5,
+		FailureRate:         0.5,
+		SlowCall:            5 * time.Second,
+		SlowCallRate:        0.8,
+		Window:              time.Minute,
+		MinRequests:         20,
+		OpenDuration:        30 * time.Second,
+	}
+}
+
+// BreakerConfigFromEnv reads the thresholds from CHANNEL_FAILURE_THRESHOLD, CHANNEL_FAILURE_RATE,
+// CHANNEL_SLOW_CALL, CHANNEL_SLOW_CALL_RATE, CHANNEL_BREAKER_WINDOW, CHANNEL_BREAKER_MIN_REQUESTS and
+// CHANNEL_PROBE_INTERVAL, keeping the defaults of the unset ones. A rate or threshold of 0 disables it.
+func BreakerConfigFromEnv() (BreakerConfig, error) {
+	cfg := DefaultBreakerConfig()
+	ints := []struct {
+		key   string
+		value *int
+	}{
+		{"CHANNEL_FAILURE_THRESHOLD", &cfg.ConsecutiveFailures},
+		{"CHANNEL_BREAKER_MIN_REQUESTS", &cfg.MinRequests},
+	}
+	for _, setting := range ints {
+		if raw := os.Getenv(setting.key); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil || value < 0 {
+				return cfg, fmt.Errorf("invalid %s: %q", setting.key, raw)
+			}
+			*setting.value = value
+		}
+	}
+
+	rates := []struct {
+		key   string
+		value *float64
+	}{
+		{"CHANNEL_FAILURE_RATE", &cfg.FailureRate},
+		{"CHANNEL_SLOW_CALL_RATE", &cfg.SlowCallRate},
+	}
+	for _, setting := range rates {
+		if raw := os.Getenv(setting.key); raw != "" {
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil || value < 0 || value > 1 {
+				return cfg, fmt.Errorf("invalid %s: %q", setting.key, raw)
+			}
+			*setting.value = value
+		}
+	}
+
+	durations := []struct {
+		key   string
+		value *time.Duration
+	}{
+		{"CHANNEL_SLOW_CALL", &cfg.SlowCall},
+		{"CHANNEL_BREAKER_WINDOW", &cfg.Window},
+		{"CHANNEL_PROBE_INTERVAL", &cfg.OpenDuration},
+	}
+	for _, setting := range durations {
+		if raw := os.Getenv(setting.key); raw != "" {
+			value, err := time.ParseDuration(raw)
+			if err != nil || value <= 0 {
+				return cfg, fmt.Errorf("invalid %s: %q", setting.key, raw)
+			}
+			*setting.value = value
+		}
+	}
+	return cfg, nil
+}
+
+// recordScript records the outcome of a submission in the current window and moves the breaker:
+// a closed breaker opens on the consecutive failures, failure rate or slow call rate thresholds, and
+// the trial of a half-open breaker closes or reopens it. Results arriving while it is open are only counted.
+// The rates weigh the previous window by its overlap with the sliding window ending now.
+// It returns 1 when the breaker opened and 2 when it closed, with the reason.
+var recordScript = redis.NewScript(`
+local failed = ARGV[1] == '1'
+local slow = ARGV[2] == '1'
+local consecutive = tonumber(ARGV[3])
+local failureRate = tonumber(ARGV[4])
+local slowRate = tonumber(ARGV[5])
+local minRequests = tonumber(ARGV[6])
+local window = tonumber(ARGV[7])
+local open = tonumber(ARGV[8])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+
+local h = redis.call('HMGET', KEYS[1], 'state', 'failures', 'window_start',
+	'requests', 'failed', 'slow', 'prev_requests', 'prev_failed', 'prev_slow')
+local state = h[1] or 'closed'
+local failures = tonumber(h[2] or '0')
+local start = tonumber(h[3] or now)
+local cur = {tonumber(h[4] or '0'), tonumber(h[5] or '0'), tonumber(h[6] or '0')}
+local prev = {tonumber(h[7] or '0'), tonumber(h[8] or '0'), tonumber(h[9] or '0')}
+if now - start >= 2 * window then
+	prev = {0, 0, 0}
+	cur = {0, 0, 0}
+	start = now
+elseif now - start >= window then
+	prev = cur
+	cur = {0, 0, 0}
+	start = start + window
+end
+
+cur[1] = cur[1] + 1
+if failed then
+	cur[2] = cur[2] + 1
+	failures = failures + 1
+else
+	failures = 0
+end
+if slow then
+	cur[3] = cur[3] + 1
+end
+
+local result = 0
+local reason = ''
+if state == 'half_open' then
+	if failed or slow then
+		state = 'open'
+		result = 1
+		reason = failed and 'trial submission failed' or 'trial submission was slow'
+	else
+		state = 'closed'
+		result = 2
+		reason = 'trial submission succeeded'
+		failures = 0
+		prev = {0, 0, 0}
+		cur = {0, 0, 0}
+		start = now
+	end
+elseif state == 'closed' then
+	local weight = math.max(0, 1 - (now - start) / window)
+	local requests = cur[1] + prev[1] * weight
+	local fails = cur[2] + prev[2] * weight
+	local slows = cur[3] + prev[3] * weight
+	if failures >= consecutive then
+		reason = failures .. ' consecutive failures'
+	elseif requests >= minRequests and fails / requests >= failureRate then
+		reason = string.format('failure rate %.0f%% over %d submissions', 100 * fails / requests, math.floor(requests))
+	elseif requests >= minRequests and slows / requests >= slowRate then
+		reason = string.format('slow call rate %.0f%% over %d submissions', 100 * slows / requests, math.floor(requests))
+	end
+	if reason ~= '' then
+		state = 'open'
+		result = 1
+	end
+end
+
+redis.call('HSET', KEYS[1], 'state', state, 'failures', failures, 'window', window, 'window_start', start,
+	'requests', cur[1], 'failed', cur[2], 'slow', cur[3],
+	'prev_requests', prev[1], 'prev_failed', prev[2], 'prev_slow', prev[3])
+if result ~= 0 then
+	redis.call('HSET', KEYS[1], 'since', now)
+end
+if result == 1 then
+	redis.call('HSET', KEYS[1], 'retry_at', now + open)
+end
+return {result, reason}
+`)
+
+// trialScript lets one caller send the trial submission of an open breaker once it is due, moving it
+// half-open. A half-open breaker whose trial got no result by its deadline lets another one through.
+// It returns 2 when the breaker just went half-open, 1 for another trial and 0 when the caller may not send.
+var trialScript = redis.NewScript(`
+local open = tonumber(ARGV[1])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+
+local h = redis.call('HMGET', KEYS[1], 'state', 'retry_at')
+if (h[1] ~= 'open' and h[1] ~= 'half_open') or now < tonumber(h[2] or '0') then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'state', 'half_open', 'retry_at', now + open)
+if h[1] == 'open' then
+	redis.call('HSET', KEYS[1], 'since', now)
+	return 2
+end
+return 1
+`)
+
+// Breaker is the circuit breaker state of a channel shared by every consumer instance
+type Breaker struct {
+	ChannelID uint   `json:"channel_id"`
+	State     string `json:"state"`
+	// Failures counts the consecutive failed submissions
+	Failures int `json:"consecutive_failures"`
+	// Requests, FailureRate and SlowCallRate are measured over the sliding window
+	Requests     int     `json:"requests"`
+	FailureRate  float64 `json:"failure_rate"`
+	SlowCallRate float64 `json:"slow_call_rate"`
+	// Since is when the breaker last changed state
+	Since time.Time `json:"since,omitzero"`
+	// RetryAt is when an open breaker lets a trial submission through
+	RetryAt time.Time `json:"retry_at,omitzero"`
+}
+
+// Available reports whether the channel takes traffic without a trial
+func (b Breaker) Available() bool {
+	return b.State == StateClosed
+}
+
+// ReadBreakers reads the breakers of channels. Channels without recorded submissions are closed.
+func ReadBreakers(ctx context.Context, client *redis.Client, channels []Channel) ([]Breaker, error) {
+	pipe := client.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(channels))
+	for i, channel := range channels {
+		cmds[i] = pipe.HMGet(ctx, BreakerKey(channel.ChannelID), "state", "failures", "since", "retry_at", "window",
+			"window_start", "requests", "failed", "slow", "prev_requests", "prev_failed", "prev_slow")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	breakers := make([]Breaker, len(channels))
+	for i, cmd := range cmds {
+		var state string
+		values := make([]int64, 12)
+		for j, value := range cmd.Val() {
+			s, _ := value.(string)
+			if j == 0 {
+				state = s
+			} else if j < len(values) {
+				values[j], _ = strconv.ParseInt(s, 10, 64)
+			}
+		}
+		if state == "" {
+			state = StateClosed
+		}
+		breakers[i] = Breaker{
+			ChannelID: channels[i].ChannelID,
+			State:     state,
+			Failures:  int(values[1]),
+			Since:     millis(values[2]),
+			RetryAt:   millis(values[3]),
+		}
+
+		// Slide the window to now as the record script would
+		window, start := values[4], values[5]
+		cur, prev := values[6:9], values[9:12]
+		if window <= 0 {
+			continue
+		}
+		switch {
+		case now-start >= 2*window:
+			continue
+		case now-start >= window:
+			prev, cur = cur, []int64{0, 0, 0}
+			start += window
+		}
+		weight := math.Max(0, 1-float64(now-start)/float64(window))
+		requests := float64(cur[0]) + float64(prev[0])*weight
+		if requests > 0 {
+			breakers[i].Requests = int(math.Round(requests))
+			breakers[i].FailureRate = (float64(cur[1]) + float64(prev[1])*weight) / requests
+			breakers[i].SlowCallRate = (float64(cur[2]) + float64(prev[2])*weight) / requests
+		}
+	}
+	return breakers, nil
+}
+
+// Event announces a breaker transition
+type Event struct {
+	Type      string `json:"type"`
+	MNO       string `json:"mno"`
+	ChannelID uint   `json:"channel_id"`
+	// ActiveChannelID is the closed channel serving the MNO after the transition, 0 when none is
+	ActiveChannelID uint      `json:"active_channel_id"`
+	Reason          string    `json:"reason,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// Selector picks the channel of an MNO to submit on: the highest priority channel whose circuit
+// breaker is closed. When a breaker opens its traffic fails over to the next channel by priority; after
+// OpenDuration one trial submission is sent on it, closing the breaker on success.
+type Selector struct {
+	table   *Table
+	client  *redis.Client
+	Breaker BreakerConfig
+	// OnEvent is called with every transition announced by this selector
+	OnEvent func(Event)
+}
+
+// NewSelector creates a selector over the channels of table, keeping their breakers in Redis
+func NewSelector(table *Table, client *redis.Client, cfg BreakerConfig) *Selector {
+	return &Selector{table: table, client: client, Breaker: cfg}
+}
+
+// Select returns the channel to submit a message for an MNO on. An open channel due for a trial is
+// returned ahead of the closed channels of lower priority. When the breakers cannot be read the
+// channels are assumed closed. It returns an *UnavailableError when no channel may take the message.
+func (s *Selector) Select(ctx context.Context, mno string) (Channel, error) {
+	channels, err := s.table.Channels(ctx, mno)
+	if err != nil {
+		return Channel{}, err
+	}
+	if len(channels) == 0 {
+		return Channel{}, fmt.Errorf("no active channel for MNO %s", mno)
+	}
+	return s.pick(ctx, mno, channels)
+}
+
+// Allow returns nil when a message pinned to channel may be submitted on it, otherwise an *UnavailableError
+func (s *Selector) Allow(ctx context.Context, channel Channel) error {
+	_, err := s.pick(ctx, channel.MNO, []Channel{channel})
+	return err
+}
+
+func (s *Selector) pick(ctx context.Context, mno string, channels []Channel) (Channel, error) {
+	breakers, err := ReadBreakers(ctx, s.client, channels)
+	if err != nil {
+		log.Printf("Failed to read the breakers of %s channels: %v", mno, err)
+		return channels[0], nil
+	}
+
+	now := time.Now()
+	retryAfter := s.Breaker.OpenDuration
+	for i, channel := range channels {
+		if breakers[i].Available() {
+			return channel, nil
+		}
+		if wait := breakers[i].RetryAt.Sub(now); wait > 0 {
+			retryAfter = min(retryAfter, wait)
+			continue
+		}
+		trial, err := trialScript.Run(ctx, s.client, []string{BreakerKey(channel.ChannelID)}, s.Breaker.OpenDuration.Milliseconds()).Int()
+		if err != nil {
+			log.Printf("Failed to claim a trial on channel %d of %s: %v", channel.ChannelID, mno, err)
+			continue
+		}
+		if trial == 2 {
+			s.announce(ctx, Event{Type: EventHalfOpen, MNO: channel.MNO, ChannelID: channel.ChannelID, Reason: "sending a trial submission"})
+		}
+		if trial > 0 {
+			return channel, nil
+		}
+	}
+	return Channel{}, &UnavailableError{MNO: mno, RetryAfter: max(retryAfter, time.Second)}
+}
+
+// Record records the outcome of a submission on channel: failed when err is not nil, slow when it
+// took latency of at least the slow call threshold. Only errors telling the channel is unavailable,
+// such as timeouts and outages, should be recorded as failures.
+func (s *Selector) Record(ctx context.Context, channel Channel, latency time.Duration, err error) {
+	cfg := s.Breaker
+	failed, slow := "0", "0"
+	if err != nil {
+		failed = "1"
+	}
+	if cfg.SlowCall > 0 && latency >= cfg.SlowCall {
+		slow = "1"
+	}
+	consecutive := cfg.ConsecutiveFailures
+	if consecutive <= 0 {
+		consecutive = math.MaxInt32
+	}
+
+	result, scriptErr := recordScript.Run(ctx, s.client, []string{BreakerKey(channel.ChannelID)},
+		failed, slow, consecutive, threshold(cfg.FailureRate), threshold(cfg.SlowCallRate),
+		max(cfg.MinRequests, 1), max(cfg.Window, time.Second).Milliseconds(), cfg.OpenDuration.Milliseconds()).Slice()
+	if scriptErr != nil {
+		log.Printf("Failed to record a submission on channel %d of %s: %v", channel.ChannelID, channel.MNO, scriptErr)
+		return
+	}
+	if len(result) < 2 {
+		return
+	}
+	reason, _ := result[1].(string)
+	switch result[0] {
+	case int64(1):
+		if err != nil {
+			reason = fmt.Sprintf("%s, last: %v", reason, err)
+		}
+		s.announce(ctx, Event{Type: EventOpened, MNO: channel.MNO, ChannelID: channel.ChannelID, Reason: reason})
+	case int64(2):
+		s.announce(ctx, Event{Type: EventClosed, MNO: channel.MNO, ChannelID: channel.ChannelID, Reason: reason})
+	}
+}
+
+// threshold passes a disabled rate as one the measured rates cannot reach
+func threshold(rate float64) float64 {
+	if rate <= 0 {
+		return 2
+	}
+	return rate
+}
+
+// announce logs a transition and publishes it with the channel now serving the MNO
+func (s *Selector) announce(ctx context.Context, event Event) {
+	event.Timestamp = time.Now()
+	if channels, err := s.table.Channels(ctx, event.MNO); err == nil {
+		if breakers, err := ReadBreakers(ctx, s.client, channels); err == nil {
+			for i, breaker := range breakers {
+				if breaker.Available() {
+					event.ActiveChannelID = channels[i].ChannelID
+					break
+				}
+			}
+		}
+	}
+
+	log.Printf("MNO %s channel %d %s (%s), active channel: %d", event.MNO, event.ChannelID, event.Type, event.Reason, event.ActiveChannelID)
+	if s.OnEvent != nil {
+		s.OnEvent(event)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	pipe := s.client.Pipeline()
+	pipe.Publish(ctx, EventsChannel, data)
+	pipe.LPush(ctx, RecentEventsKey, data)
+	pipe.LTrim(ctx, RecentEventsKey, 0, recentEvents-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to announce %s of channel %d: %v", event.Type, event.ChannelID, err)
+	}
+}
+
+// RecentEvents returns up to limit of the latest breaker transitions, newest first
+func RecentEvents(ctx context.Context, client *redis.Client, limit int) ([]Event, error) {
+	if limit <= 0 || limit > recentEvents {
+		limit = recentEvents
+	}
+	items, err := client.LRange(ctx, RecentEventsKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(items))
+	for _, item := range items {
+		var event Event
+		if json.Unmarshal([]byte(item), &event) == nil {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// millis converts a Unix time in milliseconds to a time, zero when unset
+func millis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,154 @@
+package mnochannel
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// testClient returns a client of the Redis server in REDIS_URL, skipping the test when none is reachable
+func testClient(t *testing.T) *redis.Client {
+	t.Helper()
+	addr := os.Getenv("REDIS_URL")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr, DB: 15})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		t.Skipf("Redis is not reachable at %s: %v", addr, err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestBreakerConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    func(*BreakerConfig)
+		wantErr bool
+	}{
+		{"defaults", nil, func(*BreakerConfig) {}, false},
+		{"overrides", map[string]string{
+			"CHANNEL_FAILURE_THRESHOLD":    "3",
+			"CHANNEL_FAILURE_RATE":         "0.25",
+			"CHANNEL_SLOW_CALL":            "2s",
+			"CHANNEL_BREAKER_MIN_REQUESTS": "10",
+			"CHANNEL_PROBE_INTERVAL":       "1m",
+		}, func(cfg *BreakerConfig) {
+			cfg.ConsecutiveFailures = 3
+			cfg.FailureRate = 0.25
+			cfg.SlowCall = 2 * time.Second
+			cfg.MinRequests = 10
+			cfg.OpenDuration = time.Minute
+		}, false},
+		{"zero disables a threshold", map[string]string{"CHANNEL_FAILURE_THRESHOLD": "0", "CHANNEL_SLOW_CALL_RATE": "0"}, func(cfg *BreakerConfig) {
+			cfg.ConsecutiveFailures = 0
+			cfg.SlowCallRate = 0
+		}, false},
+		{"negative threshold", map[string]string{"CHANNEL_FAILURE_THRESHOLD": "-1"}, nil, true},
+		{"rate above 1", map[string]string{"CHANNEL_FAILURE_RATE": "1.5"}, nil, true},
+		{"invalid duration", map[string]string{"CHANNEL_BREAKER_WINDOW": "60"}, nil, true},
+		{"zero duration", map[string]string{"CHANNEL_PROBE_INTERVAL": "0s"}, nil, true},
+	}
+	keys := []string{"CHANNEL_FAILURE_THRESHOLD", "CHANNEL_FAILURE_RATE", "CHANNEL_SLOW_CALL", "CHANNEL_SLOW_CALL_RATE",
+		"CHANNEL_BREAKER_WINDOW", "CHANNEL_BREAKER_MIN_REQUESTS", "CHANNEL_PROBE_INTERVAL"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range keys {
+				t.Setenv(key, tt.env[key])
+			}
+			got, err := BreakerConfigFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BreakerConfigFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			want := DefaultBreakerConfig()
+			tt.want(&want)
+			if got != want {
+				t.Errorf("BreakerConfigFromEnv() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	for rate, want := range map[float64]float64{0: 2, -1: 2, 0.5: 0.5, 1: 1} {
+		if got := threshold(rate); got != want {
+			t.Errorf("threshold(%v) = %v, want %v", rate, got, want)
+		}
+	}
+}
+
+func TestUnavailableError(t *testing.T) {
+	var err error = &UnavailableError{MNO: "gp", RetryAfter: 5 * time.Second}
+	if !errors.Is(err, ErrNoHealthyChannel) {
+		t.Errorf("errors.Is(%v, ErrNoHealthyChannel) = false", err)
+	}
+	if want := "no healthy channel for MNO gp, retry in 5s"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+}
+
+func TestSelectorFailover(t *testing.T) {
+	client := testClient(t)
+	ctx := context.Background()
+	primary := Channel{MNO: "breaker-test", ChannelID: 9001, Type: "HTTP", Priority: 1, TPS: 10}
+	backup := Channel{MNO: "breaker-test", ChannelID: 9002, Type: "HTTP", Priority: 2, TPS: 10}
+	cleanup := func() {
+		client.Del(ctx, Key, BreakerKey(primary.ChannelID), BreakerKey(backup.ChannelID), RecentEventsKey)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+	if err := Sync(ctx, client, []Channel{backup, primary}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := BreakerConfig{ConsecutiveFailures: 3, MinRequests: 100, Window: time.Minute, OpenDuration: 200 * time.Millisecond}
+	selector := NewSelector(NewTable(client, time.Minute), client, cfg)
+	var events []string
+	selector.OnEvent = func(event Event) { events = append(events, event.Type) }
+
+	selected := func(want uint) {
+		t.Helper()
+		channel, err := selector.Select(ctx, "breaker-test")
+		if err != nil || channel.ChannelID != want {
+			t.Fatalf("Select() = channel %d, %v, want channel %d", channel.ChannelID, err, want)
+		}
+	}
+
+	selected(primary.ChannelID)
+	for i := 0; i < cfg.ConsecutiveFailures; i++ {
+		selector.Record(ctx, primary, time.Millisecond, errors.New("timeout"))
+	}
+	selected(backup.ChannelID)
+	if err := selector.Allow(ctx, primary); !errors.Is(err, ErrNoHealthyChannel) {
+		t.Errorf("Allow() on an open breaker = %v, want ErrNoHealthyChannel", err)
+	}
+
+	// After OpenDuration one trial submission is let through, and its success closes the breaker
+	time.Sleep(cfg.OpenDuration + 50*time.Millisecond)
+	selected(primary.ChannelID)
+	selected(backup.ChannelID)
+	selector.Record(ctx, primary, time.Millisecond, nil)
+	selected(primary.ChannelID)
+
+	want := []string{EventOpened, EventHalfOpen, EventClosed}
+	if len(events) != len(want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("events = %v, want %v", events, want)
+		}
+	}
+}
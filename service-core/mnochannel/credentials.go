@@ -0,0 +1,121 @@
+package mnochannel
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// CredentialsKeyEnv names the base64 encoded 32 byte AES key the SMPP passwords and HTTP adapter
+// configurations are encrypted with in Redis. The gateway and the consumers must share it.
+const CredentialsKeyEnv = "CHANNEL_CREDENTIALS_KEY"
+
+// credentials are the secrets of a channel, sealed into Channel.Sealed
+type credentials struct {
+	SMPPPassword string          `json:"smpp_password,omitempty"`
+	HTTP         json.RawMessage `json:"http,omitempty"`
+}
+
+var (
+	credentialsOnce sync.Once
+	credentialsAEAD cipher.AEAD
+	credentialsErr  error
+)
+
+// CheckCredentialsKey reports whether CredentialsKeyEnv holds a valid key
+func CheckCredentialsKey() error {
+	_, err := credentialsCipher()
+	return err
+}
+
+// credentialsCipher returns the AES-GCM cipher of the key in CredentialsKeyEnv
+func credentialsCipher() (cipher.AEAD, error) {
+	credentialsOnce.Do(func() {
+		value := os.Getenv(CredentialsKeyEnv)
+		if value == "" {
+			credentialsErr = fmt.Errorf("%s is not set", CredentialsKeyEnv)
+			return
+		}
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(key) != 32 {
+			credentialsErr = fmt.Errorf("%s must be a base64 encoded 32 byte key", CredentialsKeyEnv)
+			return
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			credentialsErr = err
+			return
+		}
+		credentialsAEAD, credentialsErr = cipher.NewGCM(block)
+	})
+	return credentialsAEAD, credentialsErr
+}
+
+// seal moves the SMPP password and HTTP configuration of the channel into Sealed, encrypted and bound to the channel ID
+func (c *Channel) seal() error {
+	secrets := credentials{HTTP: c.HTTP}
+	if c.SMPP != nil {
+		secrets.SMPPPassword = c.SMPP.Password
+	}
+	if secrets.SMPPPassword == "" && len(secrets.HTTP) == 0 {
+		return nil
+	}
+
+	aead, err := credentialsCipher()
+	if err != nil {
+		return fmt.Errorf("cannot encrypt its credentials: %v", err)
+	}
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, c.associatedData())
+	c.Sealed = base64.StdEncoding.EncodeToString(sealed)
+	return nil
+}
+
+// unseal restores the SMPP password and HTTP configuration of the channel from Sealed
+func (c *Channel) unseal() error {
+	if c.Sealed == "" {
+		return nil
+	}
+
+	aead, err := credentialsCipher()
+	if err != nil {
+		return fmt.Errorf("cannot decrypt its credentials: %v", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(c.Sealed)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return errors.New("invalid sealed credentials")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], c.associatedData())
+	if err != nil {
+		return errors.New("its credentials were encrypted with another " + CredentialsKeyEnv)
+	}
+	var secrets credentials
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return fmt.Errorf("invalid sealed credentials: %v", err)
+	}
+
+	if c.SMPP != nil {
+		c.SMPP.Password = secrets.SMPPPassword
+	}
+	c.HTTP = secrets.HTTP
+	c.Sealed = ""
+	return nil
+}
+
+func (c *Channel) associatedData() []byte {
+	return []byte(strconv.FormatUint(uint64(c.ChannelID), 10))
+}
@@ -0,0 +1,82 @@
+package mnochannel
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv(CredentialsKeyEnv, base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+	os.Exit(m.Run())
+}
+
+func TestSealRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel Channel
+	}{
+		{"no credentials", Channel{ChannelID: 1, Type: "HTTP"}},
+		{"SMPP password", Channel{ChannelID: 2, Type: "SMPP", SMPP: &SMPP{SystemID: "gw", Password: "secret"}}},
+		{"HTTP configuration", Channel{ChannelID: 3, Type: "HTTP", HTTP: json.RawMessage(`{"url":"https://mno.example/sms"}`)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := tt.channel
+			if channel.SMPP != nil {
+				smpp := *channel.SMPP
+				channel.SMPP = &smpp
+			}
+			if err := channel.seal(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Only the sealed form is stored in Redis
+			data, _ := json.Marshal(channel)
+			if strings.Contains(string(data), "secret") || strings.Contains(string(data), "mno.example") {
+				t.Fatalf("credentials stored in plaintext: %s", data)
+			}
+			var stored Channel
+			if err := json.Unmarshal(data, &stored); err != nil {
+				t.Fatal(err)
+			}
+			if err := stored.unseal(); err != nil {
+				t.Fatal(err)
+			}
+			if string(stored.HTTP) != string(tt.channel.HTTP) {
+				t.Errorf("HTTP = %s, want %s", stored.HTTP, tt.channel.HTTP)
+			}
+			if tt.channel.SMPP != nil && stored.SMPP.Password != tt.channel.SMPP.Password {
+				t.Errorf("password = %q, want %q", stored.SMPP.Password, tt.channel.SMPP.Password)
+			}
+		})
+	}
+}
+
+func TestUnsealAllSkipsFailedChannels(t *testing.T) {
+	good := Channel{MNO: "gp", ChannelID: 1, Type: "SMPP", SMPP: &SMPP{Password: "one"}}
+	moved := Channel{MNO: "gp", ChannelID: 2, Type: "SMPP", SMPP: &SMPP{Password: "two"}}
+	plain := Channel{MNO: "gp", ChannelID: 3, Type: "HTTP"}
+	for _, channel := range []*Channel{&good, &moved} {
+		if err := channel.seal(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Credentials are bound to their channel, so they cannot be copied onto another
+	moved.ChannelID = 4
+
+	byMNO := map[string][]Channel{"gp": {good, moved, plain}}
+	unsealAll(byMNO)
+	var ids []uint
+	for _, channel := range byMNO["gp"] {
+		ids = append(ids, channel.ChannelID)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Errorf("unsealed channels %v, want [1 3]", ids)
+	}
+	if byMNO["gp"][0].SMPP.Password != "one" {
+		t.Errorf("password = %q, want one", byMNO["gp"][0].SMPP.Password)
+	}
+}
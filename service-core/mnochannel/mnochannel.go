@@ -0,0 +1,236 @@
+// Package mnochannel shares the active MNO delivery channels with the consumers through Redis,
+// so they can pick a channel and its TPS without a database connection.
+package mnochannel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"myproject/ratelimit"
+)
+
+// Key is the Redis key holding the active channels of every active MNO
+const Key = "mno:channels"
+
+// DefaultRefresh is how long a Table serves channels before reading them from Redis again
+const DefaultRefresh = 10 * time.Second
+
+// Channel is an active delivery channel of an MNO
+type Channel struct {
+	MNO       string `json:"mno"`
+	ChannelID uint   `json:"channel_id"`
+	Type      string `json:"channel_type"`
+	Priority  int    `json:"priority"`
+	TPS       int    `json:"tps"`
+	// Allocations split the TPS across message types, ordered from the highest priority type
+	Allocations []Allocation `json:"allocations,omitempty"`
+	// SMPP holds the SMSC address and bind credentials of SMPP channels
+	SMPP *SMPP `json:"smpp,omitempty"`
+	// HTTP is the adapter configuration of HTTP channels, see mnoadapter.HTTPConfig
+	HTTP json.RawMessage `json:"-"`
+	// Sealed carries the SMPP password and HTTP configuration encrypted with CredentialsKeyEnv,
+	// so credentials are never stored in Redis in plaintext
+	Sealed string `json:"sealed,omitempty"`
+}
+
+// SMPP is the SMSC connection of an SMPP channel
+type SMPP struct {
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	SystemID   string `json:"system_id"`
+	Password   string `json:"-"`
+	SystemType string `json:"system_type"`
+	BindMode   string `json:"bind_mode"`
+	WindowSize int    `json:"window_size"`
+	SourceAddr string `json:"source_addr"`
+}
+
+// IsSMPP reports whether messages are submitted to the channel over SMPP
+func (c Channel) IsSMPP() bool {
+	return strings.EqualFold(c.Type, "SMPP") && c.SMPP != nil
+}
+
+// Allocation is the share of a channel's TPS reserved for a message type
+type Allocation struct {
+	Type string `json:"type"`
+	// Share is the percentage of the channel TPS
+	Share int `json:"share"`
+	// Level is the priority level of the type (0 = highest); a type may borrow the unused share of lower priority types
+	Level int `json:"priority_level"`
+}
+
+// Buckets returns the token buckets a message of msgType is limited by, its own first, followed by
+// the buckets it may borrow unused capacity from: the shares of lower priority types, lowest first,
+// and the share left unallocated. Types without an allocation only use the unallocated share.
+// It returns no buckets when the type has no capacity on the channel.
+func (c Channel) Buckets(msgType string) []ratelimit.Bucket {
+	if len(c.Allocations) == 0 {
+		return []ratelimit.Bucket{{Key: ratelimit.ChannelKey(c.ChannelID), TPS: float64(c.TPS)}}
+	}
+
+	msgType = strings.ToLower(msgType)
+	allocated := 0
+	var own *Allocation
+	for i, allocation := range c.Allocations {
+		allocated += allocation.Share
+		if allocation.Type == msgType {
+			own = &c.Allocations[i]
+		}
+	}
+
+	var buckets []ratelimit.Bucket
+	if own != nil {
+		buckets = append(buckets, ratelimit.Bucket{Key: ratelimit.TypeKey(c.ChannelID, own.Type), TPS: c.share(own.Share)})
+		for i := len(c.Allocations) - 1; i >= 0; i-- {
+			if lender := c.Allocations[i]; lender.Level > own.Level {
+				buckets = append(buckets, ratelimit.Bucket{Key: ratelimit.TypeKey(c.ChannelID, lender.Type), TPS: c.share(lender.Share)})
+			}
+		}
+	}
+	if allocated < 100 {
+		buckets = append(buckets, ratelimit.Bucket{Key: ratelimit.ChannelKey(c.ChannelID), TPS: c.share(100 - allocated)})
+	}
+
+	limited := buckets[:0]
+	for _, bucket := range buckets {
+		if bucket.TPS > 0 {
+			limited = append(limited, bucket)
+		}
+	}
+	return limited
+}
+
+// share converts a percentage of the channel TPS to tokens per second
+func (c Channel) share(percent int) float64 {
+	return float64(c.TPS) * float64(percent) / 100
+}
+
+// Sync stores the channels in Redis with their credentials sealed, replacing the previous set.
+// Channels whose credentials cannot be sealed are left out, so the consumers fail over from them.
+func Sync(ctx context.Context, client *redis.Client, channels []Channel) error {
+	sealed := make([]Channel, 0, len(channels))
+	for _, channel := range channels {
+		if channel.SMPP != nil {
+			smpp := *channel.SMPP
+			channel.SMPP = &smpp
+		}
+		if err := channel.seal(); err != nil {
+			log.Printf("Skipping channel %d of %s: %v", channel.ChannelID, channel.MNO, err)
+			continue
+		}
+		sealed = append(sealed, channel)
+	}
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		return err
+	}
+	if err := client.Set(ctx, Key, data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to sync MNO channels: %v", err)
+	}
+	return nil
+}
+
+// Load reads the channels from Redis grouped by lower-case MNO name, each ordered by priority.
+// Their credentials stay sealed; use a Table to submit on them.
+func Load(ctx context.Context, client *redis.Client) (map[string][]Channel, error) {
+	data, err := client.Get(ctx, Key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return map[string][]Channel{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var channels []Channel
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return nil, fmt.Errorf("invalid MNO channels: %v", err)
+	}
+
+	byMNO := make(map[string][]Channel)
+	for _, channel := range channels {
+		mno := strings.ToLower(channel.MNO)
+		byMNO[mno] = append(byMNO[mno], channel)
+	}
+	for _, list := range byMNO {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Priority < list[j].Priority })
+	}
+	return byMNO, nil
+}
+
+// unsealAll restores the credentials of every channel, leaving out the channels whose credentials cannot be read
+func unsealAll(byMNO map[string][]Channel) {
+	for mno, channels := range byMNO {
+		unsealed := channels[:0]
+		for _, channel := range channels {
+			if err := channel.unseal(); err != nil {
+				log.Printf("Skipping channel %d of %s: %v", channel.ChannelID, channel.MNO, err)
+				continue
+			}
+			unsealed = append(unsealed, channel)
+		}
+		byMNO[mno] = unsealed
+	}
+}
+
+// Table is a cached copy of the channels in Redis with their credentials, refreshed when it is older than
+// the refresh interval
+type Table struct {
+	client   *redis.Client
+	refresh  time.Duration
+	mu       sync.Mutex
+	channels map[string][]Channel
+	loadedAt time.Time
+}
+
+// NewTable creates a table reading from client
+func NewTable(client *redis.Client, refresh time.Duration) *Table {
+	if refresh <= 0 {
+		refresh = DefaultRefresh
+	}
+	return &Table{client: client, refresh: refresh}
+}
+
+// Channels returns the active channels of an MNO ordered by priority. A failed refresh keeps
+// serving the last channels read.
+func (t *Table) Channels(ctx context.Context, mno string) ([]Channel, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.channels == nil || time.Since(t.loadedAt) >= t.refresh {
+		channels, err := Load(ctx, t.client)
+		if err == nil {
+			unsealAll(channels)
+		}
+		if err != nil && t.channels == nil {
+			return nil, err
+		}
+		if err == nil {
+			t.channels = channels
+		}
+		t.loadedAt = time.Now()
+	}
+	return t.channels[strings.ToLower(mno)], nil
+}
+
+// Find returns a channel of an MNO by ID
+func (t *Table) Find(ctx context.Context, mno string, channelID uint) (Channel, bool, error) {
+	channels, err := t.Channels(ctx, mno)
+	if err != nil {
+		return Channel{}, false, err
+	}
+	for _, channel := range channels {
+		if channel.ChannelID == channelID {
+			return channel, true, nil
+		}
+	}
+	return Channel{}, false, nil
+}
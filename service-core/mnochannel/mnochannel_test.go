@@ -0,0 +1,67 @@
+package mnochannel
+
+import (
+	"reflect"
+	"testing"
+
+	"myproject/ratelimit"
+)
+
+func TestBuckets(t *testing.T) {
+	allocated := Channel{ChannelID: 7, TPS: 200, Allocations: []Allocation{
+		{Type: "otp", Share: 50, Level: 0},
+		{Type: "transactional", Share: 30, Level: 1},
+		{Type: "promotional", Share: 10, Level: 3},
+	}}
+	full := Channel{ChannelID: 8, TPS: 100, Allocations: []Allocation{
+		{Type: "otp", Share: 60, Level: 0},
+		{Type: "promotional", Share: 40, Level: 3},
+	}}
+	tests := []struct {
+		name    string
+		channel Channel
+		msgType string
+		want    []ratelimit.Bucket
+	}{
+		{"no allocations", Channel{ChannelID: 7, TPS: 200}, "otp", []ratelimit.Bucket{
+			{Key: ratelimit.ChannelKey(7), TPS: 200},
+		}},
+		{"highest priority borrows from every lower type, lowest first", allocated, "otp", []ratelimit.Bucket{
+			{Key: ratelimit.TypeKey(7, "otp"), TPS: 100},
+			{Key: ratelimit.TypeKey(7, "promotional"), TPS: 20},
+			{Key: ratelimit.TypeKey(7, "transactional"), TPS: 60},
+			{Key: ratelimit.ChannelKey(7), TPS: 20},
+		}},
+		{"type is matched case-insensitively", allocated, "Transactional", []ratelimit.Bucket{
+			{Key: ratelimit.TypeKey(7, "transactional"), TPS: 60},
+			{Key: ratelimit.TypeKey(7, "promotional"), TPS: 20},
+			{Key: ratelimit.ChannelKey(7), TPS: 20},
+		}},
+		{"lowest priority never borrows from higher types", allocated, "promotional", []ratelimit.Bucket{
+			{Key: ratelimit.TypeKey(7, "promotional"), TPS: 20},
+			{Key: ratelimit.ChannelKey(7), TPS: 20},
+		}},
+		{"unallocated type uses the unallocated share", allocated, "general", []ratelimit.Bucket{
+			{Key: ratelimit.ChannelKey(7), TPS: 20},
+		}},
+		{"unallocated type on a fully allocated channel", full, "general", nil},
+		{"fully allocated channel has no shared bucket", full, "otp", []ratelimit.Bucket{
+			{Key: ratelimit.TypeKey(8, "otp"), TPS: 60},
+			{Key: ratelimit.TypeKey(8, "promotional"), TPS: 40},
+		}},
+		{"zero TPS shares are left out", Channel{ChannelID: 9, TPS: 1, Allocations: []Allocation{{Type: "otp", Share: 0}}}, "otp", []ratelimit.Bucket{
+			{Key: ratelimit.ChannelKey(9), TPS: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.channel.Buckets(tt.msgType)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Buckets(%q) = %+v, want %+v", tt.msgType, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+// AuditLog records an operator action
+// @Description Records who performed an operational action and on what
+type AuditLog struct {
+	BaseModel
+	// UserID is the ID of the user who performed the action
+	UserID string `gorm:"not null;index" json:"user_id"`
+
+	// Action is the name of the action, e.g. dlq.replay
+	Action string `gorm:"not null;index" json:"action"`
+
+	// Resource is what the action was performed on, e.g. a queue name
+	Resource string `gorm:"not null" json:"resource"`
+
+	// Details holds the request parameters and outcome as JSON
+	Details string `gorm:"type:text" json:"details"`
+}
@@ -10,6 +10,9 @@ type CampaignRecipient struct {
 	// RecipientID is the ID of the recipient (foreign key)
 	Recipient uint `gorm:"not null" json:"recipient"`
 
+	// MSISDN is the recipient's mobile number in local 11-digit form
+	MSISDN string `gorm:"index" json:"msisdn"`
+
 	// Status indicates the delivery status of the campaign to the recipient
 	Status string `gorm:"not null" json:"status"`
 
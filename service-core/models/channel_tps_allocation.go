@@ -0,0 +1,15 @@
+package models
+
+// ChannelTPSAllocation reserves a share of an MNO channel's TPS for a message type
+// @Description Represents the percentage of an MNO channel's TPS reserved for an SMS type (e.g., 60% OTP)
+type ChannelTPSAllocation struct {
+	BaseModel
+	// ChannelID is the ID of the MNO channel the share belongs to
+	ChannelID uint `gorm:"not null;uniqueIndex:idx_channel_message_type" json:"channel_id"`
+
+	// Message_Type is the type of SMS the share is reserved for (e.g., OTP, Transaction, Promotional)
+	Message_Type string `gorm:"not null;uniqueIndex:idx_channel_message_type" json:"message_type"`
+
+	// Share_Percent is the percentage of the channel TPS reserved for the SMS type; the allocations of a channel add up to at most 100
+	Share_Percent int `gorm:"not null" json:"share_percent"`
+}
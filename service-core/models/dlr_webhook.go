@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DLRWebhook is the delivery receipt callback registered by a client application
+// @Description Callback URL that receives signed delivery receipts for the messages of a client application
+type DLRWebhook struct {
+	BaseModel
+	// App is the client application (JWT subject) the webhook belongs to
+	App string `gorm:"not null;uniqueIndex" json:"app"`
+
+	// CallbackURL receives a POST for every terminal message status
+	CallbackURL string `gorm:"not null" json:"callback_url"`
+
+	// Secret signs the callback body with HMAC-SHA256, it is only returned when the webhook is created
+	Secret string `gorm:"not null" json:"-"`
+
+	// Active disables callbacks without removing the webhook
+	Active bool `gorm:"not null;default:true" json:"active"`
+}
+
+// DLRAttempt records one attempt to deliver a receipt to a webhook
+// @Description One POST of a delivery receipt to a client callback URL
+type DLRAttempt struct {
+	BaseModel
+	WebhookID uuid.UUID `gorm:"type:uuid;not null;index" json:"webhook_id"`
+	App       string    `gorm:"not null;index" json:"app"`
+	MsgID     string    `gorm:"not null;index" json:"msg_id"`
+
+	// Status is the message status carried by the receipt
+	Status string `gorm:"not null" json:"status"`
+
+	// Attempt is the 1-based delivery attempt number
+	Attempt int `gorm:"not null" json:"attempt"`
+
+	// ResponseCode is the HTTP status returned by the callback, 0 when no response was received
+	ResponseCode int    `json:"response_code"`
+	Error        string `json:"error,omitempty"`
+	Delivered    bool   `gorm:"not null" json:"delivered"`
+
+	// NextRetryAt is set when the receipt was queued for another attempt
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty"`
+}
@@ -4,8 +4,8 @@ package models
 // @Description Represents a phone number that should not receive promotional SMS
 type DND struct {
 	BaseModel
-	// Phone_Number is the number that should not receive promotional SMS
-	Phone_Number string `gorm:"not null" json:"phone_number"`
+	// Phone_Number is the number that should not receive promotional SMS, stored in local 11-digit form
+	Phone_Number string `gorm:"not null;index" json:"phone_number"`
 
 	// Reason provides the reason for adding the number to the DND list
 	Reason string `gorm:"not null" json:"reason"`
@@ -7,7 +7,7 @@ type MNO struct {
 	// MNO_Name is the name of the Mobile Network Operator (e.g., GP, BL, RB)
 	MNO_Name string `gorm:"not null" json:"mno_name"`
 
-	// Prefix is the phone number prefix associated with the MNO (e.g., 017, 019)
+	// Prefix is the comma separated list of phone number prefixes associated with the MNO (e.g., 017, 013)
 	Prefix string `gorm:"not null" json:"prefix"`
 
 	// Channels represents the delivery channels associated with the MNO
@@ -1,5 +1,7 @@
 package models
 
+import "github.com/google/uuid"
+
 // Channel represents a delivery channel for an MNO
 // @Description Represents a delivery channel (e.g., HTTP, SMPP) for an MNO
 type MnoChannels struct {
@@ -8,7 +10,7 @@ type MnoChannels struct {
 	ChannelID uint `gorm:"primaryKey;autoIncrement" json:"channel_id"`
 
 	// MNOID is the ID of the MNO associated with this channel
-	MNOID uint `gorm:"not null" json:"mno_id"`
+	MNOID uuid.UUID `gorm:"type:uuid;not null" json:"mno_id"`
 
 	// ChannelType is the type of the channel (HTTP or SMPP)
 	ChannelType string `gorm:"not null" json:"channel_type"`
@@ -21,4 +23,29 @@ type MnoChannels struct {
 
 	// Status indicates whether the channel is active or inactive
 	Status string `gorm:"not null" json:"status"`
+
+	// Host and Port are the address of the MNO's SMSC for SMPP channels
+	Host string `json:"host"`
+	Port int    `json:"port"`
+
+	// SystemID, Password and SystemType are the SMPP bind credentials; the password is never returned by the API
+	SystemID   string `json:"system_id"`
+	Password   string `json:"-"`
+	SystemType string `json:"system_type"`
+
+	// BindMode is transmitter, receiver or transceiver (default)
+	BindMode string `json:"bind_mode"`
+
+	// WindowSize is the number of submissions awaiting an SMSC response at any time (0 = default)
+	WindowSize int `json:"window_size"`
+
+	// SourceAddr is the sender ID or number messages are submitted from
+	SourceAddr string `json:"source_addr"`
+
+	// HTTPConfig is the JSON request template, auth scheme and response rules of an HTTP channel's API.
+	// It may hold credentials, so it is never returned by the API.
+	HTTPConfig string `gorm:"type:text" json:"-"`
+
+	// TPSAllocations split the TPS across SMS types; capacity left unallocated is shared by all types
+	TPSAllocations []ChannelTPSAllocation `gorm:"foreignKey:ChannelID;references:ChannelID" json:"tps_allocations,omitempty"`
 }
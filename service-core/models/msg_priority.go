@@ -10,6 +10,9 @@ type MsgPriority struct {
 	// Priority_Level is the priority level for the SMS type (0 = Highest, 3 = Lowest)
 	Priority_Level int `gorm:"not null" json:"priority_level"`
 
+	// Weight is the share of consumer workers the type gets while lower types are also waiting (0 = derived from the priority level)
+	Weight int `gorm:"not null;default:0" json:"weight"`
+
 	// Description provides additional details about the priority level
 	Description string `gorm:"not null" json:"description"`
 }
@@ -0,0 +1,109 @@
+package msgid
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IDs are 63-bit integers laid out Snowflake style:
+// 41 bits of milliseconds since Epoch | 10 bits of node ID | 12 bits of sequence.
+// They are rendered as zero-padded 19 digit strings so that string order matches time order.
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+
+	// MaxNodeID is the highest node ID that can be configured
+	MaxNodeID = 1<<nodeBits - 1
+
+	maxSequence = 1<<sequenceBits - 1
+	idLength    = 19
+)
+
+// Epoch is the reference time for the timestamp part of an ID
+var Epoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Generator produces message IDs that are unique for one node ID
+type Generator struct {
+	mu       sync.Mutex
+	nodeID   int64
+	lastMs   int64
+	sequence int64
+}
+
+// NewGenerator creates a generator for the given node ID
+func NewGenerator(nodeID int) (*Generator, error) {
+	if nodeID < 0 || nodeID > MaxNodeID {
+		return nil, fmt.Errorf("node ID must be between 0 and %d, got %d", MaxNodeID, nodeID)
+	}
+	return &Generator{nodeID: int64(nodeID)}, nil
+}
+
+// Next returns the next message ID
+func (g *Generator) Next() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := sinceEpoch(time.Now())
+	if now < g.lastMs {
+		// The clock moved backwards; keep issuing IDs from the last timestamp
+		now = g.lastMs
+	}
+
+	if now == g.lastMs {
+		g.sequence = (g.sequence + 1) & maxSequence
+		if g.sequence == 0 {
+			// Sequence exhausted for this millisecond, wait for the next one
+			for now <= g.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				now = sinceEpoch(time.Now())
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastMs = now
+
+	id := now<<(nodeBits+sequenceBits) | g.nodeID<<sequenceBits | g.sequence
+	return fmt.Sprintf("%0*d", idLength, id)
+}
+
+// Time returns the creation time encoded in a message ID. It fails for IDs that are not 19 digit
+// snowflakes, such as the 18 digit IDs issued before them.
+func Time(id string) (time.Time, error) {
+	value, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || len(id) != idLength {
+		return time.Time{}, fmt.Errorf("invalid message ID: %s", id)
+	}
+	ms := value >> (nodeBits + sequenceBits)
+	return Epoch.Add(time.Duration(ms) * time.Millisecond), nil
+}
+
+func sinceEpoch(t time.Time) int64 {
+	return t.Sub(Epoch).Milliseconds()
+}
+
+var defaultGenerator atomic.Pointer[Generator]
+
+func init() {
+	generator, _ := NewGenerator(0)
+	defaultGenerator.Store(generator)
+}
+
+// SetNodeID configures the node ID used by New. It must be unique per running instance
+// and set before IDs are issued.
+func SetNodeID(nodeID int) error {
+	generator, err := NewGenerator(nodeID)
+	if err != nil {
+		return err
+	}
+	defaultGenerator.Store(generator)
+	return nil
+}
+
+// New returns the next message ID from the default generator
+func New() string {
+	return defaultGenerator.Load().Next()
+}
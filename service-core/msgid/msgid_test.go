@@ -0,0 +1,79 @@
+package msgid
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewGenerator(t *testing.T) {
+	tests := []struct {
+		nodeID  int
+		wantErr bool
+	}{
+		{0, false},
+		{MaxNodeID, false},
+		{-1, true},
+		{MaxNodeID + 1, true},
+	}
+	for _, tt := range tests {
+		if _, err := NewGenerator(tt.nodeID); (err != nil) != tt.wantErr {
+			t.Errorf("NewGenerator(%d) error = %v, wantErr %v", tt.nodeID, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNextOrdering(t *testing.T) {
+	for _, nodeID := range []int{0, 1, MaxNodeID} {
+		generator, err := NewGenerator(nodeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// More than one millisecond's worth of sequence numbers, so the generator has to roll over
+		previous := ""
+		for i := 0; i < 2*(maxSequence+1); i++ {
+			id := generator.Next()
+			if len(id) != idLength {
+				t.Fatalf("node %d: ID %q has %d digits", nodeID, id, len(id))
+			}
+			if id <= previous {
+				t.Fatalf("node %d: ID %q does not sort after %q", nodeID, id, previous)
+			}
+			value, _ := strconv.ParseInt(id, 10, 64)
+			if got := int(value >> sequenceBits & MaxNodeID); got != nodeID {
+				t.Fatalf("node %d: ID %q carries node %d", nodeID, id, got)
+			}
+			previous = id
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	generator, _ := NewGenerator(7)
+	before := time.Now().Truncate(time.Millisecond)
+	id := generator.Next()
+	after := time.Now()
+
+	tests := []struct {
+		id      string
+		wantErr bool
+	}{
+		{id, false},
+		{"0000000000000000000", false},
+		{"123456789012345678", true},
+		{"12345678901234567890", true},
+		{"not-a-message-id-00", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		got, err := Time(tt.id)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Time(%q) error = %v, wantErr %v", tt.id, err, tt.wantErr)
+			continue
+		}
+		if tt.id == id && (got.Before(before) || got.After(after)) {
+			t.Errorf("Time(%q) = %v, want between %v and %v", tt.id, got, before, after)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package msisdn
+
+import (
+	"errors"
+	"strings"
+)
+
+// CountryCode is the Bangladesh country calling code
+const CountryCode = "880"
+
+var (
+	// ErrEmpty is returned when no number was given
+	ErrEmpty = errors.New("MSISDN is required")
+	// ErrNotNumeric is returned when the number contains characters other than digits
+	ErrNotNumeric = errors.New("MSISDN must contain digits only")
+	// ErrInvalidLength is returned when the number is not a Bangladeshi mobile number length
+	ErrInvalidLength = errors.New("MSISDN must be an 11-digit local or 13-digit international Bangladeshi number")
+	// ErrInvalidOperatorRange is returned when the number is outside the mobile operator ranges
+	ErrInvalidOperatorRange = errors.New("MSISDN is not in a Bangladeshi mobile operator range")
+)
+
+// operatorRanges are the third digit of the local 01X prefixes allocated to mobile operators
+const operatorRanges = "3456789"
+
+// Normalize converts an MSISDN in local (01712345678), national (1712345678),
+// international (8801712345678, +8801712345678, 008801712345678) form to the
+// local 11-digit form. Spaces and hyphens are ignored.
+func Normalize(input string) (string, error) {
+	number := strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(input))
+	if number == "" {
+		return "", ErrEmpty
+	}
+
+	number = strings.TrimPrefix(number, "+")
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return "", ErrNotNumeric
+		}
+	}
+
+	switch {
+	case len(number) == 15 && strings.HasPrefix(number, "00"+CountryCode):
+		number = "0" + number[5:]
+	case len(number) == 13 && strings.HasPrefix(number, CountryCode):
+		number = "0" + number[3:]
+	case len(number) == 10 && number[0] == '1':
+		number = "0" + number
+	}
+
+	if len(number) != 11 {
+		return "", ErrInvalidLength
+	}
+	if !strings.HasPrefix(number, "01") || !strings.ContainsRune(operatorRanges, rune(number[2])) {
+		return "", ErrInvalidOperatorRange
+	}
+	return number, nil
+}
+
+// ToE164 converts a normalized local MSISDN to E.164 form (+8801712345678)
+func ToE164(local string) string {
+	return "+" + CountryCode + strings.TrimPrefix(local, "0")
+}
+
+// E164 normalizes an MSISDN in any accepted form and returns it in E.164 form
+func E164(input string) (string, error) {
+	local, err := Normalize(input)
+	if err != nil {
+		return "", err
+	}
+	return ToE164(local), nil
+}
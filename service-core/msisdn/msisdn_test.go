@@ -0,0 +1,54 @@
+package msisdn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr error
+	}{
+		{"01712345678", "01712345678", nil},
+		{"1712345678", "01712345678", nil},
+		{"8801712345678", "01712345678", nil},
+		{"+8801712345678", "01712345678", nil},
+		{"008801712345678", "01712345678", nil},
+		{" +880 1712-345678 ", "01712345678", nil},
+		{"01312345678", "01312345678", nil},
+		{"01912345678", "01912345678", nil},
+		{"", "", ErrEmpty},
+		{"   ", "", ErrEmpty},
+		{"0171234567a", "", ErrNotNumeric},
+		{"++8801712345678", "", ErrNotNumeric},
+		{"0171234567", "", ErrInvalidLength},
+		{"017123456789", "", ErrInvalidLength},
+		{"+9101712345678", "", ErrInvalidLength},
+		{"01212345678", "", ErrInvalidOperatorRange},
+		{"02712345678", "", ErrInvalidOperatorRange},
+		{"8801212345678", "", ErrInvalidOperatorRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Normalize(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Normalize(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestE164(t *testing.T) {
+	got, err := E164("01712345678")
+	if err != nil || got != "+8801712345678" {
+		t.Errorf("E164() = %q, %v", got, err)
+	}
+	if _, err := E164("12345"); err == nil {
+		t.Error("E164() accepted an invalid number")
+	}
+}
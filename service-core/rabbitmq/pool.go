@@ -0,0 +1,225 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Default size of the publishing pool.
+const (
+	DefaultPoolConnections       = 2
+	DefaultChannelsPerConnection = 8
+)
+
+const (
+	reconnectMinDelay = 1 * time.Second
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// PoolConfig sizes the publishing pool. Connections are spread across the cluster nodes.
+type PoolConfig struct {
+	Connections           int
+	ChannelsPerConnection int
+}
+
+func (p PoolConfig) withDefaults() PoolConfig {
+	if p.Connections <= 0 {
+		p.Connections = DefaultPoolConnections
+	}
+	if p.ChannelsPerConnection <= 0 {
+		p.ChannelsPerConnection = DefaultChannelsPerConnection
+	}
+	return p
+}
+
+// pooledChannel is a confirm-mode publishing channel and the connection it belongs to.
+type pooledChannel struct {
+	ch   *amqp.Channel
+	conn *amqp.Connection
+}
+
+// connectSlot dials the cluster for one pool connection, restores the topology and fills the pool
+// with its channels. Slots start at different nodes so the pool spans the cluster.
+func (r *RabbitMQ) connectSlot(slot int) (*amqp.Connection, error) {
+	var lastErr error
+	for i := range r.urls {
+		url := r.urls[(slot+i)%len(r.urls)]
+		conn, err := amqp.Dial(url)
+		if err != nil {
+			log.Printf("Failed to connect to RabbitMQ at %s: %v", url, err)
+			lastErr = err
+			continue
+		}
+
+		if err := r.restoreTopology(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		for j := 0; j < r.poolConfig.ChannelsPerConnection; j++ {
+			pc, err := openPooledChannel(conn)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			r.release(pc)
+		}
+
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			conn.Close()
+			return nil, errors.New("RabbitMQ connection is closed")
+		}
+		r.conns[slot] = conn
+		r.mu.Unlock()
+
+		log.Printf("Connected to RabbitMQ at %s (pool connection %d)", url, slot)
+		return conn, nil
+	}
+	return nil, fmt.Errorf("failed to connect to any RabbitMQ node: %v", lastErr)
+}
+
+// maintain reconnects a pool connection whenever the broker closes it, without blocking publishers.
+func (r *RabbitMQ) maintain(slot int, conn *amqp.Connection) {
+	for {
+		closeErr := <-conn.NotifyClose(make(chan *amqp.Error, 1))
+		if r.isClosed() {
+			return
+		}
+		log.Printf("RabbitMQ pool connection %d closed: %v, reconnecting", slot, closeErr)
+		r.drain(conn)
+
+		delay := reconnectMinDelay
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-time.After(delay):
+			}
+
+			next, err := r.connectSlot(slot)
+			if err == nil {
+				conn = next
+				log.Printf("Reconnected RabbitMQ pool connection %d", slot)
+				break
+			}
+			log.Printf("Reconnect of pool connection %d failed: %v", slot, err)
+			delay = min(delay*2, reconnectMaxDelay)
+		}
+	}
+}
+
+// restoreTopology declares the topology and every queue declared since startup on a new connection.
+func (r *RabbitMQ) restoreTopology(conn *amqp.Connection) error {
+	if err := CheckBrokerVersion(conn); err != nil {
+		return err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %v", err)
+	}
+	defer ch.Close()
+
+	if err := r.topology.Declare(ch); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	queues := make([]string, 0, len(r.declared))
+	for queue := range r.declared {
+		queues = append(queues, queue)
+	}
+	r.mu.Unlock()
+
+	for _, queue := range queues {
+		if err := r.topology.DeclareQueue(ch, queue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func openPooledChannel(conn *amqp.Connection) (*pooledChannel, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open channel: %v", err)
+	}
+	// Publishes are only reported as queued once the broker confirms them
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+	return &pooledChannel{ch: ch, conn: conn}, nil
+}
+
+// acquire takes an open channel from the pool, waiting up to ConfirmTimeout for one to be released.
+func (r *RabbitMQ) acquire() (*pooledChannel, error) {
+	timeout := time.NewTimer(ConfirmTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case pc := <-r.pool:
+			if !pc.ch.IsClosed() {
+				return pc, nil
+			}
+			r.discard(pc)
+		case <-r.done:
+			return nil, errors.New("RabbitMQ connection is closed")
+		case <-timeout.C:
+			return nil, errors.New("no RabbitMQ channel available")
+		}
+	}
+}
+
+// release returns a channel to the pool, dropping it when it was closed while in use.
+func (r *RabbitMQ) release(pc *pooledChannel) {
+	if pc.ch.IsClosed() {
+		r.discard(pc)
+		return
+	}
+	select {
+	case r.pool <- pc:
+	default:
+		pc.ch.Close()
+	}
+}
+
+// discard drops a closed channel. A channel closed by a channel-level error is replaced
+// when its connection is still open; the channels of a closed connection are refilled on reconnect.
+func (r *RabbitMQ) discard(pc *pooledChannel) {
+	if pc.conn.IsClosed() || r.isClosed() {
+		return
+	}
+	replacement, err := openPooledChannel(pc.conn)
+	if err != nil {
+		log.Printf("Failed to replace closed RabbitMQ channel: %v", err)
+		return
+	}
+	r.release(replacement)
+}
+
+// drain removes the idle channels of a closed connection from the pool.
+func (r *RabbitMQ) drain(conn *amqp.Connection) {
+	for n := len(r.pool); n > 0; n-- {
+		select {
+		case pc := <-r.pool:
+			if pc.conn != conn {
+				r.release(pc)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (r *RabbitMQ) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
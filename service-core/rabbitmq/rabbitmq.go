@@ -1,291 +1,282 @@
 package rabbitmq
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-// RabbitMQ represents a connection to a RabbitMQ cluster with Quorum Queues.
+// MaxPriority is the highest AMQP priority set on published messages. Message types are
+// separated by queue in the topology, the priority orders messages within a queue.
+const MaxPriority = 4
+
+// ConfirmTimeout is how long a publish waits for the broker to confirm it.
+const ConfirmTimeout = 5 * time.Second
+
+var (
+	// ErrNacked is returned when the broker refuses responsibility for a published message.
+	ErrNacked = errors.New("message was nacked by the broker")
+	// ErrConfirmTimeout is returned when the broker did not confirm a message within ConfirmTimeout.
+	ErrConfirmTimeout = errors.New("timed out waiting for publisher confirm")
+)
+
+// RabbitMQ publishes to a RabbitMQ cluster with Quorum Queues through a pool of confirm-mode
+// channels spread over several connections. It is safe for concurrent use.
 type RabbitMQ struct {
-	conn          *amqp.Connection
-	channel       *amqp.Channel
 	urls          []string // List of RabbitMQ node URLs
-	currentURL    string
+	poolConfig    PoolConfig
+	pool          chan *pooledChannel
+	conns         []*amqp.Connection // Current connection of each pool slot
 	mu            sync.Mutex
-	reconnectChan chan bool
+	done          chan struct{}
 	closed        bool
-	managementURL string // URL for RabbitMQ Management API (e.g., http://localhost:15672)
-	username      string // Management API username
-	password      string // Management API password
+	topology      Topology
+	declared      map[string]bool // Queues already declared by EnsureQueue
+	managementURL string          // URL for RabbitMQ Management API (e.g., http://localhost:15672)
+	username      string          // Management API username
+	password      string          // Management API password
+	statsMu       sync.Mutex
+	statsCache    map[string]cachedStatistics // Recent statistics by vhost filter
 }
 
-// QueueStats represents key statistics for a RabbitMQ queue
-type QueueStats struct {
-	Messages        int64   `json:"messages"`
-	MessagesReady   int64   `json:"messages_ready"`
-	MessagesUnacked int64   `json:"messages_unacknowledged"`
-	PublishRate     float64 `json:"publish_rate,omitempty"`
-	DeliverRate     float64 `json:"deliver_rate,omitempty"`
-	AcknowledgeRate float64 `json:"acknowledge_rate,omitempty"`
-	ConsumerCount   int     `json:"consumers"`
-}
-
-// NodeStats represents key statistics for a RabbitMQ node
-type NodeStats struct {
-	MemoryUsed    int64 `json:"mem_used"`
-	FileDescUsed  int   `json:"fd_used"`
-	FileDescTotal int   `json:"fd_total"`
-	DiskFree      int64 `json:"disk_free"`
-	Connections   int   `json:"connections"`
-}
-
-// Statistics aggregates queue and node statistics
-type Statistics struct {
-	Queues map[string]QueueStats `json:"queues"`
-	Node   NodeStats             `json:"node"`
-}
-
-// NewRabbitMQ creates a new RabbitMQ connection with Management API access.
-func NewRabbitMQ(urls []string, managementURL, username, password string) (*RabbitMQ, error) {
+// NewRabbitMQ connects the publishing pool with Management API access and declares the topology.
+func NewRabbitMQ(urls []string, managementURL, username, password string, topology Topology, poolConfig PoolConfig) (*RabbitMQ, error) {
 	if len(urls) == 0 {
 		return nil, errors.New("at least one RabbitMQ URL is required")
 	}
 	if managementURL == "" {
 		return nil, errors.New("management URL is required for statistics")
 	}
+	if err := topology.Validate(); err != nil {
+		return nil, err
+	}
 
+	poolConfig = poolConfig.withDefaults()
 	rmq := &RabbitMQ{
 		urls:          urls,
-		reconnectChan: make(chan bool),
+		poolConfig:    poolConfig,
+		pool:          make(chan *pooledChannel, poolConfig.Connections*poolConfig.ChannelsPerConnection),
+		conns:         make([]*amqp.Connection, poolConfig.Connections),
+		done:          make(chan struct{}),
+		topology:      topology,
+		declared:      make(map[string]bool),
 		managementURL: managementURL,
 		username:      username,
 		password:      password,
+		statsCache:    make(map[string]cachedStatistics),
 	}
 
-	if err := rmq.connect(); err != nil {
-		return nil, err
+	conns := make([]*amqp.Connection, poolConfig.Connections)
+	for slot := range conns {
+		conn, err := rmq.connectSlot(slot)
+		if err != nil {
+			rmq.Close()
+			return nil, err
+		}
+		conns[slot] = conn
+	}
+	for slot, conn := range conns {
+		go rmq.maintain(slot, conn)
 	}
-
-	go rmq.reconnectListener()
 
 	return rmq, nil
 }
 
-// connect establishes a connection to the RabbitMQ cluster.
-func (r *RabbitMQ) connect() error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	for _, url := range r.urls {
-		conn, err := amqp.Dial(url)
-		if err == nil {
-			r.conn = conn
-			r.currentURL = url
+// Topology returns the topology the connection was declared with.
+func (r *RabbitMQ) Topology() Topology {
+	return r.topology
+}
 
-			ch, err := conn.Channel()
-			if err != nil {
-				return fmt.Errorf("failed to open channel: %v", err)
-			}
-			r.channel = ch
+// EnsureQueue declares a queue of the topology the first time it is used.
+func (r *RabbitMQ) EnsureQueue(queueName string) error {
+	r.mu.Lock()
+	declared := r.declared[queueName]
+	r.mu.Unlock()
+	if declared {
+		return nil
+	}
 
-			log.Printf("Connected to RabbitMQ at %s", url)
-			return nil
-		}
-		log.Printf("Failed to connect to RabbitMQ at %s: %v", url, err)
+	err := r.withDeclareChannel(func(ch *amqp.Channel) error {
+		return r.topology.DeclareQueue(ch, queueName)
+	})
+	if err != nil {
+		return err
 	}
 
-	return errors.New("failed to connect to any RabbitMQ node")
+	r.mu.Lock()
+	r.declared[queueName] = true
+	r.mu.Unlock()
+	return nil
 }
 
-// reconnectListener listens for connection errors and attempts to reconnect.
-func (r *RabbitMQ) reconnectListener() {
-	for {
-		select {
-		case <-r.reconnectChan:
-			if r.closed {
-				return
-			}
-			log.Println("Attempting to reconnect to RabbitMQ...")
-			if err := r.connect(); err != nil {
-				log.Printf("Reconnect failed: %v", err)
-				time.Sleep(5 * time.Second) // Wait before retrying
-				r.reconnectChan <- true
-			} else {
-				log.Println("Reconnected to RabbitMQ")
-			}
-		}
+// withDeclareChannel runs fn on a short-lived channel, so a failed declaration does not close a publishing channel.
+func (r *RabbitMQ) withDeclareChannel(fn func(ch *amqp.Channel) error) error {
+	ch, err := r.Channel()
+	if err != nil {
+		return err
 	}
+	defer ch.Close()
+	return fn(ch)
 }
 
-// DeclarePriorityQueue declares a priority queue with the given name.
-func (r *RabbitMQ) DeclarePriorityQueue(queueName string) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// PublishWithPriority publishes a message to a priority queue with the given priority
+// and returns once the broker has confirmed it.
+func (r *RabbitMQ) PublishWithPriority(queueName string, message []byte, priority uint8) error {
+	if r == nil {
+		return fmt.Errorf("RabbitMQ instance is nil")
+	}
 
-	if r.channel == nil {
-		return errors.New("RabbitMQ channel is not open")
+	pc, err := r.acquire()
+	if err != nil {
+		return err
 	}
+	confirmation, err := publish(pc.ch, queueName, message, priority)
+	r.release(pc)
 
-	_, err := r.channel.QueueDeclare(
-		queueName,
-		true,
-		false,
-		false,
-		false,
-		amqp.Table{
-			"x-max-priority": 4,
-		},
-	)
 	if err != nil {
-		return fmt.Errorf("failed to declare priority queue: %v", err)
+		log.Printf("Failed to publish message: %v", err)
+		return err
+	}
+
+	if err := waitForConfirm(confirmation); err != nil {
+		log.Printf("Message to queue %s not confirmed: %v", queueName, err)
+		return err
 	}
 
-	log.Printf("Declared priority queue: %s", queueName)
+	log.Printf("Published message to queue %s with priority %d", queueName, priority)
 	return nil
 }
 
-// PublishWithPriority publishes a message to a priority queue with the given priority.
-func (r *RabbitMQ) PublishWithPriority(queueName string, message []byte, priority uint8) error {
+// PublishBatchWithPriority publishes a group of messages to a priority queue on one pooled channel,
+// then waits for the broker to confirm them.
+// It returns the number of leading messages confirmed before the first failure; later messages may still
+// have been queued by the broker.
+func (r *RabbitMQ) PublishBatchWithPriority(queueName string, messages [][]byte, priority uint8) (int, error) {
 	if r == nil {
-		return fmt.Errorf("RabbitMQ instance is nil")
+		return 0, fmt.Errorf("RabbitMQ instance is nil")
 	}
 
-	if r.channel == nil {
-		return errors.New("RabbitMQ channel is not open")
+	pc, err := r.acquire()
+	if err != nil {
+		return 0, err
 	}
+	confirmations := make([]*amqp.DeferredConfirmation, 0, len(messages))
+	var publishErr error
+	for i, message := range messages {
+		confirmation, err := publish(pc.ch, queueName, message, priority)
+		if err != nil {
+			log.Printf("Failed to publish message %d of batch: %v", i, err)
+			publishErr = err
+			break
+		}
+		confirmations = append(confirmations, confirmation)
+	}
+	r.release(pc)
 
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	for i, confirmation := range confirmations {
+		if err := waitForConfirm(confirmation); err != nil {
+			log.Printf("Message %d of batch to queue %s not confirmed: %v", i, queueName, err)
+			return i, err
+		}
+	}
+	if publishErr != nil {
+		return len(confirmations), publishErr
+	}
+
+	log.Printf("Published batch of %d messages to queue %s with priority %d", len(messages), queueName, priority)
+	return len(messages), nil
+}
 
-	err := r.channel.Publish(
+// publish sends a persistent message on a confirm-mode channel.
+func publish(ch *amqp.Channel, queueName string, message []byte, priority uint8) (*amqp.DeferredConfirmation, error) {
+	return ch.PublishWithDeferredConfirm(
 		"",
 		queueName,
 		false,
 		false,
 		amqp.Publishing{
 			ContentType:  "application/json",
+			MessageId:    messageID(message),
 			Body:         message,
 			DeliveryMode: amqp.Persistent,
 			Priority:     priority,
 		},
 	)
-
-	if err != nil {
-		log.Printf("Failed to publish message: %v", err)
-		r.reconnectChan <- true
-		return err
-	}
-
-	log.Printf("Published message to queue %s with priority %d", queueName, priority)
-	return nil
 }
 
-// GetStatistics retrieves key RabbitMQ statistics from the Management API.
-func (r *RabbitMQ) GetStatistics() (Statistics, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	var stats Statistics
-	stats.Queues = make(map[string]QueueStats)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/queues", r.managementURL), nil)
+// PublishConfirmed publishes a message on a confirm-mode channel and returns once the broker has confirmed it,
+// so the caller can ack the delivery the message was republished from.
+func PublishConfirmed(ch *amqp.Channel, exchange, routingKey string, msg amqp.Publishing) error {
+	confirmation, err := ch.PublishWithDeferredConfirm(exchange, routingKey, false, false, msg)
 	if err != nil {
-		return stats, fmt.Errorf("failed to create request: %v", err)
-	}
-	req.SetBasicAuth(r.username, r.password)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return stats, fmt.Errorf("failed to fetch queue stats: %v", err)
+		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return stats, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if confirmation == nil {
+		return errors.New("channel is not in confirm mode")
 	}
+	return waitForConfirm(confirmation)
+}
 
-	var queues []struct {
-		Name            string `json:"name"`
-		Messages        int64  `json:"messages"`
-		MessagesReady   int64  `json:"messages_ready"`
-		MessagesUnacked int64  `json:"messages_unacknowledged"`
-		Consumers       int    `json:"consumers"`
-		MessageStats    struct {
-			PublishDetails struct {
-				Rate float64 `json:"rate"`
-			} `json:"publish_details"`
-			DeliverDetails struct {
-				Rate float64 `json:"rate"`
-			} `json:"deliver_details"`
-			AckDetails struct {
-				Rate float64 `json:"rate"`
-			} `json:"ack_details"`
-		} `json:"message_stats"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&queues); err != nil {
-		return stats, fmt.Errorf("failed to decode queue stats: %v", err)
+// messageID returns the msg_id of a JSON message, set as the AMQP message ID
+func messageID(message []byte) string {
+	var payload struct {
+		MsgID string `json:"msg_id"`
 	}
+	json.Unmarshal(message, &payload)
+	return payload.MsgID
+}
 
-	for _, q := range queues {
-		stats.Queues[q.Name] = QueueStats{
-			Messages:        q.Messages,
-			MessagesReady:   q.MessagesReady,
-			MessagesUnacked: q.MessagesUnacked,
-			PublishRate:     q.MessageStats.PublishDetails.Rate,     // Fixed typo here
-			DeliverRate:     q.MessageStats.DeliverDetails.Rate,     // Fixed typo here
-			AcknowledgeRate: q.MessageStats.AckDetails.Rate,         // Fixed typo here
-			ConsumerCount:   q.Consumers,
-		}
-	}
+// waitForConfirm blocks until the broker acks or nacks a publish, or ConfirmTimeout elapses.
+func waitForConfirm(confirmation *amqp.DeferredConfirmation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ConfirmTimeout)
+	defer cancel()
 
-	req, err = http.NewRequest("GET", fmt.Sprintf("%s/api/nodes", r.managementURL), nil)
+	acked, err := confirmation.WaitContext(ctx)
 	if err != nil {
-		return stats, fmt.Errorf("failed to create node request: %v", err)
+		return fmt.Errorf("%w (delivery tag %d)", ErrConfirmTimeout, confirmation.DeliveryTag)
 	}
-	req.SetBasicAuth(r.username, r.password)
-
-	resp, err = client.Do(req)
-	if err != nil {
-		return stats, fmt.Errorf("failed to fetch node stats: %v", err)
+	if !acked {
+		return fmt.Errorf("%w (delivery tag %d)", ErrNacked, confirmation.DeliveryTag)
 	}
-	defer resp.Body.Close()
+	return nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return stats, fmt.Errorf("unexpected node status code: %d", resp.StatusCode)
-	}
+// Channel opens a dedicated channel on an open pool connection, for consumers and declarations
+// that must not share the publishing channels.
+func (r *RabbitMQ) Channel() (*amqp.Channel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	var nodes []NodeStats
-	if err := json.NewDecoder(resp.Body).Decode(&nodes); err != nil {
-		return stats, fmt.Errorf("failed to decode node stats: %v", err)
-	}
-	if len(nodes) > 0 {
-		stats.Node = nodes[0] // Single node assumption
+	for _, conn := range r.conns {
+		if conn != nil && !conn.IsClosed() {
+			return conn.Channel()
+		}
 	}
-
-	return stats, nil
+	return nil, errors.New("RabbitMQ connection is not open")
 }
 
-// Close closes the RabbitMQ connection.
+// Close closes every pool connection and stops reconnecting.
 func (r *RabbitMQ) Close() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.closed {
+		return
+	}
 	r.closed = true
+	close(r.done)
 
-	if r.channel != nil {
-		r.channel.Close()
-	}
-	if r.conn != nil {
-		r.conn.Close()
+	for _, conn := range r.conns {
+		if conn != nil {
+			conn.Close()
+		}
 	}
 
 	log.Println("RabbitMQ connection closed")
-}
\ No newline at end of file
+}
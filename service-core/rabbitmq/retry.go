@@ -0,0 +1,187 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Headers carried by retried and parked messages.
+const (
+	RetryCountHeader    = "x-retry-count"
+	FailureReasonHeader = "x-failure-reason"
+	OriginalQueueHeader = "x-original-queue"
+	ParkedAtHeader      = "x-parked-at"
+)
+
+// RetryPrefix names the exchange and queue of every retry tier.
+const RetryPrefix = "sms.retry."
+
+// RetryOutcome reports what Retry did with a failed message.
+type RetryOutcome struct {
+	// RetryCount is the number of retries the message has had, including this one when it was retried.
+	RetryCount int
+	// Parked is true when the message ran out of retries and was moved to the dead-letter queue.
+	Parked bool
+	// Delay is how long the message waits before it is delivered again, 0 when parked.
+	Delay time.Duration
+}
+
+// RetryTier returns the name of the retry tier with the given delay.
+// The tier is a fanout exchange and a queue of the same name; the queue has no consumers and dead-letters
+// expired messages to the default exchange with their original routing key, which is the queue they came from.
+func RetryTier(delay int64) string {
+	return fmt.Sprintf("%s%dms", RetryPrefix, delay)
+}
+
+// delayTiers returns the distinct delays of the retry and delay tiers.
+func (t Topology) delayTiers() []int64 {
+	seen := make(map[int64]bool, len(t.RetryTiers)+len(t.DelayTiers))
+	tiers := make([]int64, 0, len(t.RetryTiers)+len(t.DelayTiers))
+	for _, delay := range append(append([]int64{}, t.DelayTiers...), t.RetryTiers...) {
+		if !seen[delay] {
+			seen[delay] = true
+			tiers = append(tiers, delay)
+		}
+	}
+	return tiers
+}
+
+func (t Topology) declareRetryTiers(ch *amqp.Channel) error {
+	for _, delay := range t.delayTiers() {
+		name := RetryTier(delay)
+		if err := ch.ExchangeDeclare(name, amqp.ExchangeFanout, true, false, false, false, nil); err != nil {
+			return mismatchError("exchange", name, amqp.Table{"type": amqp.ExchangeFanout}, err)
+		}
+		args := amqp.Table{
+			"x-queue-type":           amqp.QueueTypeQuorum,
+			"x-message-ttl":          delay,
+			"x-dead-letter-exchange": "",
+		}
+		if _, err := ch.QueueDeclare(name, true, false, false, false, args); err != nil {
+			return mismatchError("queue", name, args, err)
+		}
+		if err := ch.QueueBind(name, "", name, false, nil); err != nil {
+			return fmt.Errorf("failed to bind retry queue %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// RetryCount returns the retry count carried in the message headers.
+func RetryCount(headers amqp.Table) int {
+	switch count := headers[RetryCountHeader].(type) {
+	case int32:
+		return int(count)
+	case int64:
+		return int(count)
+	case int:
+		return count
+	}
+	return 0
+}
+
+// Retry schedules a failed delivery from queue on the next retry tier, or parks it in the dead-letter
+// queue once it has had MaxRetries retries. ch must be in confirm mode; the caller acks the delivery
+// after Retry succeeds.
+func (t Topology) Retry(ch *amqp.Channel, queue string, delivery amqp.Delivery, reason string) (RetryOutcome, error) {
+	spec := t.Queue(queue)
+	outcome := RetryOutcome{RetryCount: RetryCount(delivery.Headers)}
+	if outcome.RetryCount >= spec.MaxRetries || len(t.RetryTiers) == 0 {
+		outcome.Parked = true
+		return outcome, t.Park(ch, queue, delivery, reason)
+	}
+
+	tier := t.retryTier(outcome.RetryCount)
+	outcome.RetryCount++
+	outcome.Delay = time.Duration(tier) * time.Millisecond
+
+	headers := copyHeaders(delivery.Headers)
+	headers[RetryCountHeader] = int32(outcome.RetryCount)
+	headers[FailureReasonHeader] = reason
+	headers[OriginalQueueHeader] = queue
+	return outcome, republish(ch, RetryTier(tier), queue, delivery, headers)
+}
+
+// retryTier returns the delay of the retry tier of a message retried count times before; the last tier
+// is reused once they are exhausted.
+func (t Topology) retryTier(count int) int64 {
+	return t.RetryTiers[min(count, len(t.RetryTiers)-1)]
+}
+
+// Delay republishes a delivery from queue on the shortest delay or retry tier of at least delay, or the
+// longest tier, without counting it as a retry. It is used for messages held back by rate limits rather
+// than failures. It returns the delay applied. The caller acks the delivery after Delay succeeds.
+func (t Topology) Delay(ch *amqp.Channel, queue string, delivery amqp.Delivery, delay time.Duration) (time.Duration, error) {
+	tier, ok := t.delayTier(delay)
+	if !ok {
+		return 0, fmt.Errorf("no retry tiers configured to delay %s", queue)
+	}
+
+	headers := copyHeaders(delivery.Headers)
+	headers[OriginalQueueHeader] = queue
+	return time.Duration(tier) * time.Millisecond, republish(ch, RetryTier(tier), queue, delivery, headers)
+}
+
+// delayTier returns the shortest delay or retry tier of at least delay, or the longest tier.
+// It returns false when no tiers are configured.
+func (t Topology) delayTier(delay time.Duration) (int64, bool) {
+	tiers := t.delayTiers()
+	if len(tiers) == 0 {
+		return 0, false
+	}
+
+	var tier int64
+	for _, candidate := range tiers {
+		if candidate > tier {
+			tier = candidate
+		}
+	}
+	for _, candidate := range tiers {
+		if time.Duration(candidate)*time.Millisecond >= delay && candidate < tier {
+			tier = candidate
+		}
+	}
+	return tier, true
+}
+
+// Park moves a delivery to the dead-letter queue of queue with the failure reason in its headers.
+// Without a dead-letter exchange the message is dropped.
+func (t Topology) Park(ch *amqp.Channel, queue string, delivery amqp.Delivery, reason string) error {
+	spec := t.Queue(queue)
+	if spec.DeadLetterExchange == "" {
+		return nil
+	}
+
+	headers := copyHeaders(delivery.Headers)
+	headers[RetryCountHeader] = int32(RetryCount(delivery.Headers))
+	headers[FailureReasonHeader] = reason
+	headers[OriginalQueueHeader] = queue
+	headers[ParkedAtHeader] = time.Now().UTC().Format(time.RFC3339)
+	return republish(ch, spec.DeadLetterExchange, queue, delivery, headers)
+}
+
+// republish publishes a copy of the delivery on a confirm-mode channel and waits for the broker to confirm it.
+func republish(ch *amqp.Channel, exchange, routingKey string, delivery amqp.Delivery, headers amqp.Table) error {
+	err := PublishConfirmed(ch, exchange, routingKey, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  delivery.ContentType,
+		Body:         delivery.Body,
+		DeliveryMode: amqp.Persistent,
+		Priority:     delivery.Priority,
+		MessageId:    delivery.MessageId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %v", exchange, err)
+	}
+	return nil
+}
+
+func copyHeaders(headers amqp.Table) amqp.Table {
+	copied := make(amqp.Table, len(headers)+4)
+	for key, value := range headers {
+		copied[key] = value
+	}
+	return copied
+}
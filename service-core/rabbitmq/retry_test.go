@@ -0,0 +1,96 @@
+package rabbitmq
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRetryCount(t *testing.T) {
+	tests := []struct {
+		headers amqp.Table
+		want    int
+	}{
+		{nil, 0},
+		{amqp.Table{}, 0},
+		{amqp.Table{RetryCountHeader: int32(2)}, 2},
+		{amqp.Table{RetryCountHeader: int64(3)}, 3},
+		{amqp.Table{RetryCountHeader: 4}, 4},
+		{amqp.Table{RetryCountHeader: "5"}, 0},
+	}
+	for _, tt := range tests {
+		if got := RetryCount(tt.headers); got != tt.want {
+			t.Errorf("RetryCount(%v) = %d, want %d", tt.headers, got, tt.want)
+		}
+	}
+}
+
+func TestRetryTier(t *testing.T) {
+	topology := Topology{RetryTiers: []int64{10000, 60000, 600000}}
+	tests := []struct {
+		count int
+		want  int64
+	}{
+		{0, 10000},
+		{1, 60000},
+		{2, 600000},
+		{3, 600000},
+		{10, 600000},
+	}
+	for _, tt := range tests {
+		if got := topology.retryTier(tt.count); got != tt.want {
+			t.Errorf("retryTier(%d) = %d, want %d", tt.count, got, tt.want)
+		}
+	}
+	if got := RetryTier(10000); got != "sms.retry.10000ms" {
+		t.Errorf("RetryTier(10000) = %q", got)
+	}
+}
+
+func TestDelayTier(t *testing.T) {
+	topology := Topology{RetryTiers: []int64{10000, 60000, 1000}, DelayTiers: []int64{250, 1000}}
+	if got, want := topology.delayTiers(), []int64{250, 1000, 10000, 60000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delayTiers() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		delay time.Duration
+		want  int64
+	}{
+		{0, 250},
+		{100 * time.Millisecond, 250},
+		{250 * time.Millisecond, 250},
+		{300 * time.Millisecond, 1000},
+		{2 * time.Second, 10000},
+		{time.Minute, 60000},
+		{time.Hour, 60000},
+	}
+	for _, tt := range tests {
+		if got, ok := topology.delayTier(tt.delay); !ok || got != tt.want {
+			t.Errorf("delayTier(%s) = %d, %v, want %d", tt.delay, got, ok, tt.want)
+		}
+	}
+	if _, ok := (Topology{}).delayTier(time.Second); ok {
+		t.Error("delayTier() found a tier without tiers configured")
+	}
+}
+
+func TestRetryParksWithoutDeadLetterExchange(t *testing.T) {
+	// Without a dead-letter exchange a parked message is dropped, so no channel is needed
+	topology := Topology{QueueDefaults: QueueSpec{MaxRetries: 2}, RetryTiers: []int64{1000}}
+	delivery := amqp.Delivery{Headers: amqp.Table{RetryCountHeader: int32(2)}}
+	outcome, err := topology.Retry(nil, "general", delivery, "failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (RetryOutcome{RetryCount: 2, Parked: true}); outcome != want {
+		t.Errorf("Retry() = %+v, want %+v", outcome, want)
+	}
+
+	outcome, err = (Topology{}).Retry(nil, "general", amqp.Delivery{}, "failed")
+	if err != nil || !outcome.Parked {
+		t.Errorf("Retry() without retry tiers = %+v, %v, want parked", outcome, err)
+	}
+}
@@ -0,0 +1,200 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// StatsCacheTTL is how long statistics are served from cache before the Management API is queried again.
+const StatsCacheTTL = 5 * time.Second
+
+var statsClient = &http.Client{Timeout: 10 * time.Second}
+
+// QueueStats represents key statistics for a RabbitMQ queue
+type QueueStats struct {
+	Name            string  `json:"name"`
+	VHost           string  `json:"vhost"`
+	Type            string  `json:"type"`
+	State           string  `json:"state"`
+	Messages        int64   `json:"messages"`
+	MessagesReady   int64   `json:"messages_ready"`
+	MessagesUnacked int64   `json:"messages_unacknowledged"`
+	PublishRate     float64 `json:"publish_rate,omitempty"`
+	DeliverRate     float64 `json:"deliver_rate,omitempty"`
+	AcknowledgeRate float64 `json:"acknowledge_rate,omitempty"`
+	ConsumerCount   int     `json:"consumers"`
+	// Leader is the node hosting the queue leader, or the queue's node for classic queues
+	Leader string `json:"leader"`
+	// Members are the nodes holding a replica of a quorum queue, Online those currently reachable
+	Members []string `json:"members,omitempty"`
+	Online  []string `json:"online,omitempty"`
+}
+
+// NodeStats represents key statistics for a RabbitMQ node
+type NodeStats struct {
+	Name          string   `json:"name"`
+	Type          string   `json:"type"`
+	Running       bool     `json:"running"`
+	Uptime        int64    `json:"uptime"`
+	MemoryUsed    int64    `json:"mem_used"`
+	MemoryLimit   int64    `json:"mem_limit"`
+	MemoryAlarm   bool     `json:"mem_alarm"`
+	DiskFree      int64    `json:"disk_free"`
+	DiskFreeLimit int64    `json:"disk_free_limit"`
+	DiskFreeAlarm bool     `json:"disk_free_alarm"`
+	FileDescUsed  int      `json:"fd_used"`
+	FileDescTotal int      `json:"fd_total"`
+	SocketsUsed   int      `json:"sockets_used"`
+	ProcUsed      int      `json:"proc_used"`
+	Partitions    []string `json:"partitions"`
+}
+
+// ClusterStats summarizes the health of the cluster across its nodes
+type ClusterStats struct {
+	Nodes        int      `json:"nodes"`
+	RunningNodes int      `json:"running_nodes"`
+	Alarms       []string `json:"alarms"`
+	Partitioned  bool     `json:"partitioned"`
+}
+
+// Statistics aggregates queue and node statistics
+type Statistics struct {
+	Cluster     ClusterStats `json:"cluster"`
+	Nodes       []NodeStats  `json:"nodes"`
+	Queues      []QueueStats `json:"queues"`
+	VHost       string       `json:"vhost,omitempty"`
+	CollectedAt time.Time    `json:"collected_at"`
+}
+
+type cachedStatistics struct {
+	stats   Statistics
+	expires time.Time
+}
+
+// GetStatistics retrieves cluster-wide statistics from the Management API for every node and the queues
+// of vhost, or of all vhosts when vhost is empty. Results are cached for StatsCacheTTL.
+func (r *RabbitMQ) GetStatistics(vhost string) (Statistics, error) {
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+
+	if cached, ok := r.statsCache[vhost]; ok && time.Now().Before(cached.expires) {
+		return cached.stats, nil
+	}
+
+	stats := Statistics{VHost: vhost, CollectedAt: time.Now().UTC()}
+
+	var nodes []NodeStats
+	if err := r.management("/api/nodes", &nodes); err != nil {
+		return stats, fmt.Errorf("failed to fetch node stats: %v", err)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	stats.Nodes = nodes
+	stats.Cluster = summarize(nodes)
+
+	path := "/api/queues"
+	if vhost != "" {
+		path += "/" + url.PathEscape(vhost)
+	}
+	var queues []struct {
+		Name            string   `json:"name"`
+		VHost           string   `json:"vhost"`
+		Type            string   `json:"type"`
+		State           string   `json:"state"`
+		Node            string   `json:"node"`
+		Leader          string   `json:"leader"`
+		Members         []string `json:"members"`
+		Online          []string `json:"online"`
+		Messages        int64    `json:"messages"`
+		MessagesReady   int64    `json:"messages_ready"`
+		MessagesUnacked int64    `json:"messages_unacknowledged"`
+		Consumers       int      `json:"consumers"`
+		MessageStats    struct {
+			PublishDetails struct {
+				Rate float64 `json:"rate"`
+			} `json:"publish_details"`
+			DeliverDetails struct {
+				Rate float64 `json:"rate"`
+			} `json:"deliver_details"`
+			AckDetails struct {
+				Rate float64 `json:"rate"`
+			} `json:"ack_details"`
+		} `json:"message_stats"`
+	}
+	if err := r.management(path, &queues); err != nil {
+		return stats, fmt.Errorf("failed to fetch queue stats: %v", err)
+	}
+
+	stats.Queues = make([]QueueStats, 0, len(queues))
+	for _, q := range queues {
+		leader := q.Leader
+		if leader == "" {
+			leader = q.Node
+		}
+		stats.Queues = append(stats.Queues, QueueStats{
+			Name:            q.Name,
+			VHost:           q.VHost,
+			Type:            q.Type,
+			State:           q.State,
+			Messages:        q.Messages,
+			MessagesReady:   q.MessagesReady,
+			MessagesUnacked: q.MessagesUnacked,
+			PublishRate:     q.MessageStats.PublishDetails.Rate,
+			DeliverRate:     q.MessageStats.DeliverDetails.Rate,
+			AcknowledgeRate: q.MessageStats.AckDetails.Rate,
+			ConsumerCount:   q.Consumers,
+			Leader:          leader,
+			Members:         q.Members,
+			Online:          q.Online,
+		})
+	}
+
+	r.statsCache[vhost] = cachedStatistics{stats: stats, expires: time.Now().Add(StatsCacheTTL)}
+	return stats, nil
+}
+
+// management decodes the JSON response of a Management API GET request into v.
+func (r *RabbitMQ) management(path string, v interface{}) error {
+	req, err := http.NewRequest("GET", r.managementURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.SetBasicAuth(r.username, r.password)
+
+	resp, err := statsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// summarize reports running nodes, active resource alarms and network partitions of the cluster.
+func summarize(nodes []NodeStats) ClusterStats {
+	cluster := ClusterStats{Nodes: len(nodes), Alarms: []string{}}
+	for _, node := range nodes {
+		if node.Running {
+			cluster.RunningNodes++
+		}
+		if node.MemoryAlarm {
+			cluster.Alarms = append(cluster.Alarms, node.Name+": memory")
+		}
+		if node.DiskFreeAlarm {
+			cluster.Alarms = append(cluster.Alarms, node.Name+": disk")
+		}
+		if len(node.Partitions) > 0 {
+			cluster.Partitioned = true
+		}
+	}
+	return cluster
+}
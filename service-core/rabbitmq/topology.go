@@ -0,0 +1,305 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeadLetterSuffix is appended to a queue name to form the name of its dead-letter queue.
+const DeadLetterSuffix = ".dlq"
+
+// unlimitedDeliveries is the x-delivery-limit of dead-letter queues. Browsing a dead-letter queue returns
+// every message it reads unacked, which counts as a delivery, and quorum queues otherwise drop a message
+// after 20 deliveries. RabbitMQ accepts it from MinBrokerVersion.
+const unlimitedDeliveries int64 = -1
+
+// MinBrokerVersion is the major version of the oldest RabbitMQ the topology can be declared on
+const MinBrokerVersion = 4
+
+// ExchangeSpec describes an exchange of the topology.
+type ExchangeSpec struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// QueueSpec describes a quorum queue of the topology.
+type QueueSpec struct {
+	Name string `json:"name"`
+	// DeliveryLimit is how many times a message is redelivered before it is dead-lettered, 0 for unlimited.
+	DeliveryLimit int64 `json:"delivery_limit"`
+	// MessageTTL is how long a message may wait in the queue in milliseconds, 0 for no expiry.
+	MessageTTL int64 `json:"message_ttl_ms"`
+	// MaxLength caps the number of ready messages, 0 for no limit.
+	MaxLength int64 `json:"max_length"`
+	// DeadLetterExchange receives rejected, expired and over-delivered messages, routed by queue name.
+	DeadLetterExchange string `json:"dead_letter_exchange"`
+	// DeadLetterQueue declares <name>.dlq bound to DeadLetterExchange to hold them.
+	DeadLetterQueue bool `json:"dead_letter_queue"`
+	// MaxRetries is how many delayed retries a failed message gets before it is parked in the dead-letter queue.
+	MaxRetries int `json:"max_retries"`
+}
+
+// Topology is the declarative RabbitMQ layout shared by the gateway and the consumers.
+// Queues that are not listed, such as those of message types added at runtime, use QueueDefaults.
+// Listed queues inherit the fields they do not set from QueueDefaults; a field set to 0 overrides it.
+type Topology struct {
+	Exchanges     []ExchangeSpec `json:"exchanges"`
+	QueueDefaults QueueSpec      `json:"queue_defaults"`
+	Queues        []QueueSpec    `json:"queues"`
+	// RetryTiers are the delays in milliseconds of the retry queues, the last tier is reused for later retries.
+	RetryTiers []int64 `json:"retry_tiers_ms"`
+	// DelayTiers are additional short delays in milliseconds for messages held back by rate limits and
+	// circuit breakers, so they are not postponed by a whole retry tier.
+	DelayTiers []int64 `json:"delay_tiers_ms"`
+}
+
+// DefaultTopology returns the topology used when no topology file is configured.
+func DefaultTopology() Topology {
+	defaults := QueueSpec{
+		DeliveryLimit:      5,
+		DeadLetterExchange: "sms.dlx",
+		DeadLetterQueue:    true,
+		MaxRetries:         3,
+	}
+	otp, transactional, promotional, general := defaults, defaults, defaults, defaults
+	otp.Name, otp.MessageTTL, otp.MaxRetries = "otp", 5*60*1000, 2
+	transactional.Name, transactional.MaxRetries = "transactional", 5
+	promotional.Name, promotional.MessageTTL = "promotional", 24*60*60*1000
+	general.Name = "general"
+
+	return Topology{
+		Exchanges: []ExchangeSpec{
+			{Name: "sms.dlx", Kind: amqp.ExchangeDirect},
+		},
+		QueueDefaults: defaults,
+		Queues:        []QueueSpec{otp, transactional, promotional, general},
+		RetryTiers:    []int64{10 * 1000, 60 * 1000, 10 * 60 * 1000},
+		DelayTiers:    []int64{250, 1000},
+	}
+}
+
+// UnmarshalJSON decodes a topology, reading every listed queue over a copy of queue_defaults
+func (t *Topology) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Exchanges     []ExchangeSpec    `json:"exchanges"`
+		QueueDefaults QueueSpec         `json:"queue_defaults"`
+		Queues        []json.RawMessage `json:"queues"`
+		RetryTiers    []int64           `json:"retry_tiers_ms"`
+		DelayTiers    []int64           `json:"delay_tiers_ms"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	queues := make([]QueueSpec, 0, len(raw.Queues))
+	for _, data := range raw.Queues {
+		spec := raw.QueueDefaults
+		spec.Name = ""
+		if err := json.Unmarshal(data, &spec); err != nil {
+			return err
+		}
+		queues = append(queues, spec)
+	}
+	*t = Topology{
+		Exchanges:     raw.Exchanges,
+		QueueDefaults: raw.QueueDefaults,
+		Queues:        queues,
+		RetryTiers:    raw.RetryTiers,
+		DelayTiers:    raw.DelayTiers,
+	}
+	return nil
+}
+
+// LoadTopology reads a JSON topology file, or returns DefaultTopology when path is empty.
+// The topology is validated before it is returned.
+func LoadTopology(path string) (Topology, error) {
+	topology := DefaultTopology()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Topology{}, fmt.Errorf("failed to read topology file: %v", err)
+		}
+		topology = Topology{}
+		if err := json.Unmarshal(data, &topology); err != nil {
+			return Topology{}, fmt.Errorf("failed to parse topology file %s: %v", path, err)
+		}
+	}
+
+	if err := topology.Validate(); err != nil {
+		return Topology{}, err
+	}
+	return topology, nil
+}
+
+// Validate checks the topology for missing names, duplicates and references to undeclared exchanges.
+func (t Topology) Validate() error {
+	exchanges := make(map[string]bool)
+	for _, exchange := range t.Exchanges {
+		if exchange.Name == "" {
+			return errors.New("topology: exchange name is required")
+		}
+		if exchanges[exchange.Name] {
+			return fmt.Errorf("topology: exchange %s is declared twice", exchange.Name)
+		}
+		switch exchange.Kind {
+		case amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic, amqp.ExchangeHeaders:
+		default:
+			return fmt.Errorf("topology: exchange %s has unsupported kind %q", exchange.Name, exchange.Kind)
+		}
+		exchanges[exchange.Name] = true
+	}
+
+	if err := validateQueue("queue_defaults", t.QueueDefaults, exchanges); err != nil {
+		return err
+	}
+	if t.QueueDefaults.MaxRetries > 0 && len(t.RetryTiers) == 0 {
+		return errors.New("topology: queue_defaults has retries but no retry tiers are configured")
+	}
+
+	for _, tier := range t.RetryTiers {
+		if tier <= 0 {
+			return errors.New("topology: retry tiers must be positive")
+		}
+	}
+	for _, tier := range t.DelayTiers {
+		if tier <= 0 {
+			return errors.New("topology: delay tiers must be positive")
+		}
+	}
+
+	queues := make(map[string]bool)
+	for _, queue := range t.Queues {
+		if queue.Name == "" {
+			return errors.New("topology: queue name is required")
+		}
+		if queues[queue.Name] {
+			return fmt.Errorf("topology: queue %s is declared twice", queue.Name)
+		}
+		spec := t.Queue(queue.Name)
+		if err := validateQueue("queue "+queue.Name, spec, exchanges); err != nil {
+			return err
+		}
+		if spec.MaxRetries > 0 && len(t.RetryTiers) == 0 {
+			return fmt.Errorf("topology: queue %s has retries but no retry tiers are configured", queue.Name)
+		}
+		queues[queue.Name] = true
+	}
+	return nil
+}
+
+func validateQueue(label string, queue QueueSpec, exchanges map[string]bool) error {
+	if queue.DeliveryLimit < 0 || queue.MessageTTL < 0 || queue.MaxLength < 0 || queue.MaxRetries < 0 {
+		return fmt.Errorf("topology: %s has a negative limit", label)
+	}
+	if queue.DeadLetterExchange != "" && !exchanges[queue.DeadLetterExchange] {
+		return fmt.Errorf("topology: %s dead-letters to undeclared exchange %s", label, queue.DeadLetterExchange)
+	}
+	if queue.DeadLetterQueue && queue.DeadLetterExchange == "" {
+		return fmt.Errorf("topology: %s has a dead-letter queue but no dead-letter exchange", label)
+	}
+	return nil
+}
+
+// Queue returns the spec of a queue, falling back to QueueDefaults for unlisted queues.
+func (t Topology) Queue(name string) QueueSpec {
+	spec := t.QueueDefaults
+	for _, queue := range t.Queues {
+		if queue.Name == name {
+			spec = queue
+			break
+		}
+	}
+	spec.Name = name
+	return spec
+}
+
+// Args returns the quorum queue arguments for the spec.
+func (q QueueSpec) Args() amqp.Table {
+	args := amqp.Table{
+		"x-queue-type": amqp.QueueTypeQuorum,
+	}
+	if q.DeliveryLimit > 0 {
+		args["x-delivery-limit"] = q.DeliveryLimit
+	}
+	if q.MessageTTL > 0 {
+		args["x-message-ttl"] = q.MessageTTL
+	}
+	if q.MaxLength > 0 {
+		args["x-max-length"] = q.MaxLength
+	}
+	if q.DeadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = q.DeadLetterExchange
+		args["x-dead-letter-routing-key"] = q.Name
+	}
+	return args
+}
+
+// CheckBrokerVersion fails when conn is connected to a RabbitMQ older than MinBrokerVersion
+func CheckBrokerVersion(conn *amqp.Connection) error {
+	version, _ := conn.Properties["version"].(string)
+	major, _, _ := strings.Cut(version, ".")
+	if n, err := strconv.Atoi(major); err != nil || n < MinBrokerVersion {
+		return fmt.Errorf("RabbitMQ %q is not supported, %d.0 or later is required", version, MinBrokerVersion)
+	}
+	return nil
+}
+
+// Declare reconciles every exchange, retry tier and listed queue of the topology with the broker.
+// A queue that already exists with different arguments closes ch, so use a dedicated channel.
+func (t Topology) Declare(ch *amqp.Channel) error {
+	for _, exchange := range t.Exchanges {
+		if err := ch.ExchangeDeclare(exchange.Name, exchange.Kind, true, false, false, false, nil); err != nil {
+			return mismatchError("exchange", exchange.Name, amqp.Table{"type": exchange.Kind}, err)
+		}
+	}
+	if err := t.declareRetryTiers(ch); err != nil {
+		return err
+	}
+	for _, queue := range t.Queues {
+		if err := t.DeclareQueue(ch, queue.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeclareQueue declares one queue of the topology and its dead-letter queue.
+func (t Topology) DeclareQueue(ch *amqp.Channel, name string) error {
+	spec := t.Queue(name)
+	args := spec.Args()
+	if _, err := ch.QueueDeclare(name, true, false, false, false, args); err != nil {
+		return mismatchError("queue", name, args, err)
+	}
+
+	if spec.DeadLetterQueue {
+		dlq := name + DeadLetterSuffix
+		dlqArgs := amqp.Table{"x-queue-type": amqp.QueueTypeQuorum, "x-delivery-limit": unlimitedDeliveries}
+		if _, err := ch.QueueDeclare(dlq, true, false, false, false, dlqArgs); err != nil {
+			return mismatchError("queue", dlq, dlqArgs, err)
+		}
+		if err := ch.QueueBind(dlq, name, spec.DeadLetterExchange, false, nil); err != nil {
+			return fmt.Errorf("failed to bind %s to %s: %v", dlq, spec.DeadLetterExchange, err)
+		}
+	}
+
+	log.Printf("Declared quorum queue: %s", name)
+	return nil
+}
+
+// mismatchError explains a PRECONDITION_FAILED declaration, which means the broker already has the
+// object with different settings. It has to be deleted or migrated before the topology can apply.
+func mismatchError(kind, name string, expected amqp.Table, err error) error {
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		return fmt.Errorf("%s %s exists on the broker with settings that differ from the topology (expected %v); delete or migrate it: %s",
+			kind, name, expected, amqpErr.Reason)
+	}
+	return fmt.Errorf("failed to declare %s %s: %v", kind, name, err)
+}
@@ -0,0 +1,171 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestDefaultTopology(t *testing.T) {
+	topology := DefaultTopology()
+	if err := topology.Validate(); err != nil {
+		t.Fatalf("DefaultTopology() is invalid: %v", err)
+	}
+	for _, queue := range []string{"otp", "transactional", "promotional", "general"} {
+		if spec := topology.Queue(queue); !spec.DeadLetterQueue || spec.MaxRetries == 0 {
+			t.Errorf("Queue(%q) = %+v, want a dead-letter queue and retries", queue, spec)
+		}
+	}
+
+	// The listed queues are copies, so changing one leaves the defaults alone
+	topology.Queues[0].MaxRetries = 9
+	if topology.QueueDefaults.MaxRetries == 9 || DefaultTopology().Queue("otp").MaxRetries == 9 {
+		t.Error("queue specs share state with the defaults")
+	}
+}
+
+func TestTopologyValidate(t *testing.T) {
+	dlx := []ExchangeSpec{{Name: "sms.dlx", Kind: amqp.ExchangeDirect}}
+	tests := []struct {
+		name     string
+		topology Topology
+		wantErr  bool
+	}{
+		{"empty", Topology{}, false},
+		{"valid", Topology{
+			Exchanges:     dlx,
+			QueueDefaults: QueueSpec{DeadLetterExchange: "sms.dlx", DeadLetterQueue: true, MaxRetries: 2},
+			Queues:        []QueueSpec{{Name: "otp", DeadLetterExchange: "sms.dlx"}},
+			RetryTiers:    []int64{1000},
+		}, false},
+		{"unnamed exchange", Topology{Exchanges: []ExchangeSpec{{Kind: amqp.ExchangeDirect}}}, true},
+		{"duplicate exchange", Topology{Exchanges: append(dlx, dlx...)}, true},
+		{"unsupported exchange kind", Topology{Exchanges: []ExchangeSpec{{Name: "sms.dlx", Kind: "x-delayed-message"}}}, true},
+		{"undeclared dead-letter exchange", Topology{QueueDefaults: QueueSpec{DeadLetterExchange: "sms.dlx"}}, true},
+		{"dead-letter queue without exchange", Topology{Queues: []QueueSpec{{Name: "otp", DeadLetterQueue: true}}}, true},
+		{"negative limit", Topology{Queues: []QueueSpec{{Name: "otp", MessageTTL: -1}}}, true},
+		{"retries without tiers", Topology{Queues: []QueueSpec{{Name: "otp", MaxRetries: 1}}}, true},
+		{"default retries without tiers", Topology{QueueDefaults: QueueSpec{MaxRetries: 1}}, true},
+		{"non-positive retry tier", Topology{RetryTiers: []int64{0}}, true},
+		{"non-positive delay tier", Topology{DelayTiers: []int64{-250}}, true},
+		{"unnamed queue", Topology{Queues: []QueueSpec{{}}}, true},
+		{"duplicate queue", Topology{Queues: []QueueSpec{{Name: "otp"}, {Name: "otp"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.topology.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQueueArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		spec QueueSpec
+		want amqp.Table
+	}{
+		{"no limits", QueueSpec{Name: "general"}, amqp.Table{"x-queue-type": amqp.QueueTypeQuorum}},
+		{"every limit", QueueSpec{Name: "otp", DeliveryLimit: 5, MessageTTL: 300000, MaxLength: 1000, DeadLetterExchange: "sms.dlx"}, amqp.Table{
+			"x-queue-type":              amqp.QueueTypeQuorum,
+			"x-delivery-limit":          int64(5),
+			"x-message-ttl":             int64(300000),
+			"x-max-length":              int64(1000),
+			"x-dead-letter-exchange":    "sms.dlx",
+			"x-dead-letter-routing-key": "otp",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.spec.Args(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Args() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTopology(t *testing.T) {
+	topology, err := LoadTopology("")
+	if err != nil || !reflect.DeepEqual(topology, DefaultTopology()) {
+		t.Errorf("LoadTopology(\"\") = %+v, %v, want the default topology", topology, err)
+	}
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "topology.json")
+	os.WriteFile(valid, []byte(`{"queues": [{"name": "otp", "message_ttl_ms": 60000}]}`), 0o600)
+	topology, err = LoadTopology(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := topology.Queue("otp"); got.MessageTTL != 60000 {
+		t.Errorf("Queue(otp).MessageTTL = %d, want 60000", got.MessageTTL)
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	os.WriteFile(invalid, []byte(`{"queues": [{"name": "otp", "dead_letter_exchange": "missing"}]}`), 0o600)
+	for _, path := range []string{filepath.Join(dir, "missing.json"), invalid} {
+		if _, err := LoadTopology(path); err == nil {
+			t.Errorf("LoadTopology(%s) succeeded", filepath.Base(path))
+		}
+	}
+}
+
+func TestTopologyQueueOverrides(t *testing.T) {
+	var topology Topology
+	err := json.Unmarshal([]byte(`{
+		"exchanges": [{"name": "sms.dlx", "kind": "direct"}],
+		"queue_defaults": {"delivery_limit": 5, "message_ttl_ms": 1000, "dead_letter_exchange": "sms.dlx", "dead_letter_queue": true, "max_retries": 3},
+		"queues": [
+			{"name": "inherits"},
+			{"name": "zeroes", "delivery_limit": 0, "message_ttl_ms": 0, "max_retries": 0, "dead_letter_queue": false},
+			{"name": "overrides", "max_retries": 7}
+		],
+		"retry_tiers_ms": [1000]
+	}`), &topology)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := topology.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		queue string
+		want  QueueSpec
+	}{
+		{"inherits", QueueSpec{Name: "inherits", DeliveryLimit: 5, MessageTTL: 1000, DeadLetterExchange: "sms.dlx", DeadLetterQueue: true, MaxRetries: 3}},
+		{"zeroes", QueueSpec{Name: "zeroes", DeadLetterExchange: "sms.dlx"}},
+		{"overrides", QueueSpec{Name: "overrides", DeliveryLimit: 5, MessageTTL: 1000, DeadLetterExchange: "sms.dlx", DeadLetterQueue: true, MaxRetries: 7}},
+		{"unlisted", QueueSpec{Name: "unlisted", DeliveryLimit: 5, MessageTTL: 1000, DeadLetterExchange: "sms.dlx", DeadLetterQueue: true, MaxRetries: 3}},
+	}
+	for _, tt := range tests {
+		if got := topology.Queue(tt.queue); got != tt.want {
+			t.Errorf("Queue(%q) = %+v, want %+v", tt.queue, got, tt.want)
+		}
+	}
+}
+
+func TestCheckBrokerVersion(t *testing.T) {
+	tests := []struct {
+		version any
+		wantErr bool
+	}{
+		{"4.0.5", false},
+		{"4.1.0", false},
+		{"10.0.0", false},
+		{"3.13.7", true},
+		{"", true},
+		{nil, true},
+	}
+	for _, tt := range tests {
+		conn := &amqp.Connection{Properties: amqp.Table{"version": tt.version}}
+		if err := CheckBrokerVersion(conn); (err != nil) != tt.wantErr {
+			t.Errorf("CheckBrokerVersion(%v) error = %v, wantErr %v", tt.version, err, tt.wantErr)
+		}
+	}
+}
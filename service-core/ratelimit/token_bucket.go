@@ -0,0 +1,127 @@
+// Package ratelimit provides a token bucket shared by every consumer instance through Redis.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills the bucket for the time elapsed since the last call and takes cost tokens when at
+// least one is available. Multi-part messages may take the bucket below zero, which delays later callers
+// until the debt is paid. The Redis clock is used so every instance agrees on the elapsed time.
+// It returns 0 when the tokens were taken, otherwise the milliseconds until the next token.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - cost
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1000)
+return wait
+`)
+
+// TokenBucket limits the aggregate rate of a resource, such as an MNO channel, across all instances.
+type TokenBucket struct {
+	client *redis.Client
+}
+
+// NewTokenBucket creates a limiter storing its buckets in Redis
+func NewTokenBucket(client *redis.Client) *TokenBucket {
+	return &TokenBucket{client: client}
+}
+
+// ChannelKey returns the bucket key of an MNO channel
+func ChannelKey(channelID uint) string {
+	return fmt.Sprintf("tps:channel:%d", channelID)
+}
+
+// TypeKey returns the bucket key of the TPS share a message type is allocated on an MNO channel
+func TypeKey(channelID uint, msgType string) string {
+	return fmt.Sprintf("tps:channel:%d:%s", channelID, msgType)
+}
+
+// Bucket is a token bucket key and its refill rate in tokens per second
+type Bucket struct {
+	Key string
+	TPS float64
+}
+
+// Take takes cost tokens from a bucket that refills at tps tokens per second and holds at most one
+// second of tokens, or one token when tps is below one. It returns 0 when the tokens were taken,
+// otherwise how long until the next token.
+func (b *TokenBucket) Take(ctx context.Context, key string, tps float64, cost int) (time.Duration, error) {
+	if tps <= 0 {
+		return 0, errors.New("tps must be positive")
+	}
+	if cost < 1 {
+		cost = 1
+	}
+	wait, err := takeScript.Run(ctx, b.client, []string{key}, tps, math.Max(tps, 1), cost).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("token bucket %s: %v", key, err)
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+// Wait takes cost tokens, waiting for them up to maxWait. It returns 0 once the tokens were taken,
+// otherwise how long until the next token when that is beyond maxWait.
+func (b *TokenBucket) Wait(ctx context.Context, key string, tps float64, cost int, maxWait time.Duration) (time.Duration, error) {
+	return b.WaitAny(ctx, []Bucket{{Key: key, TPS: tps}}, cost, maxWait)
+}
+
+// WaitAny takes cost tokens from the first bucket that has a token, trying them in order, and waits
+// up to maxWait for the first bucket to refill. The other buckets lend capacity their own users left
+// unused, so a caller is never delayed by borrowing. It returns 0 once the tokens were taken,
+// otherwise how long until the first bucket has a token when that is beyond maxWait.
+func (b *TokenBucket) WaitAny(ctx context.Context, buckets []Bucket, cost int, maxWait time.Duration) (time.Duration, error) {
+	if len(buckets) == 0 {
+		return 0, errors.New("no token bucket")
+	}
+	deadline := time.Now().Add(maxWait)
+	for {
+		var wait time.Duration
+		for i, bucket := range buckets {
+			next, err := b.Take(ctx, bucket.Key, bucket.TPS, cost)
+			if err != nil || next == 0 {
+				return 0, err
+			}
+			if i == 0 {
+				wait = next
+			}
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return wait, nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return wait, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// testBucket returns a limiter on the Redis server in REDIS_URL, skipping the test when none is reachable
+func testBucket(t *testing.T) (*TokenBucket, *redis.Client) {
+	t.Helper()
+	addr := os.Getenv("REDIS_URL")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr, DB: 15})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		t.Skipf("Redis is not reachable at %s: %v", addr, err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return NewTokenBucket(client), client
+}
+
+func testKey(t *testing.T, client *redis.Client) string {
+	key := "tps:test:" + t.Name()
+	client.Del(context.Background(), key)
+	t.Cleanup(func() { client.Del(context.Background(), key) })
+	return key
+}
+
+func TestKeys(t *testing.T) {
+	tests := []struct {
+		got  string
+		want string
+	}{
+		{ChannelKey(7), "tps:channel:7"},
+		{TypeKey(7, "otp"), "tps:channel:7:otp"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("key = %q, want %q", tt.got, tt.want)
+		}
+	}
+}
+
+func TestTakeInvalidRate(t *testing.T) {
+	bucket := NewTokenBucket(nil)
+	for _, tps := range []float64{0, -1} {
+		if _, err := bucket.Take(context.Background(), "tps:test", tps, 1); err == nil {
+			t.Errorf("Take() accepted tps %v", tps)
+		}
+	}
+	if _, err := bucket.WaitAny(context.Background(), nil, 1, 0); err == nil {
+		t.Error("WaitAny() accepted no buckets")
+	}
+}
+
+func TestTake(t *testing.T) {
+	tests := []struct {
+		name string
+		tps  float64
+		// costs are taken one after another; taken is how many of them get their tokens
+		costs []int
+		taken int
+	}{
+		{"burst of one second", 10, []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, 10},
+		{"below one tps holds one token", 0.5, []int{1, 1}, 1},
+		{"multi-part debt delays the next caller", 10, []int{1, 15, 1}, 2},
+		{"zero cost takes one", 2, []int{0, 0, 0}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, client := testBucket(t)
+			key := testKey(t, client)
+
+			taken := 0
+			for _, cost := range tt.costs {
+				wait, err := bucket.Take(context.Background(), key, tt.tps, cost)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if wait == 0 {
+					taken++
+				} else if wait > time.Duration(float64(time.Second)*float64(1+cost)/tt.tps)+time.Second {
+					t.Errorf("Take() wait %v is too long", wait)
+				}
+			}
+			if taken != tt.taken {
+				t.Errorf("%d takes succeeded, want %d", taken, tt.taken)
+			}
+		})
+	}
+}
+
+func TestWaitAny(t *testing.T) {
+	bucket, client := testBucket(t)
+	own := testKey(t, client)
+	lender := own + ":lender"
+	client.Del(context.Background(), lender)
+	t.Cleanup(func() { client.Del(context.Background(), lender) })
+	buckets := []Bucket{{Key: own, TPS: 1}, {Key: lender, TPS: 1}}
+
+	// The own bucket, then the lender's, then neither has a token
+	for i, want := range []bool{true, true, false} {
+		wait, err := bucket.WaitAny(context.Background(), buckets, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (wait == 0) != want {
+			t.Errorf("take %d: wait = %v, want taken %v", i, wait, want)
+		}
+	}
+
+	// Waiting long enough for the own bucket to refill takes from it
+	wait, err := bucket.WaitAny(context.Background(), buckets, 1, 2*time.Second)
+	if err != nil || wait != 0 {
+		t.Errorf("WaitAny() = %v, %v, want the tokens after waiting", wait, err)
+	}
+}
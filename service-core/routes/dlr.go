@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"myproject/controllers"
+	"myproject/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupDLRRoutes sets up the delivery receipt webhook routes, scoped to the calling application
+func SetupDLRRoutes(r *gin.RouterGroup) {
+	dlrRoutes := r.Group("/dlr")
+	dlrRoutes.Use(middleware.JWTAuth()) // Ensure authentication middleware is applied
+	{
+		dlrRoutes.GET("/webhook", controllers.GetDLRWebhook)
+		dlrRoutes.PUT("/webhook", controllers.SaveDLRWebhook)
+		dlrRoutes.DELETE("/webhook", controllers.DeleteDLRWebhook)
+		dlrRoutes.GET("/attempts", controllers.GetDLRAttempts)
+	}
+}
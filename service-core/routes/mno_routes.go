@@ -19,4 +19,14 @@ func SetupMNORoutes(r *gin.RouterGroup) {
 		Routes.DELETE("/:id", middleware.RBAC("delete_mno"), controllers.DeleteMNO)
 		Routes.GET("/:id", middleware.RBAC("get_mno_details"), controllers.GetMNODetails)
 	}
+
+	channelRoutes := r.Group("/mno-channels")
+	channelRoutes.Use(middleware.JWTAuth()) // Ensure authentication middleware is applied
+	{
+		channelRoutes.GET("/breakers", middleware.RBAC("view_mno"), controllers.GetChannelBreakers)
+		channelRoutes.GET("/breakers/events", middleware.RBAC("view_mno"), controllers.GetChannelBreakerEvents)
+		channelRoutes.POST("/", middleware.RBAC("create_mno"), controllers.CreateMNOChannel)
+		channelRoutes.PUT("/:id", middleware.RBAC("edit_mno"), controllers.UpdateMNOChannel)
+		channelRoutes.DELETE("/:id", middleware.RBAC("delete_mno"), controllers.DeleteMNOChannel)
+	}
 }
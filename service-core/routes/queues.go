@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"myproject/controllers"
+	"myproject/middleware"
+	"myproject/rabbitmq"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupQueueRoutes sets up the queue operation routes
+func SetupQueueRoutes(r *gin.RouterGroup, rmq *rabbitmq.RabbitMQ) {
+	dlqController := controllers.NewDLQController(rmq)
+
+	queueRoutes := r.Group("/queues")
+	queueRoutes.Use(middleware.JWTAuth()) // Ensure authentication middleware is applied
+	{
+		// Apply RBAC middleware to each route with the required permission
+		queueRoutes.GET("/dlq", middleware.RBAC("view_dlq"), dlqController.GetDLQs)
+		queueRoutes.GET("/dlq/:queue", middleware.RBAC("view_dlq"), dlqController.GetDLQMessages)
+		queueRoutes.POST("/dlq/:queue/replay", middleware.RBAC("replay_dlq"), dlqController.ReplayDLQMessages)
+		queueRoutes.POST("/dlq/:queue/purge", middleware.RBAC("purge_dlq"), dlqController.PurgeDLQMessages)
+	}
+}
@@ -8,13 +8,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/redis/go-redis/v9"
 )
 
 // SetupSMSGatewayRoutes sets up the SMS Gateway routes
-func SetupSMSGatewayRoutes(r *gin.RouterGroup, influxClient influxdb2.Client, cfg *config.Config, rmq *rabbitmq.RabbitMQ) {
+func SetupSMSGatewayRoutes(r *gin.RouterGroup, influxClient influxdb2.Client, cfg *config.Config, rmq *rabbitmq.RabbitMQ, redisClient *redis.Client) {
 	// Initialize the SMS Gateway Controller
 	// smsController := controllers.NewSMSGatewayController(influxClient, cfg)
-	smsController := controllers.NewSMSGatewayController(influxClient, cfg, rmq)
+	smsController := controllers.NewSMSGatewayController(influxClient, cfg, rmq, redisClient)
 
 	smsRoutes := r.Group("/sms")
 	smsRoutes.Use(middleware.JWTAuth()) // Ensure authentication middleware is applied
@@ -22,7 +23,10 @@ func SetupSMSGatewayRoutes(r *gin.RouterGroup, influxClient influxdb2.Client, cf
 		// Apply RBAC middleware to each route with the required permission
 		// smsRoutes.POST("/send", middleware.RBAC("send_sms"), smsController.ProcessSMS)
 		smsRoutes.POST("/send", smsController.ProcessSMS)
+		smsRoutes.POST("/send-batch", smsController.ProcessSMSBatch)
 		smsRoutes.GET("/test-million-msg", smsController.PublishMillionMessages)
 		smsRoutes.GET("/rabbitmq-stats", smsController.GetRabbitMQStatistics)
+		smsRoutes.GET("", smsController.GetSMSByMSISDN)
+		smsRoutes.GET("/:msg_id", smsController.GetSMSStatus)
 	}
 }
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"myproject/controllers"
+	"myproject/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupTPSAllocationRoutes sets up the routes splitting MNO channel TPS across SMS types
+func SetupTPSAllocationRoutes(r *gin.RouterGroup) {
+	tpsAllocationRoutes := r.Group("/tps_allocation")
+	tpsAllocationRoutes.Use(middleware.JWTAuth()) // Ensure authentication middleware is applied
+	{
+		// Apply RBAC middleware to each route with the required permission
+		tpsAllocationRoutes.GET("/", middleware.RBAC("view_tps_allocation"), controllers.GetTPSAllocations)
+		tpsAllocationRoutes.POST("/", middleware.RBAC("create_tps_allocation"), controllers.CreateTPSAllocation)
+		tpsAllocationRoutes.PUT("/:id", middleware.RBAC("edit_tps_allocation"), controllers.UpdateTPSAllocation)
+		tpsAllocationRoutes.DELETE("/:id", middleware.RBAC("delete_tps_allocation"), controllers.DeleteTPSAllocation)
+		tpsAllocationRoutes.GET("/:id", middleware.RBAC("view_tps_allocation"), controllers.GetTPSAllocationDetails)
+	}
+}
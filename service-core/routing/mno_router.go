@@ -0,0 +1,204 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"myproject/mnochannel"
+	"myproject/models"
+	"myproject/utils"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Route is the delivery destination resolved for an MSISDN prefix
+type Route struct {
+	Prefix   string               `json:"prefix"`
+	MNOID    uuid.UUID            `json:"mno_id"`
+	MNOName  string               `json:"mno_name"`
+	Channels []models.MnoChannels `json:"channels"`
+}
+
+// mnoTable is an in-memory prefix table built from the MNO configuration
+type mnoTable struct {
+	mu     sync.RWMutex
+	routes map[string]Route
+	maxLen int
+}
+
+var mnoRoutes = &mnoTable{routes: make(map[string]Route)}
+
+// LoadMNORoutes rebuilds the routing table from active MNOs and their active channels
+func LoadMNORoutes(db *gorm.DB) error {
+	if db == nil {
+		return errors.New("database connection is not initialized")
+	}
+
+	var mnos []models.MNO
+	err := db.Preload("Channels", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("LOWER(status) = ?", "active").Order("priority ASC")
+	}).Preload("Channels.TPSAllocations").Where("LOWER(status) = ?", "active").Find(&mnos).Error
+	if err != nil {
+		return err
+	}
+
+	routes := make(map[string]Route)
+	maxLen := 0
+	for _, mno := range mnos {
+		for _, prefix := range splitPrefixes(mno.Prefix) {
+			if existing, ok := routes[prefix]; ok {
+				log.Printf("MNO routing: prefix %s already assigned to %s, ignoring it for %s", prefix, existing.MNOName, mno.MNO_Name)
+				continue
+			}
+			routes[prefix] = Route{
+				Prefix:   prefix,
+				MNOID:    mno.ID,
+				MNOName:  mno.MNO_Name,
+				Channels: mno.Channels,
+			}
+			if len(prefix) > maxLen {
+				maxLen = len(prefix)
+			}
+		}
+	}
+
+	mnoRoutes.mu.Lock()
+	mnoRoutes.routes = routes
+	mnoRoutes.maxLen = maxLen
+	mnoRoutes.mu.Unlock()
+
+	log.Printf("MNO routing table loaded with %d prefixes from %d operators", len(routes), len(mnos))
+	return nil
+}
+
+// RefreshMNORoutes reloads the routing table after an MNO or channel change
+// and republishes the active channels to the consumers
+func RefreshMNORoutes() {
+	if err := LoadMNORoutes(utils.GetDB()); err != nil {
+		log.Printf("Failed to refresh MNO routing table: %v", err)
+		return
+	}
+	if client := utils.GetRedis(); client != nil {
+		if err := SyncChannels(context.Background(), client); err != nil {
+			log.Printf("Failed to sync MNO channels: %v", err)
+		}
+	}
+}
+
+// SyncChannels publishes the active channels of the active operators to Redis,
+// where consumers read the channel TPS limits and their split across message types
+func SyncChannels(ctx context.Context, client *redis.Client) error {
+	mnoRoutes.mu.RLock()
+	seen := make(map[uuid.UUID]bool)
+	var channels []mnochannel.Channel
+	for _, route := range mnoRoutes.routes {
+		if seen[route.MNOID] {
+			continue
+		}
+		seen[route.MNOID] = true
+		for _, channel := range route.Channels {
+			channels = append(channels, mnochannel.Channel{
+				MNO:         route.MNOName,
+				ChannelID:   channel.ChannelID,
+				Type:        channel.ChannelType,
+				Priority:    channel.Priority,
+				TPS:         channel.TPS,
+				Allocations: allocations(channel.TPSAllocations),
+				SMPP:        smppConfig(channel),
+				HTTP:        httpConfig(channel),
+			})
+		}
+	}
+	mnoRoutes.mu.RUnlock()
+
+	return mnochannel.Sync(ctx, client, channels)
+}
+
+// allocations orders the TPS shares of a channel from the highest priority message type.
+// Types missing from MsgPriority rank below every configured type.
+func allocations(shares []models.ChannelTPSAllocation) []mnochannel.Allocation {
+	result := make([]mnochannel.Allocation, 0, len(shares))
+	for _, share := range shares {
+		msgType := NormalizeType(share.Message_Type)
+		level := math.MaxInt32
+		if route, ok := ResolveType(msgType); ok {
+			level = route.PriorityLevel
+		}
+		result = append(result, mnochannel.Allocation{Type: msgType, Share: share.Share_Percent, Level: level})
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Level < result[j].Level })
+	return result
+}
+
+// smppConfig returns the SMSC connection of an SMPP channel
+func smppConfig(channel models.MnoChannels) *mnochannel.SMPP {
+	if !strings.EqualFold(channel.ChannelType, "SMPP") {
+		return nil
+	}
+	return &mnochannel.SMPP{
+		Host:       channel.Host,
+		Port:       channel.Port,
+		SystemID:   channel.SystemID,
+		Password:   channel.Password,
+		SystemType: channel.SystemType,
+		BindMode:   channel.BindMode,
+		WindowSize: channel.WindowSize,
+		SourceAddr: channel.SourceAddr,
+	}
+}
+
+// httpConfig returns the adapter configuration of an HTTP channel
+func httpConfig(channel models.MnoChannels) json.RawMessage {
+	if !strings.EqualFold(channel.ChannelType, "HTTP") || channel.HTTPConfig == "" {
+		return nil
+	}
+	return json.RawMessage(channel.HTTPConfig)
+}
+
+// ResolveMNO finds the operator for a local 11-digit MSISDN using the longest matching prefix
+func ResolveMNO(msisdn string) (Route, bool) {
+	mnoRoutes.mu.RLock()
+	defer mnoRoutes.mu.RUnlock()
+
+	for n := min(mnoRoutes.maxLen, len(msisdn)); n > 0; n-- {
+		if route, ok := mnoRoutes.routes[msisdn[:n]]; ok {
+			return route, true
+		}
+	}
+	return Route{}, false
+}
+
+// FindMNO returns the route of an active operator by name, ignoring case
+func FindMNO(name string) (Route, bool) {
+	mnoRoutes.mu.RLock()
+	defer mnoRoutes.mu.RUnlock()
+
+	for _, route := range mnoRoutes.routes {
+		if strings.EqualFold(route.MNOName, name) {
+			return route, true
+		}
+	}
+	return Route{}, false
+}
+
+// splitPrefixes parses a comma separated prefix list such as "017, 013" into local form
+func splitPrefixes(value string) []string {
+	var prefixes []string
+	for _, prefix := range strings.Split(value, ",") {
+		prefix = strings.TrimPrefix(strings.TrimSpace(prefix), "+")
+		if strings.HasPrefix(prefix, "880") {
+			prefix = "0" + prefix[3:]
+		}
+		if prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
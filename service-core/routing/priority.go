@@ -0,0 +1,170 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"myproject/consumer"
+	"myproject/models"
+	"myproject/rabbitmq"
+	"myproject/utils"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// TypeRoute is the queue and AMQP priority configured for a message type
+type TypeRoute struct {
+	Type          string `json:"type"`
+	Queue         string `json:"queue"`
+	PriorityLevel int    `json:"priority_level"`
+	Priority      uint8  `json:"amqp_priority"`
+	Weight        int    `json:"weight"`
+}
+
+// typeTable is an in-memory copy of the MsgPriority configuration
+type typeTable struct {
+	mu     sync.RWMutex
+	routes map[string]TypeRoute
+}
+
+var typeRoutes = &typeTable{routes: make(map[string]TypeRoute)}
+
+// DefaultType is the message type of requests without one. It is routed to its queue of the topology at the
+// lowest priority level unless MsgPriority configures it.
+const DefaultType = "general"
+
+// defaultPriorityLevel is the lowest MsgPriority level
+const defaultPriorityLevel = 3
+
+// LoadMsgPriorities rebuilds the message type table from MsgPriority
+func LoadMsgPriorities(db *gorm.DB) error {
+	if db == nil {
+		return errors.New("database connection is not initialized")
+	}
+
+	var priorities []models.MsgPriority
+	if err := db.Find(&priorities).Error; err != nil {
+		return err
+	}
+
+	routes := make(map[string]TypeRoute)
+	for _, p := range priorities {
+		msgType := NormalizeType(p.Message_Type)
+		if msgType == "" {
+			continue
+		}
+		if existing, ok := routes[msgType]; ok {
+			log.Printf("Message type %s is configured more than once, keeping priority level %d", msgType, existing.PriorityLevel)
+			continue
+		}
+		routes[msgType] = TypeRoute{
+			Type:          msgType,
+			Queue:         msgType,
+			PriorityLevel: p.Priority_Level,
+			Priority:      amqpPriority(p.Priority_Level),
+			Weight:        p.Weight,
+		}
+	}
+
+	if _, ok := routes[DefaultType]; !ok {
+		routes[DefaultType] = TypeRoute{
+			Type:          DefaultType,
+			Queue:         DefaultType,
+			PriorityLevel: defaultPriorityLevel,
+			Priority:      amqpPriority(defaultPriorityLevel),
+		}
+	}
+
+	typeRoutes.mu.Lock()
+	typeRoutes.routes = routes
+	typeRoutes.mu.Unlock()
+
+	log.Printf("Message type table loaded with %d types", len(routes))
+	return nil
+}
+
+// RefreshMsgPriorities reloads the message type table after a MsgPriority change
+// and republishes the consumer priority tiers and the channels, whose TPS shares are ranked by priority
+func RefreshMsgPriorities() {
+	if err := LoadMsgPriorities(utils.GetDB()); err != nil {
+		log.Printf("Failed to refresh message type table: %v", err)
+		return
+	}
+	if client := utils.GetRedis(); client != nil {
+		if err := SyncPriorities(context.Background(), client); err != nil {
+			log.Printf("Failed to sync consumer priority tiers: %v", err)
+		}
+		if err := SyncChannels(context.Background(), client); err != nil {
+			log.Printf("Failed to sync MNO channels: %v", err)
+		}
+	}
+}
+
+// SyncPriorities publishes the message types as consumer priority tiers to Redis,
+// where priority consumers read their queues and weights
+func SyncPriorities(ctx context.Context, client *redis.Client) error {
+	types := MessageTypes()
+	tiers := make([]consumer.Tier, 0, len(types))
+	for _, route := range types {
+		weight := route.Weight
+		if weight <= 0 {
+			weight = consumer.DefaultWeight(route.PriorityLevel)
+		}
+		tiers = append(tiers, consumer.Tier{Queue: route.Queue, Level: route.PriorityLevel, Weight: weight})
+	}
+
+	data, err := json.Marshal(tiers)
+	if err != nil {
+		return err
+	}
+	return client.Set(ctx, consumer.TiersKey, data, 0).Err()
+}
+
+// ResolveType looks up the queue and priority for a message type
+func ResolveType(msgType string) (TypeRoute, bool) {
+	typeRoutes.mu.RLock()
+	defer typeRoutes.mu.RUnlock()
+
+	route, ok := typeRoutes.routes[NormalizeType(msgType)]
+	return route, ok
+}
+
+// MessageTypes returns the configured message types ordered from highest to lowest priority
+func MessageTypes() []TypeRoute {
+	typeRoutes.mu.RLock()
+	defer typeRoutes.mu.RUnlock()
+
+	routes := make([]TypeRoute, 0, len(typeRoutes.routes))
+	for _, route := range typeRoutes.routes {
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].PriorityLevel != routes[j].PriorityLevel {
+			return routes[i].PriorityLevel < routes[j].PriorityLevel
+		}
+		return routes[i].Type < routes[j].Type
+	})
+	return routes
+}
+
+// NormalizeType converts a configured or requested message type to its canonical queue name
+func NormalizeType(msgType string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(msgType)), " ", "_")
+}
+
+// amqpPriority maps a priority level (0 = highest) to an AMQP priority (higher = sooner)
+func amqpPriority(level int) uint8 {
+	priority := rabbitmq.MaxPriority - level
+	if priority < 0 {
+		priority = 0
+	}
+	if priority > rabbitmq.MaxPriority {
+		priority = rabbitmq.MaxPriority
+	}
+	return uint8(priority)
+}
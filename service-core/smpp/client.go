@@ -0,0 +1,456 @@
+package smpp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BindMode selects the directions a session carries
+type BindMode string
+
+const (
+	// Transmitter only submits messages
+	Transmitter BindMode = "transmitter"
+	// Receiver only receives delivery receipts and mobile originated messages
+	Receiver BindMode = "receiver"
+	// Transceiver submits and receives on one session
+	Transceiver BindMode = "transceiver"
+)
+
+// ParseBindMode reads a bind mode, defaulting to transceiver
+func ParseBindMode(value string) (BindMode, error) {
+	switch mode := BindMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return Transceiver, nil
+	case Transmitter, Receiver, Transceiver:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid bind mode %q", value)
+}
+
+func (m BindMode) command() CommandID {
+	switch m {
+	case Transmitter:
+		return BindTransmitter
+	case Receiver:
+		return BindReceiver
+	}
+	return BindTransceiver
+}
+
+// Client defaults
+const (
+	DefaultWindow          = 10
+	DefaultEnquireLink     = 30 * time.Second
+	DefaultResponseTimeout = 10 * time.Second
+	minReconnectDelay      = 1 * time.Second
+	maxReconnectDelay      = 30 * time.Second
+	maxSequence            = 0x7FFFFFFF
+)
+
+var (
+	// ErrClosed is returned once the client was closed
+	ErrClosed = errors.New("smpp: client closed")
+	// ErrNotBound is returned when the context ends before the client is bound
+	ErrNotBound = errors.New("smpp: not bound")
+	// ErrReceiverOnly is returned when submitting on a receiver bind
+	ErrReceiverOnly = errors.New("smpp: a receiver bind cannot submit")
+	// ErrThrottled matches the errors of submissions the SMSC refused because of its rate limit or a full queue
+	ErrThrottled = errors.New("smpp: throttled by SMSC")
+	// ErrTimeout is returned when the SMSC does not answer within the response timeout
+	ErrTimeout = errors.New("smpp: response timeout")
+	// ErrNoResponse matches the errors of requests that were sent, or partly written, but not answered,
+	// because of a timeout, cancellation or lost connection; the SMSC may have processed them
+	ErrNoResponse = errors.New("smpp: request sent without response")
+)
+
+// StatusError is a request answered with an error status or a generic_nack
+type StatusError struct {
+	Command CommandID
+	Status  Status
+	Nack    bool
+}
+
+func (e *StatusError) Error() string {
+	if e.Nack {
+		return fmt.Sprintf("smpp: %s answered with generic_nack %s", e.Command, e.Status)
+	}
+	return fmt.Sprintf("smpp: %s failed with %s", e.Command, e.Status)
+}
+
+// Is makes throttling statuses match ErrThrottled
+func (e *StatusError) Is(target error) bool {
+	return target == ErrThrottled && (e.Status == StatusThrottled || e.Status == StatusMsgQueueFull)
+}
+
+// Config holds the SMSC address, credentials and session settings of a client
+type Config struct {
+	Addr       string
+	SystemID   string
+	Password   string
+	SystemType string
+	BindMode   BindMode
+	// Window is the number of submit_sm awaiting a response at any time
+	Window int
+	// EnquireLink is the keepalive interval
+	EnquireLink time.Duration
+	// ResponseTimeout bounds the wait for a response and for connecting
+	ResponseTimeout time.Duration
+	// OnDeliver is called for every deliver_sm before it is acknowledged. An error answers
+	// with ESME_RSYSERR so the SMSC delivers it again.
+	OnDeliver func(Message) error
+}
+
+func (c Config) withDefaults() Config {
+	if c.BindMode == "" {
+		c.BindMode = Transceiver
+	}
+	if c.Window <= 0 {
+		c.Window = DefaultWindow
+	}
+	if c.EnquireLink <= 0 {
+		c.EnquireLink = DefaultEnquireLink
+	}
+	if c.ResponseTimeout <= 0 {
+		c.ResponseTimeout = DefaultResponseTimeout
+	}
+	return c
+}
+
+// Client keeps a session bound to an SMSC, rebinding with backoff whenever it is lost
+type Client struct {
+	cfg       Config
+	mu        sync.Mutex
+	session   *session
+	changed   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	stopped   chan struct{}
+}
+
+// NewClient creates a client and starts binding in the background
+func NewClient(cfg Config) *Client {
+	c := &Client{
+		cfg:     cfg.withDefaults(),
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go c.maintain()
+	return c
+}
+
+// Bound reports whether the client currently has a bound session
+func (c *Client) Bound() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session != nil
+}
+
+// Submit sends a submit_sm and returns the message ID assigned by the SMSC. It waits for the
+// client to be bound and for a free slot in the window until ctx ends.
+func (c *Client) Submit(ctx context.Context, m Message) (string, error) {
+	if c.cfg.BindMode == Receiver {
+		return "", ErrReceiverOnly
+	}
+	s, err := c.wait(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case s.window <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-s.closed:
+		return "", s.failure()
+	}
+	defer func() { <-s.window }()
+
+	resp, err := s.request(ctx, SubmitSM, m.Marshal())
+	if err != nil {
+		return "", err
+	}
+	if resp.Command == GenericNack || resp.Status != StatusOK {
+		return "", &StatusError{Command: SubmitSM, Status: resp.Status, Nack: resp.Command == GenericNack}
+	}
+	return UnmarshalMessageID(resp.Body)
+}
+
+// Close unbinds the session and stops reconnecting
+func (c *Client) Close() {
+	c.closeOnce.Do(func() { close(c.done) })
+	<-c.stopped
+}
+
+// wait returns the bound session, waiting for one until ctx ends
+func (c *Client) wait(ctx context.Context) (*session, error) {
+	for {
+		c.mu.Lock()
+		s, changed := c.session, c.changed
+		c.mu.Unlock()
+		if s != nil {
+			return s, nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %v", ErrNotBound, ctx.Err())
+		case <-c.done:
+			return nil, ErrClosed
+		}
+	}
+}
+
+func (c *Client) setSession(s *session) {
+	c.mu.Lock()
+	c.session = s
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.mu.Unlock()
+}
+
+// maintain binds a session and rebinds it with backoff whenever it is lost, until the client is closed
+func (c *Client) maintain() {
+	defer close(c.stopped)
+
+	delay := minReconnectDelay
+	for {
+		s, err := c.bind()
+		if err != nil {
+			log.Printf("SMPP bind to %s as %s failed: %v, retrying in %s", c.cfg.Addr, c.cfg.SystemID, err, delay)
+			select {
+			case <-time.After(delay):
+			case <-c.done:
+				return
+			}
+			delay = min(delay*2, maxReconnectDelay)
+			continue
+		}
+
+		delay = minReconnectDelay
+		c.setSession(s)
+		log.Printf("SMPP bound to %s as %s (%s)", c.cfg.Addr, c.cfg.SystemID, c.cfg.BindMode)
+
+		select {
+		case <-s.closed:
+			c.setSession(nil)
+			log.Printf("SMPP session to %s lost: %v", c.cfg.Addr, s.failure())
+		case <-c.done:
+			c.setSession(nil)
+			s.unbind()
+			return
+		}
+	}
+}
+
+// bind connects to the SMSC and binds a session
+func (c *Client) bind() (*session, error) {
+	conn, err := net.DialTimeout("tcp", c.cfg.Addr, c.cfg.ResponseTimeout)
+	if err != nil {
+		return nil, err
+	}
+	s := newSession(conn, &c.cfg)
+
+	command := c.cfg.BindMode.command()
+	bind := Bind{SystemID: c.cfg.SystemID, Password: c.cfg.Password, SystemType: c.cfg.SystemType}
+	conn.SetDeadline(time.Now().Add(c.cfg.ResponseTimeout))
+	if _, err := conn.Write(PDU{Command: command, Sequence: s.nextSequence(), Body: bind.Marshal()}.Marshal()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := ReadPDU(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.Command != command.Response() && resp.Command != GenericNack {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected %s in response to %s", resp.Command, command)
+	}
+	if resp.Command == GenericNack || resp.Status != StatusOK {
+		conn.Close()
+		return nil, &StatusError{Command: command, Status: resp.Status, Nack: resp.Command == GenericNack}
+	}
+	conn.SetDeadline(time.Time{})
+
+	go s.read()
+	go s.keepalive()
+	return s, nil
+}
+
+// session is one bound connection with its outstanding requests
+type session struct {
+	cfg       *Config
+	conn      net.Conn
+	writeMu   sync.Mutex
+	sequence  uint32
+	window    chan struct{}
+	mu        sync.Mutex
+	pending   map[uint32]chan PDU
+	closed    chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+func newSession(conn net.Conn, cfg *Config) *session {
+	return &session{
+		cfg:     cfg,
+		conn:    conn,
+		window:  make(chan struct{}, cfg.Window),
+		pending: make(map[uint32]chan PDU),
+		closed:  make(chan struct{}),
+	}
+}
+
+// nextSequence returns the next sequence number, wrapping within the range allowed by SMPP
+func (s *session) nextSequence() uint32 {
+	return (atomic.AddUint32(&s.sequence, 1)-1)%maxSequence + 1
+}
+
+func (s *session) write(p PDU) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(s.cfg.ResponseTimeout))
+	if n, err := s.conn.Write(p.Marshal()); err != nil {
+		s.close(err)
+		if n > 0 {
+			// Part of the PDU reached the connection, so the SMSC may still process it
+			return fmt.Errorf("%w: %w", ErrNoResponse, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// request sends a PDU and waits for the response with the same sequence number
+func (s *session) request(ctx context.Context, command CommandID, body []byte) (PDU, error) {
+	sequence := s.nextSequence()
+	response := make(chan PDU, 1)
+	s.mu.Lock()
+	s.pending[sequence] = response
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, sequence)
+		s.mu.Unlock()
+	}()
+
+	if err := s.write(PDU{Command: command, Sequence: sequence, Body: body}); err != nil {
+		return PDU{}, err
+	}
+
+	timer := time.NewTimer(s.cfg.ResponseTimeout)
+	defer timer.Stop()
+	select {
+	case resp := <-response:
+		return resp, nil
+	case <-ctx.Done():
+		return PDU{}, fmt.Errorf("%w: %w", ErrNoResponse, ctx.Err())
+	case <-s.closed:
+		return PDU{}, fmt.Errorf("%w: %w", ErrNoResponse, s.failure())
+	case <-timer.C:
+		return PDU{}, fmt.Errorf("%w: %w waiting for %s", ErrNoResponse, ErrTimeout, command.Response())
+	}
+}
+
+// read dispatches the PDUs received until the connection fails
+func (s *session) read() {
+	for {
+		p, err := ReadPDU(s.conn)
+		if err != nil {
+			s.close(err)
+			return
+		}
+
+		switch {
+		case p.Command.IsResponse():
+			s.mu.Lock()
+			response, ok := s.pending[p.Sequence]
+			s.mu.Unlock()
+			if ok {
+				select {
+				case response <- p:
+				default:
+				}
+			}
+		case p.Command == EnquireLink:
+			s.write(PDU{Command: EnquireLinkResp, Sequence: p.Sequence})
+		case p.Command == DeliverSM:
+			go s.deliver(p)
+		case p.Command == Unbind:
+			s.write(PDU{Command: UnbindResp, Sequence: p.Sequence})
+			s.close(errors.New("unbound by SMSC"))
+			return
+		default:
+			s.write(PDU{Command: GenericNack, Status: StatusInvalidCmdID, Sequence: p.Sequence})
+		}
+	}
+}
+
+// deliver hands a deliver_sm to the callback and acknowledges it
+func (s *session) deliver(p PDU) {
+	status := StatusOK
+	m, err := UnmarshalMessage(p.Body)
+	if err != nil {
+		log.Printf("SMPP invalid deliver_sm from %s: %v", s.cfg.Addr, err)
+		status = StatusInvalidMsgLen
+	} else if s.cfg.OnDeliver != nil {
+		if err := s.cfg.OnDeliver(m); err != nil {
+			log.Printf("SMPP deliver_sm from %s not processed: %v", s.cfg.Addr, err)
+			status = StatusSystemError
+		}
+	}
+	s.write(PDU{Command: DeliverSMResp, Status: status, Sequence: p.Sequence, Body: MessageID("")})
+}
+
+// keepalive sends enquire_link at the configured interval and drops the session when it is not answered
+func (s *session) keepalive() {
+	ticker := time.NewTicker(s.cfg.EnquireLink)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			if _, err := s.request(context.Background(), EnquireLink, nil); err != nil {
+				s.close(fmt.Errorf("enquire_link: %v", err))
+				return
+			}
+		}
+	}
+}
+
+// unbind ends the session gracefully
+func (s *session) unbind() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ResponseTimeout)
+	defer cancel()
+	s.request(ctx, Unbind, nil)
+	s.close(ErrClosed)
+}
+
+func (s *session) close(err error) {
+	s.closeOnce.Do(func() {
+		s.err = err
+		close(s.closed)
+		s.conn.Close()
+	})
+}
+
+// failure returns the error the session was closed with
+func (s *session) failure() error {
+	select {
+	case <-s.closed:
+		return s.err
+	default:
+		return nil
+	}
+}
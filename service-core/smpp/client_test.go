@@ -0,0 +1,56 @@
+package smpp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// failingConn accepts written bytes up to a limit and then fails
+type failingConn struct {
+	net.Conn
+	accept int
+}
+
+func (c *failingConn) Write(b []byte) (int, error) {
+	n := min(len(b), c.accept)
+	return n, errors.New("connection reset")
+}
+
+func (c *failingConn) SetWriteDeadline(time.Time) error { return nil }
+func (c *failingConn) Close() error                     { return nil }
+
+func TestRequestWriteFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept int
+		// noResponse is whether the failure may have reached the SMSC, so the request must not be resent
+		noResponse bool
+	}{
+		{"nothing written", 0, false},
+		{"header written", headerLen, true},
+		{"partly written body", headerLen + 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{}.withDefaults()
+			s := newSession(&failingConn{accept: tt.accept}, &cfg)
+			body := Message{DestAddr: "8801712345678", ShortMessage: []byte("hello")}.Marshal()
+
+			_, err := s.request(context.Background(), SubmitSM, body)
+			if err == nil {
+				t.Fatal("request() succeeded on a failed write")
+			}
+			if got := errors.Is(err, ErrNoResponse); got != tt.noResponse {
+				t.Errorf("errors.Is(%v, ErrNoResponse) = %v, want %v", err, got, tt.noResponse)
+			}
+			select {
+			case <-s.closed:
+			default:
+				t.Error("session not closed after a failed write")
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+// Package smpp is an SMPP 3.4 client for submitting SMS to an MNO's SMSC and receiving its delivery receipts.
+package smpp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CommandID identifies the operation of a PDU
+type CommandID uint32
+
+// Command IDs used by the client
+const (
+	GenericNack         CommandID = 0x80000000
+	BindReceiver        CommandID = 0x00000001
+	BindReceiverResp    CommandID = 0x80000001
+	BindTransmitter     CommandID = 0x00000002
+	BindTransmitterResp CommandID = 0x80000002
+	SubmitSM            CommandID = 0x00000004
+	SubmitSMResp        CommandID = 0x80000004
+	DeliverSM           CommandID = 0x00000005
+	DeliverSMResp       CommandID = 0x80000005
+	Unbind              CommandID = 0x00000006
+	UnbindResp          CommandID = 0x80000006
+	BindTransceiver     CommandID = 0x00000009
+	BindTransceiverResp CommandID = 0x80000009
+	EnquireLink         CommandID = 0x00000015
+	EnquireLinkResp     CommandID = 0x80000015
+)
+
+// IsResponse reports whether the command answers a request
+func (id CommandID) IsResponse() bool {
+	return id&0x80000000 != 0
+}
+
+// Response returns the response command of a request
+func (id CommandID) Response() CommandID {
+	return id | 0x80000000
+}
+
+func (id CommandID) String() string {
+	switch id {
+	case GenericNack:
+		return "generic_nack"
+	case BindReceiver:
+		return "bind_receiver"
+	case BindReceiverResp:
+		return "bind_receiver_resp"
+	case BindTransmitter:
+		return "bind_transmitter"
+	case BindTransmitterResp:
+		return "bind_transmitter_resp"
+	case SubmitSM:
+		return "submit_sm"
+	case SubmitSMResp:
+		return "submit_sm_resp"
+	case DeliverSM:
+		return "deliver_sm"
+	case DeliverSMResp:
+		return "deliver_sm_resp"
+	case Unbind:
+		return "unbind"
+	case UnbindResp:
+		return "unbind_resp"
+	case BindTransceiver:
+		return "bind_transceiver"
+	case BindTransceiverResp:
+		return "bind_transceiver_resp"
+	case EnquireLink:
+		return "enquire_link"
+	case EnquireLinkResp:
+		return "enquire_link_resp"
+	}
+	return fmt.Sprintf("command 0x%08x", uint32(id))
+}
+
+// Status is the command_status of a response PDU
+type Status uint32
+
+// Command statuses handled by the client
+const (
+	StatusOK             Status = 0x00000000
+	StatusInvalidMsgLen  Status = 0x00000001
+	StatusInvalidCmdLen  Status = 0x00000002
+	StatusInvalidCmdID   Status = 0x00000003
+	StatusInvalidBind    Status = 0x00000004
+	StatusAlreadyBound   Status = 0x00000005
+	StatusSystemError    Status = 0x00000008
+	StatusInvalidDstAddr Status = 0x0000000B
+	StatusBindFailed     Status = 0x0000000D
+	StatusInvalidPasswd  Status = 0x0000000E
+	StatusInvalidSysID   Status = 0x0000000F
+	StatusMsgQueueFull   Status = 0x00000014
+	StatusThrottled      Status = 0x00000058
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ESME_ROK"
+	case StatusInvalidMsgLen:
+		return "ESME_RINVMSGLEN"
+	case StatusInvalidCmdLen:
+		return "ESME_RINVCMDLEN"
+	case StatusInvalidCmdID:
+		return "ESME_RINVCMDID"
+	case StatusInvalidBind:
+		return "ESME_RINVBNDSTS"
+	case StatusAlreadyBound:
+		return "ESME_RALYBND"
+	case StatusSystemError:
+		return "ESME_RSYSERR"
+	case StatusInvalidDstAddr:
+		return "ESME_RINVDSTADR"
+	case StatusBindFailed:
+		return "ESME_RBINDFAIL"
+	case StatusInvalidPasswd:
+		return "ESME_RINVPASWD"
+	case StatusInvalidSysID:
+		return "ESME_RINVSYSID"
+	case StatusMsgQueueFull:
+		return "ESME_RMSGQFUL"
+	case StatusThrottled:
+		return "ESME_RTHROTTLED"
+	}
+	return fmt.Sprintf("status 0x%08x", uint32(s))
+}
+
+// Optional parameter tags read from deliver_sm
+const (
+	TagReceiptedMessageID uint16 = 0x001E
+	TagMessageState       uint16 = 0x0427
+	TagMessagePayload     uint16 = 0x0424
+)
+
+const (
+	headerLen = 16
+	// maxPDULen bounds the PDUs read from the SMSC; a short message is at most 254 octets
+	maxPDULen = 64 * 1024
+	// interfaceVersion is sent in bind requests
+	interfaceVersion = 0x34
+)
+
+// PDU is a protocol data unit exchanged with the SMSC
+type PDU struct {
+	Command  CommandID
+	Status   Status
+	Sequence uint32
+	Body     []byte
+}
+
+// Marshal encodes the PDU with its header
+func (p PDU) Marshal() []byte {
+	out := make([]byte, headerLen+len(p.Body))
+	binary.BigEndian.PutUint32(out[0:], uint32(len(out)))
+	binary.BigEndian.PutUint32(out[4:], uint32(p.Command))
+	binary.BigEndian.PutUint32(out[8:], uint32(p.Status))
+	binary.BigEndian.PutUint32(out[12:], p.Sequence)
+	copy(out[headerLen:], p.Body)
+	return out
+}
+
+// ReadPDU reads one PDU from r
+func ReadPDU(r io.Reader) (PDU, error) {
+	var header [headerLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return PDU{}, err
+	}
+	length := binary.BigEndian.Uint32(header[0:])
+	if length < headerLen || length > maxPDULen {
+		return PDU{}, fmt.Errorf("invalid PDU length %d", length)
+	}
+	p := PDU{
+		Command:  CommandID(binary.BigEndian.Uint32(header[4:])),
+		Status:   Status(binary.BigEndian.Uint32(header[8:])),
+		Sequence: binary.BigEndian.Uint32(header[12:]),
+		Body:     make([]byte, length-headerLen),
+	}
+	if _, err := io.ReadFull(r, p.Body); err != nil {
+		return PDU{}, err
+	}
+	return p, nil
+}
+
+// Bind holds the fields of a bind request
+type Bind struct {
+	SystemID   string
+	Password   string
+	SystemType string
+}
+
+// Marshal encodes the bind request body
+func (b Bind) Marshal() []byte {
+	var w writer
+	w.cstring(b.SystemID)
+	w.cstring(b.Password)
+	w.cstring(b.SystemType)
+	w.byte(interfaceVersion)
+	w.byte(0) // addr_ton
+	w.byte(0) // addr_npi
+	w.cstring("")
+	return w.Bytes()
+}
+
+// UnmarshalBind decodes a bind request body
+func UnmarshalBind(body []byte) (Bind, error) {
+	r := reader{b: body}
+	b := Bind{SystemID: r.cstring(), Password: r.cstring(), SystemType: r.cstring()}
+	return b, r.err
+}
+
+// Message is the body of a submit_sm or deliver_sm
+type Message struct {
+	ServiceType        string
+	SourceTON          byte
+	SourceNPI          byte
+	SourceAddr         string
+	DestTON            byte
+	DestNPI            byte
+	DestAddr           string
+	ESMClass           byte
+	RegisteredDelivery byte
+	DataCoding         byte
+	ShortMessage       []byte
+	// Options holds the optional parameters by tag
+	Options map[uint16][]byte
+}
+
+// Marshal encodes the message body
+func (m Message) Marshal() []byte {
+	var w writer
+	w.cstring(m.ServiceType)
+	w.byte(m.SourceTON)
+	w.byte(m.SourceNPI)
+	w.cstring(m.SourceAddr)
+	w.byte(m.DestTON)
+	w.byte(m.DestNPI)
+	w.cstring(m.DestAddr)
+	w.byte(m.ESMClass)
+	w.byte(0)     // protocol_id
+	w.byte(0)     // priority_flag
+	w.cstring("") // schedule_delivery_time
+	w.cstring("") // validity_period
+	w.byte(m.RegisteredDelivery)
+	w.byte(0) // replace_if_present_flag
+	w.byte(m.DataCoding)
+	w.byte(0) // sm_default_msg_id
+	w.byte(byte(len(m.ShortMessage)))
+	w.Write(m.ShortMessage)
+	for tag, value := range m.Options {
+		w.tlv(tag, value)
+	}
+	return w.Bytes()
+}
+
+// UnmarshalMessage decodes a submit_sm or deliver_sm body
+func UnmarshalMessage(body []byte) (Message, error) {
+	r := reader{b: body}
+	m := Message{
+		ServiceType: r.cstring(),
+		SourceTON:   r.byte(),
+		SourceNPI:   r.byte(),
+		SourceAddr:  r.cstring(),
+		DestTON:     r.byte(),
+		DestNPI:     r.byte(),
+		DestAddr:    r.cstring(),
+		ESMClass:    r.byte(),
+	}
+	r.byte()    // protocol_id
+	r.byte()    // priority_flag
+	r.cstring() // schedule_delivery_time
+	r.cstring() // validity_period
+	m.RegisteredDelivery = r.byte()
+	r.byte() // replace_if_present_flag
+	m.DataCoding = r.byte()
+	r.byte() // sm_default_msg_id
+	m.ShortMessage = r.bytes(int(r.byte()))
+	m.Options = r.tlvs()
+	return m, r.err
+}
+
+// Text returns the short message, or the message_payload option when the short message is empty
+func (m Message) Text() []byte {
+	if len(m.ShortMessage) == 0 {
+		return m.Options[TagMessagePayload]
+	}
+	return m.ShortMessage
+}
+
+// MessageID encodes the message_id body of a submit_sm_resp or deliver_sm_resp
+func MessageID(id string) []byte {
+	var w writer
+	w.cstring(id)
+	return w.Bytes()
+}
+
+// UnmarshalMessageID decodes the message_id of a submit_sm_resp. A failed submission may have no body.
+func UnmarshalMessageID(body []byte) (string, error) {
+	if len(body) == 0 {
+		return "", nil
+	}
+	r := reader{b: body}
+	id := r.cstring()
+	return id, r.err
+}
+
+var errTruncated = errors.New("truncated PDU body")
+
+// writer appends PDU fields
+type writer struct {
+	bytes.Buffer
+}
+
+func (w *writer) cstring(s string) {
+	w.WriteString(s)
+	w.WriteByte(0)
+}
+
+func (w *writer) byte(b byte) {
+	w.WriteByte(b)
+}
+
+func (w *writer) tlv(tag uint16, value []byte) {
+	var header [4]byte
+	binary.BigEndian.PutUint16(header[0:], tag)
+	binary.BigEndian.PutUint16(header[2:], uint16(len(value)))
+	w.Write(header[:])
+	w.Write(value)
+}
+
+// reader consumes PDU fields, keeping the first error
+type reader struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (r *reader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(r.b[r.off:], 0)
+	if end < 0 {
+		r.err = errTruncated
+		return ""
+	}
+	s := string(r.b[r.off : r.off+end])
+	r.off += end + 1
+	return s
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.off >= len(r.b) {
+		r.err = errTruncated
+		return 0
+	}
+	b := r.b[r.off]
+	r.off++
+	return b
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.off+n > len(r.b) {
+		r.err = errTruncated
+		return nil
+	}
+	out := append([]byte(nil), r.b[r.off:r.off+n]...)
+	r.off += n
+	return out
+}
+
+func (r *reader) tlvs() map[uint16][]byte {
+	var options map[uint16][]byte
+	for r.err == nil && len(r.b)-r.off >= 4 {
+		tag := binary.BigEndian.Uint16(r.b[r.off:])
+		length := int(binary.BigEndian.Uint16(r.b[r.off+2:]))
+		r.off += 4
+		value := r.bytes(length)
+		if options == nil {
+			options = make(map[uint16][]byte)
+		}
+		options[tag] = value
+	}
+	return options
+}
@@ -0,0 +1,154 @@
+package smpp
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestPDURoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		pdu  PDU
+	}{
+		{"enquire_link", PDU{Command: EnquireLink, Sequence: 1, Body: []byte{}}},
+		{"submit_sm_resp", PDU{Command: SubmitSMResp, Status: StatusThrottled, Sequence: 0xFFFFFFFF, Body: MessageID("abc")}},
+		{"submit_sm", PDU{Command: SubmitSM, Sequence: 42, Body: Message{DestAddr: "8801712345678", ShortMessage: []byte("hi")}.Marshal()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadPDU(bytes.NewReader(tt.pdu.Marshal()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.pdu) {
+				t.Errorf("ReadPDU() = %+v, want %+v", got, tt.pdu)
+			}
+		})
+	}
+}
+
+func TestReadPDUInvalid(t *testing.T) {
+	valid := PDU{Command: EnquireLink, Sequence: 1, Body: []byte{1, 2, 3}}.Marshal()
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short header", valid[:10]},
+		{"short body", valid[:len(valid)-1]},
+		{"length below header", []byte{0, 0, 0, 8, 0, 0, 0, 0x15, 0, 0, 0, 0, 0, 0, 0, 1}},
+		{"length above limit", []byte{0, 1, 0, 1, 0, 0, 0, 0x15, 0, 0, 0, 0, 0, 0, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadPDU(bytes.NewReader(tt.data)); err == nil {
+				t.Error("ReadPDU() accepted an invalid PDU")
+			}
+		})
+	}
+}
+
+func TestReadPDUStream(t *testing.T) {
+	var stream bytes.Buffer
+	for seq := uint32(1); seq <= 3; seq++ {
+		stream.Write(PDU{Command: EnquireLinkResp, Sequence: seq}.Marshal())
+	}
+	for seq := uint32(1); seq <= 3; seq++ {
+		p, err := ReadPDU(&stream)
+		if err != nil || p.Sequence != seq {
+			t.Fatalf("ReadPDU() = %+v, %v, want sequence %d", p, err, seq)
+		}
+	}
+	if _, err := ReadPDU(&stream); err != io.EOF {
+		t.Errorf("ReadPDU() at the end = %v, want EOF", err)
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+	}{
+		{"minimal", Message{}},
+		{"submit_sm", Message{
+			SourceTON:          5,
+			SourceAddr:         "BRAND",
+			DestTON:            1,
+			DestNPI:            1,
+			DestAddr:           "8801712345678",
+			RegisteredDelivery: 1,
+			ShortMessage:       []byte("hello"),
+		}},
+		{"UCS-2 part with UDH", Message{
+			DestAddr:     "8801712345678",
+			ESMClass:     0x40,
+			DataCoding:   0x08,
+			ShortMessage: append([]byte{0x05, 0x00, 0x03, 0x2A, 0x02, 0x01}, 0x09, 0x86),
+		}},
+		{"deliver_sm receipt", Message{
+			ServiceType: "CMT",
+			SourceAddr:  "8801712345678",
+			ESMClass:    0x04,
+			Options: map[uint16][]byte{
+				TagReceiptedMessageID: []byte("ABC123\x00"),
+				TagMessageState:       {2},
+			},
+		}},
+		{"message_payload", Message{
+			DestAddr: "8801712345678",
+			Options:  map[uint16][]byte{TagMessagePayload: bytes.Repeat([]byte("x"), 300)},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnmarshalMessage(tt.message.Marshal())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.message) {
+				t.Errorf("UnmarshalMessage() = %+v, want %+v", got, tt.message)
+			}
+			if !bytes.Equal(got.Text(), tt.message.Text()) {
+				t.Errorf("Text() = %q, want %q", got.Text(), tt.message.Text())
+			}
+		})
+	}
+}
+
+func TestUnmarshalMessageTruncated(t *testing.T) {
+	body := Message{SourceAddr: "BRAND", DestAddr: "8801712345678", ShortMessage: []byte("hello")}.Marshal()
+	for _, n := range []int{0, 1, 8, len(body) - 1} {
+		if _, err := UnmarshalMessage(body[:n]); err == nil {
+			t.Errorf("UnmarshalMessage() accepted a body truncated to %d bytes", n)
+		}
+	}
+}
+
+func TestBindRoundTrip(t *testing.T) {
+	bind := Bind{SystemID: "gateway", Password: "secret", SystemType: "SMPP"}
+	got, err := UnmarshalBind(bind.Marshal())
+	if err != nil || got != bind {
+		t.Errorf("UnmarshalBind() = %+v, %v, want %+v", got, err, bind)
+	}
+}
+
+func TestUnmarshalMessageID(t *testing.T) {
+	tests := []struct {
+		body    []byte
+		want    string
+		wantErr bool
+	}{
+		{MessageID("0A1B2C"), "0A1B2C", false},
+		{MessageID(""), "", false},
+		{nil, "", false},
+		{[]byte("unterminated"), "", true},
+	}
+	for _, tt := range tests {
+		got, err := UnmarshalMessageID(tt.body)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("UnmarshalMessageID(%q) = %q, %v", tt.body, got, err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package smpp
+
+import (
+	"strings"
+
+	"myproject/smsencoding"
+)
+
+// Data codings of short messages
+const (
+	CodingDefault byte = 0x00
+	CodingUCS2    byte = 0x08
+)
+
+// ESM class bits
+const (
+	ESMUDHI         byte = 0x40
+	ESMReceipt      byte = 0x04
+	esmMessageTypes byte = 0x3C
+)
+
+// RegisteredDeliveryFinal requests a receipt once the message reached a final state
+const RegisteredDeliveryFinal byte = 0x01
+
+// Final message states reported in delivery receipts
+const (
+	StateDelivered     = "DELIVRD"
+	StateExpired       = "EXPIRED"
+	StateDeleted       = "DELETED"
+	StateUndeliverable = "UNDELIV"
+	StateAccepted      = "ACCEPTD"
+	StateUnknown       = "UNKNOWN"
+	StateRejected      = "REJECTD"
+	StateEnroute       = "ENROUTE"
+)
+
+// receiptStates maps the message_state option to the receipt state names
+var receiptStates = map[byte]string{
+	1: StateEnroute,
+	2: StateDelivered,
+	3: StateExpired,
+	4: StateDeleted,
+	5: StateUndeliverable,
+	6: StateAccepted,
+	7: StateUnknown,
+	8: StateRejected,
+}
+
+// Receipt is a delivery receipt sent by the SMSC in a deliver_sm
+type Receipt struct {
+	// ID is the message_id the SMSC returned in the submit_sm_resp
+	ID    string
+	State string
+	Err   string
+	Text  string
+}
+
+// receiptFields are the fields of the receipt text in the order defined by SMPP 3.4 appendix B
+var receiptFields = []string{"id", "sub", "dlvrd", "submit date", "done date", "stat", "err", "text"}
+
+// IsReceipt reports whether a deliver_sm carries a delivery receipt rather than a mobile originated message
+func (m Message) IsReceipt() bool {
+	return m.ESMClass&esmMessageTypes == ESMReceipt
+}
+
+// Receipt parses the delivery receipt of a deliver_sm. The receipted_message_id and message_state
+// options take precedence over the text when the SMSC sends them.
+func (m Message) Receipt() (Receipt, bool) {
+	if !m.IsReceipt() {
+		return Receipt{}, false
+	}
+	fields := parseReceiptText(string(m.Text()))
+	receipt := Receipt{ID: fields["id"], State: strings.ToUpper(fields["stat"]), Err: fields["err"], Text: fields["text"]}
+	if id, ok := m.Options[TagReceiptedMessageID]; ok {
+		receipt.ID = strings.TrimRight(string(id), "\x00")
+	}
+	if state, ok := m.Options[TagMessageState]; ok && len(state) == 1 {
+		if name, ok := receiptStates[state[0]]; ok {
+			receipt.State = name
+		}
+	}
+	return receipt, receipt.ID != ""
+}
+
+// Final reports whether the receipt state is final
+func (r Receipt) Final() bool {
+	switch r.State {
+	case StateDelivered, StateExpired, StateDeleted, StateUndeliverable, StateRejected:
+		return true
+	}
+	return false
+}
+
+// parseReceiptText reads "id:123 sub:001 dlvrd:001 submit date:2501011200 done date:2501011201 stat:DELIVRD err:000 text:..."
+func parseReceiptText(text string) map[string]string {
+	lower := strings.ToLower(text)
+	type position struct {
+		field      string
+		start, end int
+	}
+	var found []position
+	offset := 0
+	for _, field := range receiptFields {
+		i := strings.Index(lower[offset:], field+":")
+		if i < 0 {
+			continue
+		}
+		start := offset + i
+		found = append(found, position{field: field, start: start, end: start + len(field) + 1})
+		offset = start + len(field) + 1
+	}
+
+	fields := make(map[string]string, len(found))
+	for i, pos := range found {
+		end := len(text)
+		if i+1 < len(found) {
+			end = found[i+1].start
+		}
+		fields[pos.field] = strings.TrimSpace(text[pos.end:end])
+	}
+	return fields
+}
+
+// TextMessage builds the submit_sm of one part of a text in the encoding detected for the whole text,
+// GSM-7 being sent in the SMSC default alphabet, with the concatenation UDH of a long message
+func TextMessage(source, destination string, encoding smsencoding.Encoding, part smsencoding.Part) Message {
+	m := Message{
+		SourceTON:          sourceTON(source),
+		SourceAddr:         source,
+		DestNPI:            1, // ISDN, the TON is left unknown so the SMSC applies its numbering plan
+		DestAddr:           destination,
+		RegisteredDelivery: RegisteredDeliveryFinal,
+		DataCoding:         CodingDefault,
+	}
+	if len(source) > 0 && isDigits(source) {
+		m.SourceNPI = 1
+	}
+
+	var payload []byte
+	if encoding == smsencoding.UCS2 {
+		m.DataCoding = CodingUCS2
+		payload = smsencoding.EncodeUCS2(part.Text)
+	} else {
+		payload = smsencoding.EncodeGSM7(part.Text)
+	}
+	if len(part.UDH) > 0 {
+		m.ESMClass |= ESMUDHI
+		payload = append(append([]byte(nil), part.UDH...), payload...)
+	}
+	m.ShortMessage = payload
+	return m
+}
+
+// sourceTON is alphanumeric for sender names, otherwise unknown so the SMSC applies its numbering plan
+func sourceTON(source string) byte {
+	if source == "" || isDigits(source) {
+		return 0
+	}
+	return 5
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,204 @@
+package smsencoding
+
+import (
+	"hash/fnv"
+	"unicode/utf16"
+)
+
+// Encoding identifies the character set used to send an SMS
+type Encoding string
+
+const (
+	// GSM7 is the GSM 03.38 default alphabet with its extension table
+	GSM7 Encoding = "GSM-7"
+	// UCS2 is used for any text that does not fit GSM-7, such as Bangla
+	UCS2 Encoding = "UCS-2"
+)
+
+// Segment limits for single and concatenated messages
+const (
+	GSM7SingleLimit = 160
+	GSM7PartLimit   = 153
+	UCS2SingleLimit = 70
+	UCS2PartLimit   = 67
+
+	// MaxSegments is the most parts a concatenated message can have
+	MaxSegments = 255
+)
+
+// escape is the GSM-7 escape to the extension table
+const escape = 0x1B
+
+// gsm7Basic is the GSM 03.38 default alphabet, indexed by septet value
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension maps characters of the extension table to the septet sent after the escape
+var gsm7Extension = map[rune]byte{
+	'\f': 0x0A,
+	'^':  0x14,
+	'{':  0x28,
+	'}':  0x29,
+	'\\': 0x2F,
+	'[':  0x3C,
+	'~':  0x3D,
+	']':  0x3E,
+	'|':  0x40,
+	'€':  0x65,
+}
+
+var gsm7Table = func() map[rune]byte {
+	table := make(map[rune]byte, 128)
+	septet := 0
+	for _, r := range gsm7Basic {
+		if septet != escape {
+			table[r] = byte(septet)
+		}
+		septet++
+	}
+	return table
+}()
+
+// Info describes how a text will be sent
+type Info struct {
+	Encoding Encoding `json:"encoding"`
+	Units    int      `json:"units"`
+	Segments int      `json:"segments"`
+}
+
+// Part is one segment of a message with its concatenation header
+type Part struct {
+	Seq   int    `json:"seq"`
+	Total int    `json:"total"`
+	Text  string `json:"text"`
+	UDH   []byte `json:"udh,omitempty"`
+}
+
+// Detect returns GSM-7 when every character is in the default alphabet or extension table, otherwise UCS-2
+func Detect(text string) Encoding {
+	for _, r := range text {
+		if _, ok := gsm7Table[r]; ok {
+			continue
+		}
+		if _, ok := gsm7Extension[r]; ok {
+			continue
+		}
+		return UCS2
+	}
+	return GSM7
+}
+
+// Analyze returns the encoding, length in septets or UTF-16 units, and segment count of a text
+func Analyze(text string) Info {
+	encoding := Detect(text)
+	units := 0
+	for _, r := range text {
+		units += runeUnits(r, encoding)
+	}
+
+	single, part := limits(encoding)
+	segments := 1
+	if units > single {
+		segments = (units + part - 1) / part
+	}
+	return Info{Encoding: encoding, Units: units, Segments: segments}
+}
+
+// Split divides a text into parts that each fit one SMS. Escape sequences and
+// surrogate pairs are never split. Parts of a long message carry a UDH whose
+// reference number is derived from the parent message ID.
+func Split(text, parentID string) []Part {
+	encoding := Detect(text)
+	single, partLimit := limits(encoding)
+
+	if Analyze(text).Units <= single {
+		return []Part{{Seq: 1, Total: 1, Text: text}}
+	}
+
+	var chunks []string
+	var current []rune
+	used := 0
+	for _, r := range text {
+		n := runeUnits(r, encoding)
+		if used+n > partLimit {
+			chunks = append(chunks, string(current))
+			current = current[:0]
+			used = 0
+		}
+		current = append(current, r)
+		used += n
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, string(current))
+	}
+
+	ref := Reference(parentID)
+	parts := make([]Part, len(chunks))
+	for i, chunk := range chunks {
+		parts[i] = Part{
+			Seq:   i + 1,
+			Total: len(chunks),
+			Text:  chunk,
+			UDH:   UDH(ref, len(chunks), i+1),
+		}
+	}
+	return parts
+}
+
+// UDH builds the 8-bit reference concatenation header for one part
+func UDH(ref byte, total, seq int) []byte {
+	return []byte{0x05, 0x00, 0x03, ref, byte(total), byte(seq)}
+}
+
+// Reference derives the 8-bit concatenation reference number for a message ID
+func Reference(msgID string) byte {
+	h := fnv.New32a()
+	h.Write([]byte(msgID))
+	return byte(h.Sum32())
+}
+
+// EncodeGSM7 returns the unpacked septets of a GSM-7 text, one per byte
+func EncodeGSM7(text string) []byte {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		if septet, ok := gsm7Table[r]; ok {
+			out = append(out, septet)
+		} else if septet, ok := gsm7Extension[r]; ok {
+			out = append(out, escape, septet)
+		} else {
+			out = append(out, gsm7Table['?'])
+		}
+	}
+	return out
+}
+
+// EncodeUCS2 returns the big-endian UTF-16 bytes of a text
+func EncodeUCS2(text string) []byte {
+	units := utf16.Encode([]rune(text))
+	out := make([]byte, 0, len(units)*2)
+	for _, u := range units {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return out
+}
+
+// runeUnits is the number of septets or UTF-16 code units needed for r
+func runeUnits(r rune, encoding Encoding) int {
+	if encoding == UCS2 {
+		if r > 0xFFFF {
+			return 2
+		}
+		return 1
+	}
+	if _, ok := gsm7Extension[r]; ok {
+		return 2
+	}
+	return 1
+}
+
+func limits(encoding Encoding) (single, part int) {
+	if encoding == UCS2 {
+		return UCS2SingleLimit, UCS2PartLimit
+	}
+	return GSM7SingleLimit, GSM7PartLimit
+}
@@ -0,0 +1,89 @@
+package smsencoding
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want Info
+	}{
+		{"empty", "", Info{Encoding: GSM7, Units: 0, Segments: 1}},
+		{"single GSM-7", strings.Repeat("a", 160), Info{Encoding: GSM7, Units: 160, Segments: 1}},
+		{"two GSM-7 parts", strings.Repeat("a", 161), Info{Encoding: GSM7, Units: 161, Segments: 2}},
+		{"escapes count twice", strings.Repeat("€", 80), Info{Encoding: GSM7, Units: 160, Segments: 1}},
+		{"escape over the single limit", strings.Repeat("a", 159) + "{", Info{Encoding: GSM7, Units: 161, Segments: 2}},
+		{"single UCS-2", strings.Repeat("আ", 70), Info{Encoding: UCS2, Units: 70, Segments: 1}},
+		{"two UCS-2 parts", strings.Repeat("আ", 71), Info{Encoding: UCS2, Units: 71, Segments: 2}},
+		{"surrogate pairs count twice", strings.Repeat("😀", 35), Info{Encoding: UCS2, Units: 70, Segments: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Analyze(tt.text); got != tt.want {
+				t.Errorf("Analyze() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// want is the number of septets or UTF-16 units of each part
+		want []int
+	}{
+		{"single part", strings.Repeat("a", 160), []int{160}},
+		{"plain GSM-7", strings.Repeat("a", 306), []int{153, 153}},
+		{"escape at the boundary", strings.Repeat("a", 152) + "[" + strings.Repeat("a", 10), []int{152, 12}},
+		{"escape after the boundary", strings.Repeat("a", 153) + "]" + strings.Repeat("a", 10), []int{153, 12}},
+		{"escapes only", strings.Repeat("^", 100), []int{152, 48}},
+		{"surrogate pair at the boundary", strings.Repeat("আ", 66) + "😀" + strings.Repeat("আ", 3), []int{66, 5}},
+		{"UCS-2", strings.Repeat("আ", 134), []int{67, 67}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := Split(tt.text, "0000000000000000001")
+			if len(parts) != len(tt.want) {
+				t.Fatalf("Split() returned %d parts, want %d", len(parts), len(tt.want))
+			}
+
+			var joined strings.Builder
+			for i, part := range parts {
+				if part.Seq != i+1 || part.Total != len(parts) {
+					t.Errorf("part %d: Seq/Total = %d/%d", i, part.Seq, part.Total)
+				}
+				if units := Analyze(part.Text).Units; units != tt.want[i] {
+					t.Errorf("part %d: %d units, want %d", i, units, tt.want[i])
+				}
+				if len(parts) > 1 && len(part.UDH) != 6 {
+					t.Errorf("part %d: UDH = %x", i, part.UDH)
+				}
+				joined.WriteString(part.Text)
+			}
+			if joined.String() != tt.text {
+				t.Errorf("parts do not join back to the text")
+			}
+		})
+	}
+}
+
+func TestEncodeGSM7(t *testing.T) {
+	tests := []struct {
+		text string
+		want []byte
+	}{
+		{"A@", []byte{0x41, 0x00}},
+		{"€", []byte{escape, 0x65}},
+		{"a{b", []byte{0x61, escape, 0x28, 0x62}},
+		{"আ", []byte{0x3F}},
+	}
+	for _, tt := range tests {
+		if got := EncodeGSM7(tt.text); string(got) != string(tt.want) {
+			t.Errorf("EncodeGSM7(%q) = %x, want %x", tt.text, got, tt.want)
+		}
+	}
+}